@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shopping-list/db"
+	"shopping-list/services"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultAisleOrder returns the aisle order configured for every user
+func (api *ApiHandler) defaultAisleOrder() []string {
+	if len(api.conf.AisleOrder) > 0 {
+		return api.conf.AisleOrder
+	}
+	return services.IngredientTypes
+}
+
+// aisleOrder returns the custom aisle order of the user, or the default one
+func (api *ApiHandler) aisleOrder(ctx context.Context, userId string) (*AisleOrderResponse, error) {
+	aisles, err := api.store.GetAisleOrder(ctx, userId)
+	if errors.Is(err, db.ErrNotFound) {
+		return &AisleOrderResponse{Aisles: api.defaultAisleOrder()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &AisleOrderResponse{Aisles: aisles, Custom: true}, nil
+}
+
+// groupByType puts the items in sections of their catalog type following the aisle order, the types missing
+// from the order come after in the default order. The items missing from the catalog are in the other section.
+func (api *ApiHandler) groupByType(items []ShoppingListItem, aisles []string) []ShoppingListSection {
+	order := slices.Clone(aisles)
+	for _, aisle := range append(api.defaultAisleOrder(), services.IngredientTypes...) {
+		if !slices.Contains(order, aisle) {
+			order = append(order, aisle)
+		}
+	}
+
+	byType := make(map[string][]ShoppingListItem)
+	for _, item := range items {
+		itemType := services.OtherType
+		if item.Catalog != nil && item.Catalog.Type != "" {
+			itemType = item.Catalog.Type
+		}
+		if !slices.Contains(order, itemType) {
+			order = append(order, itemType)
+		}
+		byType[itemType] = append(byType[itemType], item)
+	}
+
+	sections := make([]ShoppingListSection, 0, len(byType))
+	for _, aisle := range order {
+		if len(byType[aisle]) > 0 {
+			sections = append(sections, ShoppingListSection{Type: aisle, Items: byType[aisle]})
+		}
+	}
+	return sections
+}
+
+func (api *ApiHandler) getAisleOrder(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getAisleOrder")
+	defer span.End()
+	l := logger.WithField("request", "getAisleOrder").WithContext(ctx)
+
+	order, err := api.aisleOrder(ctx, userID(c))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the aisle order")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+func (api *ApiHandler) setAisleOrder(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "setAisleOrder")
+	defer span.End()
+	l := logger.WithField("request", "setAisleOrder").WithContext(ctx)
+
+	request := new(AisleOrderRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding aisle order failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	userId := userID(c)
+	if err := api.store.SetAisleOrder(ctx, userId, request.Aisles); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to set the aisle order")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"userId": userId,
+		"aisles": request.Aisles,
+	}).Info("Aisle order set")
+	return c.JSON(http.StatusOK, &AisleOrderResponse{Aisles: request.Aisles, Custom: true})
+}
+
+func (api *ApiHandler) removeAisleOrder(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "removeAisleOrder")
+	defer span.End()
+	l := logger.WithField("request", "removeAisleOrder").WithContext(ctx)
+
+	if err := api.store.RemoveAisleOrder(ctx, userID(c)); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to remove the aisle order")
+		return NewStoreError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,30 +2,43 @@ package api
 
 import (
 	"shopping-list/configuration"
+	"shopping-list/db"
+	"shopping-list/services"
 	"shopping-list/validation"
 
 	"github.com/labstack/echo/v4"
 	amqp "github.com/rabbitmq/amqp091-go"
-	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type ApiHandler struct {
 	conf       *configuration.Configuration
-	rdb        *redis.Client
+	store      db.Store
 	amqp       *amqp.Connection
 	validation *validation.Validation
 	tracer     trace.Tracer
+	recipes    *services.RecipeClient
+	catalog    *services.CatalogClient
 }
 
-func NewApiHandler(conf *configuration.Configuration, rdb *redis.Client, amqp *amqp.Connection) *ApiHandler {
+func NewApiHandler(conf *configuration.Configuration, store db.Store, amqp *amqp.Connection) *ApiHandler {
+	timeout := conf.ServiceTimeout
+	if timeout == 0 {
+		timeout = services.DefaultTimeout
+	}
+	ttl := conf.CatalogCacheTTL
+	if ttl == 0 {
+		ttl = services.DefaultCatalogCacheTTL
+	}
 	handler := ApiHandler{
 		conf:       conf,
-		rdb:        rdb,
+		store:      store,
 		amqp:       amqp,
 		validation: validation.New(conf),
 		tracer:     otel.Tracer(conf.OtelServiceName),
+		recipes:    services.NewRecipeClient(conf.RecipeServiceURL, timeout, services.DefaultRetries),
+		catalog:    services.NewCatalogClient(conf.CatalogServiceURL, timeout, services.DefaultRetries, ttl),
 	}
 	return &handler
 }
@@ -36,17 +49,60 @@ func (api *ApiHandler) Register(v1 *echo.Group, conf *configuration.Configuratio
 	health.GET("/alive", api.getAliveStatus)
 	health.GET("/live", api.getAliveStatus)
 	health.GET("/ready", api.getReadyStatus)
-	// ingredients := v1.Group("/ingredient")
-	// ingredients.GET("/:id", api.getIngredient)
-	// ingredients.POST("/:id", api.addIngredient)
-	// ingredients.DELETE("/:id", api.removeIngredient)
-	recipe := v1.Group("/recipe")
-	// recipe.GET("/:id", api.getRecipe)
-	// recipe.GET("/:recipe_id/ingredient/:id", api.getIngredient)
+
+	// Every route but the health checks requires an authenticated user
+	auth, err := NewAuthMiddleware(conf)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load the keys of the authentication")
+	}
+	ingredients := v1.Group("/ingredient", auth)
+	ingredients.GET("/:id", api.getIngredient)
+	ingredients.POST("/:id", api.addIngredient)
+	ingredients.DELETE("/:id", api.removeIngredient)
+	recipe := v1.Group("/recipe", auth)
 	recipe.POST("", api.addRecipe)
-	// recipe.POST("/:recipe_id/ingredient/:id", api.addIngredient)
-	// recipe.DELETE("/:id", api.removeRecipe)
-	// recipe.DELETE("/:recipe_id/ingredient/:id", api.removeIngredient)
-	shoppingList := v1.Group("/shopping-list")
+	recipe.GET("/stats", api.getRecipeStats)
+	recipe.GET("/:id", api.getRecipe)
+	recipe.DELETE("/:id", api.removeRecipe)
+	recipe.POST("/:id/add", api.addServiceRecipe)
+	recipe.GET("/:recipe_id/ingredient/:id", api.getIngredient)
+	recipe.POST("/:recipe_id/ingredient/:id", api.addIngredient)
+	recipe.DELETE("/:recipe_id/ingredient/:id", api.removeIngredient)
+	pantry := v1.Group("/pantry", auth)
+	pantry.GET("", api.getPantry)
+	pantry.GET("/:id", api.getPantryItem)
+	pantry.PUT("/:id", api.setPantryItem)
+	pantry.DELETE("/:id", api.removePantryItem)
+	aisles := v1.Group("/aisles", auth)
+	aisles.GET("", api.getAisleOrder)
+	aisles.PUT("", api.setAisleOrder)
+	aisles.DELETE("", api.removeAisleOrder)
+	shoppingList := v1.Group("/shopping-list", auth)
 	shoppingList.GET("", api.getShoppingList)
+	shoppingList.GET("/lists", api.getLists)
+	shoppingList.POST("/lists", api.createList)
+	shoppingList.PATCH("/items/:id", api.checkItem)
+	shoppingList.POST("/complete", api.completeTrip)
+	shoppingList.GET("/history", api.getTrips)
+	shoppingList.GET("/history/:tripId", api.getTrip)
+	shoppingList.GET("/events", api.getEvents)
+	shoppingList.GET("/export", api.exportShoppingList)
+	shoppingList.POST("/import", api.importShoppingList)
+	shoppingList.POST("/undo", api.undo)
+	shoppingList.POST("/redo", api.redo)
+	shoppingList.GET("/:listId", api.getShoppingList)
+	shoppingList.PATCH("/:listId", api.renameList)
+	shoppingList.DELETE("/:listId", api.deleteList)
+	shoppingList.PATCH("/:listId/items/:id", api.checkItem)
+	shoppingList.POST("/:listId/complete", api.completeTrip)
+	shoppingList.GET("/:listId/history", api.getTrips)
+	shoppingList.GET("/:listId/history/:tripId", api.getTrip)
+	shoppingList.GET("/:listId/events", api.getEvents)
+	shoppingList.GET("/:listId/export", api.exportShoppingList)
+	shoppingList.POST("/:listId/import", api.importShoppingList)
+	shoppingList.POST("/:listId/undo", api.undo)
+	shoppingList.POST("/:listId/redo", api.redo)
+	shoppingList.GET("/:listId/members", api.getMembers)
+	shoppingList.PUT("/:listId/members/:userId", api.setMember)
+	shoppingList.DELETE("/:listId/members/:userId", api.removeMember)
 }
@@ -2,11 +2,19 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"shopping-list/db"
 	"shopping-list/tests"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
@@ -32,13 +40,14 @@ func setupTest(tb testing.TB) (*ApiHandler, func(tb testing.TB)) {
 	exposedPort := "6379" //fmt.Sprint(rand.Intn(65525-1024) + 1024)
 	redis, pool, resource := tests.InitTestDocker(exposedPort)
 	conf := tests.GetDefaultConf()
-	api := NewApiHandler(conf, redis, nil)
+	api := NewApiHandler(conf, db.NewRedisStore(redis), nil)
 	return api, func(tb testing.TB) {
 		tests.CloseTestDocker(redis, pool, resource)
 	}
 }
 
 func TestRedisManipulation(t *testing.T) {
+	tests.SkipWithoutDocker(t)
 	teardownSuite := setupSuite(t)
 	defer teardownSuite(t)
 
@@ -46,7 +55,7 @@ func TestRedisManipulation(t *testing.T) {
 		api, teardownTest := setupTest(t)
 		defer teardownTest(t)
 		// Test the ping to the Redis server
-		errr := api.rdb.Ping(context.Background()).Err()
+		errr := api.store.Ping(context.Background())
 		if errr != nil {
 			t.Errorf("Failed to ping the Redis server: %v", errr)
 		}
@@ -71,15 +80,15 @@ func TestRedisManipulation(t *testing.T) {
 			},
 		}
 
-		_, err := db.AddIngredient(api.rdb, "1", i1.ID, i1)
+		_, _, err := api.store.AddIngredient(context.Background(), "1", i1.ID, i1)
 		if err != nil {
 			t.Errorf("Failed to add first ingredient: %v", err)
 		}
-		_, err = db.AddIngredient(api.rdb, "1", i2.ID, i2)
+		_, _, err = api.store.AddIngredient(context.Background(), "1", i2.ID, i2)
 		if err != nil {
 			t.Errorf("Failed to add 2nd ingredient: %v", err)
 		}
-		i, err := db.GetIngredient(api.rdb, "1", i1.ID)
+		i, err := api.store.GetIngredient(context.Background(), "1", i1.ID)
 
 		if len(i.Quantities) != 1 {
 			t.Errorf("Failed to get the ingredient: %v", i)
@@ -96,7 +105,7 @@ func TestRedisManipulation(t *testing.T) {
 		logrus.SetLevel(logrus.DebugLevel)
 		// l := logrus.WithField("test", "Insert one Recipe in the DB")
 		api, teardownTest := setupTest(t)
-		errr := api.rdb.Ping(context.Background()).Err()
+		errr := api.store.Ping(context.Background())
 		if errr != nil {
 			t.Errorf("Failed to ping the Redis server: %v", errr)
 		}
@@ -109,7 +118,7 @@ func TestRedisManipulation(t *testing.T) {
 				},
 			},
 		}
-		ii, err := db.AddIngredient(api.rdb, "1", i.ID, i)
+		ii, _, err := api.store.AddIngredient(context.Background(), "1", i.ID, i)
 		if err != nil {
 			t.Errorf("Failed to add ingredient: %v", err)
 		}
@@ -122,7 +131,7 @@ func TestRedisManipulation(t *testing.T) {
 		if ii.Quantities[0].Amount != i.Quantities[0].Amount || ii.Quantities[0].Unit != i.Quantities[0].Unit {
 			t.Errorf("Failed to insert the ingredient: %v", ii)
 		}
-		ig, err := db.GetIngredient(api.rdb, "1", i.ID)
+		ig, err := api.store.GetIngredient(context.Background(), "1", i.ID)
 		if err != nil {
 			t.Errorf("Failed to get ingredient: %v", err)
 		}
@@ -135,7 +144,7 @@ func TestRedisManipulation(t *testing.T) {
 	t.Run("Insert one Recipe in the DB", func(t *testing.T) {
 		// Test the ping to the Redis server
 		api, teardownTest := setupTest(t)
-		errr := api.rdb.Ping(context.Background()).Err()
+		errr := api.store.Ping(context.Background())
 		if errr != nil {
 			t.Errorf("Failed to ping the Redis server: %v", errr)
 		}
@@ -163,13 +172,13 @@ func TestRedisManipulation(t *testing.T) {
 			},
 		}
 
-		err := db.AddRecipe(api.rdb, "1", "000000000000000000000001", &r, &ings)
+		_, err := api.store.AddRecipe(context.Background(), "1", "1", "000000000000000000000001", &r, &ings)
 
 		if err != nil {
 			t.Errorf("Failed to add recipe: %v", err)
 		}
 
-		recipe, err := db.GetRecipe(api.rdb, "1", "000000000000000000000001")
+		recipe, err := api.store.GetRecipe(context.Background(), "1", "000000000000000000000001")
 		if err != nil {
 			t.Errorf("Failed to get recipe: %v", err)
 		}
@@ -180,7 +189,7 @@ func TestRedisManipulation(t *testing.T) {
 
 		// Check if the ingredients have the correct quantities and are associated with the recipe
 		for i, id := range recipe.IngredientsID {
-			ingredient, err := db.GetIngredient(api.rdb, "1", id)
+			ingredient, err := api.store.GetIngredient(context.Background(), "1", id)
 			if err != nil {
 				t.Errorf("Failed to get ingredient: %v", err)
 			}
@@ -220,8 +229,8 @@ func TestRedisManipulation(t *testing.T) {
 			IngredientsID: []string{"000000000000000000000001", "000000000000000000000002"},
 		}
 		ings := []db.Ingredient{}
-		db.AddIngredient(api.rdb, "1", i1.ID, i1)
-		db.AddIngredient(api.rdb, "1", i2.ID, i2)
+		api.store.AddIngredient(context.Background(), "1", i1.ID, i1)
+		api.store.AddIngredient(context.Background(), "1", i2.ID, i2)
 
 		i1.Quantities[0].Amount = 1
 		i1.Quantities[0].Unit = "kg"
@@ -238,15 +247,15 @@ func TestRedisManipulation(t *testing.T) {
 
 		// }
 		// recipeDb, ingredientsDb := NewRecipe(recipe)
-		db.AddRecipe(api.rdb, "1", "000000000000000000000001", &r, &ings)
+		api.store.AddRecipe(context.Background(), "1", "1", "000000000000000000000001", &r, &ings)
 
 		// Check if the ingredients have the correct quantities and are associated with the recipe
-		i, _ := db.GetIngredient(api.rdb, "1", i1.ID)
+		i, _ := api.store.GetIngredient(context.Background(), "1", i1.ID)
 
 		if i.Quantities[0].Amount != 100 || i.Quantities[0].Unit != "g" {
 			t.Errorf("Failed to add the correct quantity to ingredient: %v", i)
 		}
-		if i.Quantities[1].Amount != 1 || i.Quantities[1].Unit != "kg" || i.Quantities[1].RecipeID != "000000000000000000000001" {
+		if i.Quantities[1].Amount != 1000 || i.Quantities[1].Unit != "g" || i.Quantities[1].RecipeID != "000000000000000000000001" {
 			t.Errorf("Failed to add the correct quantity to ingredient: %v", i)
 		}
 		defer teardownTest(t)
@@ -275,15 +284,15 @@ func TestRedisManipulation(t *testing.T) {
 			},
 		}
 		recipeDb, ingredientsDb := NewRecipe(&recipe)
-		db.AddRecipe(api.rdb, "1", recipe.ID, recipeDb, ingredientsDb)
+		api.store.AddRecipe(context.Background(), "1", "1", recipe.ID, recipeDb, ingredientsDb)
 
-		r, _ := db.GetRecipe(api.rdb, "1", recipe.ID)
+		r, _ := api.store.GetRecipe(context.Background(), "1", recipe.ID)
 
 		if r.IngredientsID[0] != "000000000000000000000001" || r.IngredientsID[1] != "000000000000000000000002" {
 			t.Errorf("Failed to convert the recipe to the DB: %v", r)
 		}
 
-		i, _ := db.GetIngredient(api.rdb, "1", "000000000000000000000001")
+		i, _ := api.store.GetIngredient(context.Background(), "1", "000000000000000000000001")
 
 		if i.Quantities[0].Amount != 1 || i.Quantities[0].Unit != "g" {
 			t.Errorf("Failed to convert the recipe to the DB: %v", i)
@@ -315,22 +324,22 @@ func TestRedisManipulation(t *testing.T) {
 			},
 		}
 		recipeDb, ingredientsDb := NewRecipe(&recipe)
-		db.AddRecipe(api.rdb, "1", recipe.ID, recipeDb, ingredientsDb)
+		api.store.AddRecipe(context.Background(), "1", "1", recipe.ID, recipeDb, ingredientsDb)
 
-		db.RemoveRecipe(api.rdb, "1", recipe.ID)
+		api.store.RemoveRecipe(context.Background(), "1", recipe.ID)
 
-		r, err := db.GetRecipe(api.rdb, "1", recipe.ID)
+		r, err := api.store.GetRecipe(context.Background(), "1", recipe.ID)
 		if err == nil || r != nil {
 			t.Errorf("Failed to delete the recipe: %v", err)
 		}
 
-		i1, err := db.GetIngredient(api.rdb, "1", "000000000000000000000001")
+		i1, err := api.store.GetIngredient(context.Background(), "1", "000000000000000000000001")
 
 		if err == nil || i1 != nil {
 			t.Errorf("Failed to delete the ingredient: %v", err)
 		}
 
-		i2, err := db.GetIngredient(api.rdb, "1", "000000000000000000000002")
+		i2, err := api.store.GetIngredient(context.Background(), "1", "000000000000000000000002")
 
 		if err == nil || i2 != nil {
 			t.Errorf("Failed to delete the 2nd ingredient: %v", err)
@@ -339,6 +348,92 @@ func TestRedisManipulation(t *testing.T) {
 		defer teardownTest(t)
 	})
 
+	t.Run("An ingredient added to a recipe is removed with it", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		r := db.Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ings := []db.Ingredient{{Quantities: []db.Quantity{{Amount: 1, Unit: "g", RecipeID: "000000000000000000000001"}}}}
+		api.store.AddRecipe(ctx, "1", "1", "000000000000000000000001", &r, &ings)
+
+		added := db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "i", RecipeID: "000000000000000000000001"}}}
+		if _, created, err := api.store.AddIngredient(ctx, "1", "000000000000000000000002", added); err != nil || !created {
+			t.Fatalf("The ingredient should be created: %v %v", created, err)
+		}
+		if _, created, _ := api.store.AddIngredient(ctx, "1", "000000000000000000000002", added); created {
+			t.Errorf("The ingredient saved should not be created again")
+		}
+		if _, _, err := api.store.AddIngredient(ctx, "1", "000000000000000000000003", db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "i", RecipeID: "unknown"}}}); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for an unknown recipe, got %v", err)
+		}
+		recipe, _ := api.store.GetRecipe(ctx, "1", "000000000000000000000001")
+		if len(recipe.IngredientsID) != 2 {
+			t.Errorf("The ingredient should be added to the recipe: %v", recipe)
+		}
+
+		api.store.RemoveRecipe(ctx, "1", "000000000000000000000001")
+		if list, _ := api.store.GetShoppingList(ctx, "1"); len(*list) != 0 {
+			t.Errorf("No line of the recipe should be left: %v", list)
+		}
+	})
+
+	t.Run("Concurrent additions of the same ingredient are not lost", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+
+		ingredientID := "000000000000000000000001"
+		workers := 20
+		additions := 10
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(2)
+			// Add the ingredient directly, like the HTTP handler and the ingredient consumer
+			go func() {
+				defer wg.Done()
+				for a := 0; a < additions; a++ {
+					_, _, err := api.store.AddIngredient(context.Background(), "1", ingredientID, db.Ingredient{
+						Quantities: []db.Quantity{{Amount: 1, Unit: "g"}},
+					})
+					if err != nil {
+						t.Errorf("Failed to add ingredient: %v", err)
+					}
+				}
+			}()
+			// Add the same ingredient through a recipe, like the recipe consumer
+			go func(w int) {
+				defer wg.Done()
+				recipeID := fmt.Sprintf("%024d", w)
+				r := db.Recipe{IngredientsID: []string{ingredientID}}
+				ings := []db.Ingredient{{Quantities: []db.Quantity{{Amount: 1, Unit: "g", RecipeID: recipeID}}}}
+				for a := 0; a < additions; a++ {
+					if _, err := api.store.AddRecipe(context.Background(), "1", "1", recipeID, &r, &ings); err != nil {
+						t.Errorf("Failed to add recipe: %v", err)
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		i, err := api.store.GetIngredient(context.Background(), "1", ingredientID)
+		if err != nil {
+			t.Fatalf("Failed to get ingredient: %v", err)
+		}
+		if len(i.Quantities) != workers+1 {
+			t.Fatalf("Expected %d quantities, got %v", workers+1, i)
+		}
+		for _, q := range i.Quantities {
+			expected := float64(additions)
+			if q.RecipeID == "" {
+				expected = float64(workers * additions)
+			}
+			if q.Amount != expected {
+				t.Errorf("Lost update on the quantity %v, expected %v", q, expected)
+			}
+		}
+	})
+
 	t.Run("Remove ingredient from the recipe that already exists", func(t *testing.T) {
 		api, teardownTest := setupTest(t)
 
@@ -362,7 +457,7 @@ func TestRedisManipulation(t *testing.T) {
 			},
 		}
 		recipeDb, ingredientsDb := NewRecipe(&recipe)
-		db.AddRecipe(api.rdb, "1", recipe.ID, recipeDb, ingredientsDb)
+		api.store.AddRecipe(context.Background(), "1", "1", recipe.ID, recipeDb, ingredientsDb)
 
 		i1 := db.Ingredient{
 			ID: "000000000000000000000001",
@@ -373,27 +468,31 @@ func TestRedisManipulation(t *testing.T) {
 				},
 			},
 		}
-		db.AddIngredient(api.rdb, "1", i1.ID, i1)
-
-		db.RemoveIngredient(api.rdb, "1", i1.ID, "000000000000000000000001", false)
+		api.store.AddIngredient(context.Background(), "1", i1.ID, i1)
 
-		err := db.RemoveIngredientFromRecipe(api.rdb, "1", "000000000000000000000001", recipe.ID)
+		err := api.store.RemoveIngredient(context.Background(), "1", i1.ID, "000000000000000000000001", false)
 		if err != nil {
-			t.Errorf("Failed to remove the ingredient from the recipe: %v", err)
+			t.Errorf("Failed to remove the ingredient of the recipe: %v", err)
+		}
+
+		// The ingredient was removed from the recipe with its quantities
+		err = api.store.RemoveIngredientFromRecipe(context.Background(), "1", "000000000000000000000001", recipe.ID)
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
 		}
-		i, _ := db.GetIngredient(api.rdb, "1", i1.ID)
+		i, _ := api.store.GetIngredient(context.Background(), "1", i1.ID)
 
-		if i.Quantities[0].Amount != 20 || i.Quantities[0].Unit != "kg" || len(i.Quantities) != 1 {
+		if i.Quantities[0].Amount != 20000 || i.Quantities[0].Unit != "g" || len(i.Quantities) != 1 {
 			t.Errorf("Failed to remove the ingredient from the ingredients list: %v", i)
 		}
 
-		i2, err := db.GetIngredient(api.rdb, "1", "000000000000000000000002")
+		i2, err := api.store.GetIngredient(context.Background(), "1", "000000000000000000000002")
 
 		if i2.Quantities[0].Amount != 10 {
 			t.Errorf("Failed to retrieve the correct quantity for the ingredient that should stay: %v", i2)
 		}
 
-		r, _ := db.GetRecipe(api.rdb, "1", recipe.ID)
+		r, _ := api.store.GetRecipe(context.Background(), "1", recipe.ID)
 
 		if r.IngredientsID[0] != "000000000000000000000002" {
 			t.Errorf("Failed to remove the ingredient from the recipe: %v", r)
@@ -401,4 +500,783 @@ func TestRedisManipulation(t *testing.T) {
 		defer teardownTest(t)
 	})
 
+	t.Run("Count the recipe usages", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		addRecipe := func(userId string, recipeId string) {
+			r := db.Recipe{IngredientsID: []string{"000000000000000000000001"}}
+			ings := []db.Ingredient{{ID: "000000000000000000000001", Quantities: []db.Quantity{{Amount: 1, Unit: "i"}}}}
+			if _, err := api.store.AddRecipe(ctx, userId, userId, recipeId, &r, &ings); err != nil {
+				t.Fatalf("Failed to add the recipe: %v", err)
+			}
+		}
+		addRecipe("1", "000000000000000000000001")
+		addRecipe("1", "000000000000000000000002")
+		addRecipe("1", "000000000000000000000002")
+		addRecipe("2", "000000000000000000000001")
+
+		stats, err := api.store.GetRecipeStats(ctx, "1", 10)
+		if err != nil {
+			t.Fatalf("Failed to get the recipe stats: %v", err)
+		}
+		if len(stats) != 2 || stats[0].RecipeID != "000000000000000000000002" || stats[0].TimesAdded != 2 || stats[1].TimesAdded != 1 {
+			t.Errorf("Wrong recipe stats: %v", stats)
+		}
+		if stats[0].LastUsedAt.IsZero() {
+			t.Errorf("The last usage should be saved: %v", stats[0])
+		}
+	})
+
+	t.Run("Named lists keep their content apart", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		primary, err := api.store.GetPrimaryList(ctx, "1")
+		if err != nil || !primary.Primary || primary.Namespace() != "user:1" {
+			t.Fatalf("Failed to create the primary list: %v %v", primary, err)
+		}
+		again, _ := api.store.GetPrimaryList(ctx, "1")
+		if again.ID != primary.ID {
+			t.Errorf("The primary list should be created once: %v %v", primary, again)
+		}
+
+		party, err := api.store.CreateList(ctx, "1", "Party")
+		if err != nil {
+			t.Fatalf("Failed to create the list: %v", err)
+		}
+		i := db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "kg"}}}
+		api.store.AddIngredient(ctx, primary.Namespace(), "000000000000000000000001", i)
+		api.store.AddIngredient(ctx, party.Namespace(), "000000000000000000000002", i)
+
+		list, _ := api.store.GetShoppingList(ctx, party.Namespace())
+		if len(*list) != 1 || (*list)[0].ID != "000000000000000000000002" {
+			t.Errorf("Wrong content of the named list: %v", list)
+		}
+
+		renamed, err := api.store.RenameList(ctx, "1", party.ID, "Birthday")
+		if err != nil || renamed.Name != "Birthday" {
+			t.Errorf("Failed to rename the list: %v %v", renamed, err)
+		}
+		lists, err := api.store.GetLists(ctx, "1")
+		if err != nil || len(lists) != 2 || lists[0].ID != primary.ID || lists[1].Name != "Birthday" {
+			t.Errorf("Wrong lists: %v %v", lists, err)
+		}
+
+		if err := api.store.DeleteList(ctx, "1", primary.ID); !errors.Is(err, db.ErrPrimaryList) {
+			t.Errorf("The primary list should not be deleted: %v", err)
+		}
+		if err := api.store.DeleteList(ctx, "1", party.ID); err != nil {
+			t.Fatalf("Failed to delete the list: %v", err)
+		}
+		if _, err := api.store.GetList(ctx, party.ID); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("The list should be deleted: %v", err)
+		}
+		list, _ = api.store.GetShoppingList(ctx, party.Namespace())
+		if len(*list) != 0 {
+			t.Errorf("The content of the list should be deleted: %v", list)
+		}
+		list, _ = api.store.GetShoppingList(ctx, primary.Namespace())
+		if len(*list) != 1 {
+			t.Errorf("The primary list should be kept: %v", list)
+		}
+	})
+
+	t.Run("Share a list with roles", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		list, _ := api.store.CreateList(ctx, "1", "Party")
+		primary, _ := api.store.GetPrimaryList(ctx, "1")
+		if err := api.store.SetMember(ctx, "1", primary.ID, "2", db.RoleEditor); !errors.Is(err, db.ErrPrimaryList) {
+			t.Errorf("The primary list should not be shared: %v", err)
+		}
+		if err := api.store.SetMember(ctx, "1", list.ID, "2", db.RoleEditor); err != nil {
+			t.Fatalf("Failed to share the list: %v", err)
+		}
+		if err := api.store.SetMember(ctx, "1", list.ID, "3", db.RoleViewer); err != nil {
+			t.Fatalf("Failed to share the list: %v", err)
+		}
+
+		if _, err := api.store.AuthorizeList(ctx, "2", list.ID, db.RoleEditor); err != nil {
+			t.Errorf("The editor should edit the list: %v", err)
+		}
+		if _, err := api.store.AuthorizeList(ctx, "3", list.ID, db.RoleEditor); !errors.Is(err, db.ErrForbidden) {
+			t.Errorf("The viewer should not edit the list: %v", err)
+		}
+		if _, err := api.store.AuthorizeList(ctx, "4", list.ID, db.RoleViewer); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("The list should not be found by the other users: %v", err)
+		}
+		if err := api.store.DeleteList(ctx, "2", list.ID); !errors.Is(err, db.ErrForbidden) {
+			t.Errorf("Only the owner deletes the list: %v", err)
+		}
+
+		lists, err := api.store.GetLists(ctx, "2")
+		if err != nil || len(lists) != 2 || lists[1].ID != list.ID || lists[1].Role != db.RoleEditor {
+			t.Errorf("The shared list should be in the lists of the member: %v %v", lists, err)
+		}
+		members, err := api.store.GetMembers(ctx, "3", list.ID)
+		if err != nil || len(members) != 3 || members[0].Role != db.RoleOwner || members[1].UserID != "2" {
+			t.Errorf("Wrong members: %v %v", members, err)
+		}
+
+		if err := api.store.RemoveMember(ctx, "1", list.ID, "3"); err != nil {
+			t.Errorf("Failed to remove the member: %v", err)
+		}
+		if err := api.store.DeleteList(ctx, "1", list.ID); err != nil {
+			t.Fatalf("Failed to delete the list: %v", err)
+		}
+		if lists, _ := api.store.GetLists(ctx, "2"); len(lists) != 1 {
+			t.Errorf("The deleted list should be removed from the lists of the members: %v", lists)
+		}
+	})
+
+	t.Run("Check the ingredients of the shopping list", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		recipe := db.Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ingredients := []db.Ingredient{{Quantities: []db.Quantity{{Amount: 1, Unit: "kg", RecipeID: "000000000000000000000001"}}}}
+		api.store.AddRecipe(ctx, "1", "1", "000000000000000000000001", &recipe, &ingredients)
+
+		checked, err := api.store.CheckIngredient(ctx, "1", "000000000000000000000001", "2", true)
+		if err != nil || !checked.Checked || checked.CheckedBy != "2" {
+			t.Fatalf("Failed to check the ingredient: %v %v", checked, err)
+		}
+		list, _ := api.store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 || !(*list)[0].Checked || !(*list)[0].CheckedAt.Equal(*checked.CheckedAt) {
+			t.Errorf("The check should be saved: %v", list)
+		}
+
+		// Adding the recipe again adds quantities to the ingredient and reopens it
+		api.store.AddRecipe(ctx, "1", "1", "000000000000000000000001", &recipe, &ingredients)
+		i, _ := api.store.GetIngredient(ctx, "1", "000000000000000000000001")
+		if i.Checked || i.Quantities[0].Amount != 2000 {
+			t.Errorf("The ingredient should be reopened: %v", i)
+		}
+
+		api.store.CheckIngredient(ctx, "1", "000000000000000000000001", "1", true)
+		if i, _ := api.store.CheckIngredient(ctx, "1", "000000000000000000000001", "1", false); i.Checked {
+			t.Errorf("Failed to uncheck the ingredient: %v", i)
+		}
+	})
+
+	t.Run("Complete a trip and browse the history", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		i := db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "kg"}}}
+		api.store.AddIngredient(ctx, "1", "000000000000000000000001", i)
+		api.store.AddIngredient(ctx, "1", "000000000000000000000002", i)
+		api.store.AddIngredient(ctx, "1", "000000000000000000000003", i)
+
+		if _, err := api.store.CompleteTrip(ctx, "1", "1"); !errors.Is(err, db.ErrEmptyTrip) {
+			t.Errorf("Expected ErrEmptyTrip, got %v", err)
+		}
+		api.store.CheckIngredient(ctx, "1", "000000000000000000000001", "1", true)
+		first, err := api.store.CompleteTrip(ctx, "1", "1")
+		if err != nil || len(first.Ingredients) != 1 {
+			t.Fatalf("Failed to complete the first trip: %v %v", first, err)
+		}
+		api.store.CheckIngredient(ctx, "1", "000000000000000000000002", "2", true)
+		second, err := api.store.CompleteTrip(ctx, "1", "2")
+		if err != nil || second.Ingredients[0].ID != "000000000000000000000002" || second.CompletedBy != "2" {
+			t.Fatalf("Failed to complete the second trip: %v %v", second, err)
+		}
+
+		list, _ := api.store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 || (*list)[0].ID != "000000000000000000000003" {
+			t.Errorf("Only the unchecked ingredients should stay: %v", list)
+		}
+		trips, err := api.store.GetTrips(ctx, "1", 10)
+		if err != nil || len(trips) != 2 || trips[0].ID != second.ID {
+			t.Errorf("The most recent trip should be first: %v %v", trips, err)
+		}
+		if trips, _ := api.store.GetTrips(ctx, "1", 1); len(trips) != 1 {
+			t.Errorf("The trips should be limited: %v", trips)
+		}
+		trip, err := api.store.GetTrip(ctx, "1", first.ID)
+		if err != nil || trip.Ingredients[0].CheckedBy != "1" || !trip.CompletedAt.Equal(first.CompletedAt) {
+			t.Errorf("Wrong trip: %v %v", trip, err)
+		}
+		if _, err := api.store.GetTrip(ctx, "1", "unknown"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Deduct the pantry from the recipes", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		api.store.SetPantryItem(ctx, "1", db.PantryItem{ID: "000000000000000000000001", Amount: 300, Unit: "g"})
+		api.store.SetPantryItem(ctx, "1", db.PantryItem{ID: "000000000000000000000002", Amount: 1, Unit: "i"})
+
+		recipe := db.Recipe{IngredientsID: []string{"000000000000000000000001", "000000000000000000000002"}}
+		ingredients := []db.Ingredient{
+			{Quantities: []db.Quantity{{Amount: 200, Unit: "g", RecipeID: "000000000000000000000001"}}},
+			{Quantities: []db.Quantity{{Amount: 3, Unit: "i", RecipeID: "000000000000000000000001"}}},
+		}
+		deductions, err := api.store.AddRecipe(ctx, "1", "1", "000000000000000000000001", &recipe, &ingredients)
+		if err != nil || len(deductions) != 2 || deductions[0].Shortfall != 0 || deductions[1].FromPantry != 1 || deductions[1].Shortfall != 2 {
+			t.Fatalf("Wrong deductions: %v %v", deductions, err)
+		}
+
+		list, _ := api.store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 || (*list)[0].ID != "000000000000000000000002" || (*list)[0].Quantities[0].Amount != 2 {
+			t.Errorf("Only the shortfall should be in the list: %v", list)
+		}
+		pantry, err := api.store.GetPantry(ctx, "1")
+		if err != nil || len(pantry) != 1 || pantry[0].Amount != 100 {
+			t.Errorf("The pantry should be deducted: %v %v", pantry, err)
+		}
+
+		api.store.CheckIngredient(ctx, "1", "000000000000000000000002", "1", true)
+		if _, err := api.store.CompleteTrip(ctx, "1", "1"); err != nil {
+			t.Fatalf("Failed to complete the trip: %v", err)
+		}
+		items, err := api.store.GetPantryItem(ctx, "1", "000000000000000000000002")
+		if err != nil || len(items) != 1 || items[0].Amount != 2 {
+			t.Errorf("The purchased quantities should be in the pantry: %v %v", items, err)
+		}
+
+		if err := api.store.RemovePantryItem(ctx, "1", "000000000000000000000001", "g"); err != nil {
+			t.Errorf("Failed to remove the pantry item: %v", err)
+		}
+		if _, err := api.store.GetPantryItem(ctx, "1", "000000000000000000000001"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Save the aisle order of the users", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		if _, err := api.store.GetAisleOrder(ctx, "1"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		api.store.SetAisleOrder(ctx, "1", []string{"fruit", "dairy"})
+		api.store.SetAisleOrder(ctx, "1", []string{"dairy", "fruit", "meat"})
+		aisles, err := api.store.GetAisleOrder(ctx, "1")
+		if err != nil || strings.Join(aisles, ",") != "dairy,fruit,meat" {
+			t.Errorf("The aisle order should be replaced: %v %v", aisles, err)
+		}
+		if err := api.store.RemoveAisleOrder(ctx, "1"); err != nil {
+			t.Errorf("Failed to remove the aisle order: %v", err)
+		}
+		if err := api.store.RemoveAisleOrder(ctx, "1"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Remove all the quantities of an ingredient from its recipes", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		for _, recipeId := range []string{"000000000000000000000001", "000000000000000000000002"} {
+			recipe := db.Recipe{IngredientsID: []string{"000000000000000000000001"}}
+			ingredients := []db.Ingredient{
+				{Quantities: []db.Quantity{{Amount: 200, Unit: "g", RecipeID: recipeId}, {Amount: 1, Unit: "i", RecipeID: recipeId}}},
+			}
+			// Only the first recipe keeps an ingredient once the first one is removed
+			if recipeId == "000000000000000000000001" {
+				recipe.IngredientsID = append(recipe.IngredientsID, "000000000000000000000002")
+				ingredients = append(ingredients, db.Ingredient{Quantities: []db.Quantity{{Amount: 3, Unit: "i", RecipeID: recipeId}}})
+			}
+			api.store.AddRecipe(ctx, "1", "1", recipeId, &recipe, &ingredients)
+		}
+		api.store.AddIngredient(ctx, "1", "000000000000000000000001", db.Ingredient{Quantities: []db.Quantity{{Amount: 5, Unit: "g"}}})
+
+		if err := api.store.RemoveIngredient(ctx, "1", "000000000000000000000001", "", true); err != nil {
+			t.Fatalf("Failed to remove the ingredient: %v", err)
+		}
+		if _, err := api.store.GetIngredient(ctx, "1", "000000000000000000000001"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		recipe, err := api.store.GetRecipe(ctx, "1", "000000000000000000000001")
+		if err != nil || len(recipe.IngredientsID) != 1 || recipe.IngredientsID[0] != "000000000000000000000002" {
+			t.Errorf("The ingredient should be removed from the recipe: %v %v", recipe, err)
+		}
+		if _, err := api.store.GetRecipe(ctx, "1", "000000000000000000000002"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("The recipe without ingredient should be removed: %v", err)
+		}
+		if err := api.store.RemoveIngredient(ctx, "1", "000000000000000000000001", "", true); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Record the mutations in the stream of the list", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		recipe := db.Recipe{IngredientsID: []string{"000000000000000000000001", "000000000000000000000002"}}
+		ingredients := []db.Ingredient{
+			{Quantities: []db.Quantity{{Amount: 200, Unit: "g", RecipeID: "000000000000000000000001"}}},
+			{Quantities: []db.Quantity{{Amount: 3, Unit: "i", RecipeID: "000000000000000000000001"}}},
+		}
+		api.store.AddRecipe(ctx, "1", "1", "000000000000000000000001", &recipe, &ingredients)
+		api.store.CheckIngredient(ctx, "1", "000000000000000000000002", "1", true)
+		time.Sleep(2 * time.Millisecond)
+		at := time.Now()
+		time.Sleep(2 * time.Millisecond)
+		api.store.RemoveIngredient(ctx, "1", "000000000000000000000001", "", true)
+		api.store.CompleteTrip(ctx, "1", "1")
+
+		events, err := api.store.GetEvents(ctx, "1", time.Time{})
+		if err != nil || len(events) != 4 || events[0].Type != db.RecipeAdded || events[3].Type != db.TripCompleted {
+			t.Fatalf("Wrong events: %v %v", events, err)
+		}
+		if list, _ := api.store.GetShoppingList(ctx, "1"); len(*list) != 0 {
+			t.Errorf("The list should be empty: %v", list)
+		}
+		list, err := api.store.GetShoppingListAt(ctx, "1", at)
+		if err != nil || len(*list) != 2 || (*list)[0].Quantities[0].Amount != 200 || !(*list)[1].Checked {
+			t.Errorf("The list should be rebuilt as it was: %v %v", list, err)
+		}
+	})
+
+	t.Run("Add the ingredients in one operation", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		testAddIngredients(t, api.store)
+	})
+
+	t.Run("Read the events by their time", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		testEvents(t, api.store)
+	})
+
+	t.Run("Read the long streams by pages", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+
+		for i := 0; i < 1200; i++ {
+			api.store.AddIngredient(ctx, "1", fmt.Sprintf("%024d", i), db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "i"}}})
+		}
+		events, err := api.store.GetEvents(ctx, "1", time.Time{})
+		if err != nil || len(events) != 1200 || events[1199].IngredientID != fmt.Sprintf("%024d", 1199) {
+			t.Errorf("All the events should be read: %d %v", len(events), err)
+		}
+	})
+
+	t.Run("Fail on the events that cannot be replayed", func(t *testing.T) {
+		rdb, pool, resource := tests.InitTestDocker("6379")
+		defer tests.CloseTestDocker(rdb, pool, resource)
+		store := db.NewRedisStore(rdb)
+		ctx := context.Background()
+
+		store.AddIngredient(ctx, "1", "000000000000000000000001", db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "i"}}})
+		rdb.XAdd(ctx, &redis.XAddArgs{Stream: "1:events", Values: map[string]interface{}{"type": "Unknown", "data": `{"type":"Unknown"}`}})
+		if list, err := store.GetShoppingListAt(ctx, "1", time.Now()); err == nil {
+			t.Errorf("The replay should fail: %v", list)
+		}
+	})
+
+	t.Run("Undo and redo the operations of the user", func(t *testing.T) {
+		api, teardownTest := setupTest(t)
+		defer teardownTest(t)
+		ctx := context.Background()
+		user := db.WithUser(ctx, "1")
+
+		api.store.SetPantryItem(ctx, "1", db.PantryItem{ID: "000000000000000000000001", Amount: 50, Unit: "g"})
+		recipe := db.Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ingredients := []db.Ingredient{{Quantities: []db.Quantity{{Amount: 200, Unit: "g", RecipeID: "000000000000000000000001"}}}}
+		api.store.AddRecipe(user, "1", "1", "000000000000000000000001", &recipe, &ingredients)
+		api.store.AddIngredient(user, "1", "000000000000000000000001", db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "kg", RecipeID: "000000000000000000000001"}}})
+		api.store.CheckIngredient(user, "1", "000000000000000000000001", "1", true)
+		trip, _ := api.store.CompleteTrip(user, "1", "1")
+
+		if op, err := api.store.Undo(ctx, "1", "1"); err != nil || op.Type != db.TripCompleted {
+			t.Fatalf("Failed to undo the trip: %v %v", op, err)
+		}
+		if trips, _ := api.store.GetTrips(ctx, "1", 10); len(trips) != 0 {
+			t.Errorf("The trip should be removed: %v", trips)
+		}
+		if _, err := api.store.GetTrip(ctx, "1", trip.ID); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		api.store.Undo(ctx, "1", "1")
+		api.store.Undo(ctx, "1", "1")
+		ingredient, err := api.store.GetIngredient(ctx, "1", "000000000000000000000001")
+		if err != nil || ingredient.Checked || len(ingredient.Quantities) != 1 || ingredient.Quantities[0].Amount != 150 {
+			t.Errorf("The merge should be undone: %v %v", ingredient, err)
+		}
+		api.store.Undo(ctx, "1", "1")
+		if _, err := api.store.GetRecipe(ctx, "1", "000000000000000000000001"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("The recipe should be undone: %v", err)
+		}
+		if items, err := api.store.GetPantryItem(ctx, "1", "000000000000000000000001"); err != nil || items[0].Amount != 50 {
+			t.Errorf("The pantry should be restored: %v %v", items, err)
+		}
+		if _, err := api.store.Undo(ctx, "1", "1"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		for i := 0; i < 4; i++ {
+			if _, err := api.store.Redo(ctx, "1", "1"); err != nil {
+				t.Fatalf("Failed to redo: %v", err)
+			}
+		}
+		if trips, _ := api.store.GetTrips(ctx, "1", 10); len(trips) != 1 || trips[0].ID != trip.ID {
+			t.Errorf("The trip should be redone: %v", trips)
+		}
+		if list, _ := api.store.GetShoppingList(ctx, "1"); len(*list) != 0 {
+			t.Errorf("The list should be empty again: %v", list)
+		}
+		list, err := api.store.GetShoppingListAt(ctx, "1", time.Now())
+		if err != nil || len(*list) != 0 {
+			t.Errorf("The projection should follow the undone operations: %v %v", list, err)
+		}
+	})
+
+	t.Run("Back up and restore the data of a user", func(t *testing.T) {
+		ctx := context.Background()
+		rdb, pool, resource := tests.InitTestDocker("6379")
+		defer tests.CloseTestDocker(rdb, pool, resource)
+		store := db.NewRedisStore(rdb)
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		user := db.WithUser(ctx, "1")
+		primary := db.List{Owner: "1", Primary: true}.Namespace()
+		recipe := db.Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ingredients := []db.Ingredient{{Quantities: []db.Quantity{{Amount: 200, Unit: "g", RecipeID: "000000000000000000000001"}}}}
+		store.AddRecipe(user, primary, "1", "000000000000000000000001", &recipe, &ingredients)
+		store.AddIngredient(user, primary, "000000000000000000000002", db.Ingredient{Quantities: []db.Quantity{{Amount: 3, Unit: "i"}}})
+		store.SetPantryItem(ctx, "1", db.PantryItem{ID: "000000000000000000000003", Amount: 1, Unit: "kg"})
+		party, _ := store.CreateList(ctx, "1", "Party")
+		store.AddIngredient(user, party.Namespace(), "000000000000000000000004", db.Ingredient{Quantities: []db.Quantity{{Amount: 6, Unit: "i"}}})
+		store.SetMember(ctx, "1", party.ID, "2", db.RoleEditor)
+		store.AddIngredient(db.WithUser(ctx, "2"), db.List{Owner: "2", Primary: true}.Namespace(), "000000000000000000000005", db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "l"}}})
+		lists, _ := store.GetLists(ctx, "1")
+		primaryId := lists[slices.IndexFunc(lists, func(l db.List) bool { return l.Primary })].ID
+		list, _ := store.GetShoppingList(ctx, primary)
+
+		backup, err := store.Backup(ctx, "1")
+		if err != nil || backup.Format != db.BackupFormat || backup.Version != db.BackupVersion || backup.SchemaVersion != db.SchemaVersion() || backup.User != "1" {
+			t.Fatalf("Failed to back up the user: %+v %v", backup, err)
+		}
+		keys := make([]string, len(backup.Keys))
+		for i, key := range backup.Keys {
+			keys[i] = key.Key
+		}
+		for _, key := range []string{"user:1:pantry", primary + ":events", primary + ":journal:1", "list:" + primaryId, "list:" + party.ID, "list:" + party.ID + ":members", "list:" + party.ID + ":events"} {
+			if !slices.Contains(keys, key) {
+				t.Errorf("The backup should have the key %s: %v", key, keys)
+			}
+		}
+		for _, key := range keys {
+			if strings.HasPrefix(key, "user:2:") || strings.HasPrefix(key, "schema:") {
+				t.Errorf("The backup of the user should not have the key %s", key)
+			}
+		}
+		content, _ := json.Marshal(backup)
+		backup = new(db.Backup)
+		if err := json.Unmarshal(content, backup); err != nil {
+			t.Fatalf("Failed to decode the backup: %v", err)
+		}
+		full, err := store.Backup(ctx, "")
+		if err != nil || len(full.Keys) <= len(backup.Keys) || !slices.ContainsFunc(full.Keys, func(key db.BackupKey) bool { return key.Key == "user:2:events" }) {
+			t.Errorf("The backup of the dataset should have the keys of all the users: %v", err)
+		}
+
+		// A dry run changes nothing
+		rdb.FlushDB(ctx)
+		report, err := store.Restore(ctx, backup, db.RestoreOptions{Replace: true, DryRun: true})
+		if err != nil || report.Created != len(backup.Keys) {
+			t.Errorf("Unexpected dry run: %+v %v", report, err)
+		}
+		if n, _ := rdb.DBSize(ctx).Result(); n != 0 {
+			t.Errorf("The dry run should not write, got %d keys", n)
+		}
+
+		report, err = store.Restore(ctx, backup, db.RestoreOptions{})
+		if err != nil || report.Created != len(backup.Keys) || report.Updated != 0 {
+			t.Fatalf("Failed to restore the backup: %+v %v", report, err)
+		}
+		restored, err := store.GetShoppingList(ctx, primary)
+		if err != nil || len(*restored) != len(*list) || (*restored)[0].Quantities[0].Amount != (*list)[0].Quantities[0].Amount {
+			t.Errorf("The list should be restored: %v %v", restored, err)
+		}
+		if lists, _ := store.GetLists(ctx, "2"); !slices.ContainsFunc(lists, func(l db.List) bool { return l.ID == party.ID }) {
+			t.Errorf("The shared list should be found by its members: %v", lists)
+		}
+		if items, err := store.GetPantryItem(ctx, "1", "000000000000000000000003"); err != nil || items[0].Amount != 1000 {
+			t.Errorf("The pantry should be restored: %v %v", items, err)
+		}
+		if op, err := store.Undo(ctx, primary, "1"); err != nil || op.Type != db.IngredientAdded {
+			t.Errorf("The journal should be restored: %v %v", op, err)
+		}
+
+		// Merging keeps the data added since, replacing deletes it
+		store.AddIngredient(ctx, primary, "000000000000000000000006", db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "i"}}})
+		report, err = store.Restore(ctx, backup, db.RestoreOptions{})
+		if err != nil || report.Created == 0 || report.Kept == 0 || report.Deleted != 0 {
+			t.Errorf("Unexpected merge: %+v %v", report, err)
+		}
+		if _, err := store.GetIngredient(ctx, primary, "000000000000000000000006"); err != nil {
+			t.Errorf("The merge should keep the new ingredient: %v", err)
+		}
+		report, err = store.Restore(ctx, backup, db.RestoreOptions{Replace: true})
+		if err != nil || report.Deleted == 0 || report.Kept != 0 {
+			t.Errorf("Unexpected replace: %+v %v", report, err)
+		}
+		if _, err := store.GetIngredient(ctx, primary, "000000000000000000000006"); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("The replace should remove the new ingredient: %v", err)
+		}
+		if events, _ := store.GetEvents(ctx, primary, time.Time{}); len(events) != 2 {
+			t.Errorf("The events should be restored as they were: %v", events)
+		}
+
+		// The lists deleted by the replace are removed from the lists of their members
+		trip, _ := store.CreateList(ctx, "1", "Trip")
+		store.SetMember(ctx, "1", trip.ID, "3", db.RoleViewer)
+		store.SetMember(ctx, "1", party.ID, "3", db.RoleViewer)
+		if _, err := store.Restore(ctx, backup, db.RestoreOptions{Replace: true}); err != nil {
+			t.Fatalf("Failed to replace: %v", err)
+		}
+		if ids, _ := rdb.SMembers(ctx, "user:3:lists").Result(); len(ids) != 0 {
+			t.Errorf("The lists left by the member should be removed from their lists: %v", ids)
+		}
+		if ok, _ := rdb.SIsMember(ctx, "user:2:lists", party.ID).Result(); !ok {
+			t.Errorf("The members of the backup should keep the list: %v", party.ID)
+		}
+
+		for _, invalid := range []db.Backup{
+			{Format: "other", Version: 1, SchemaVersion: db.SchemaVersion()},
+			{Format: db.BackupFormat, Version: db.BackupVersion + 1, SchemaVersion: db.SchemaVersion()},
+			{Format: db.BackupFormat, Version: 1, SchemaVersion: db.SchemaVersion() + 1},
+			{Format: db.BackupFormat, Version: 1, SchemaVersion: db.SchemaVersion() - 1, User: "1", Keys: backup.Keys},
+			{Format: db.BackupFormat, Version: 1, SchemaVersion: db.SchemaVersion(), Keys: []db.BackupKey{{Key: "1:x", Type: "string"}}},
+			// The keys out of the scope of the user
+			{Format: db.BackupFormat, Version: 1, SchemaVersion: db.SchemaVersion(), User: "1", Keys: []db.BackupKey{{Key: "user:2:pantry", Type: "hash", Hash: map[string]string{"x": "1"}}}},
+			{Format: db.BackupFormat, Version: 1, SchemaVersion: db.SchemaVersion(), User: "1", Keys: []db.BackupKey{{Key: "list:x:members", Type: "hash", Hash: map[string]string{"2": "editor"}}}},
+			{Format: db.BackupFormat, Version: 1, SchemaVersion: db.SchemaVersion(), User: "2", Keys: []db.BackupKey{{Key: "list:" + party.ID, Type: "hash", Hash: map[string]string{"owner": "2"}}}},
+		} {
+			if _, err := store.Restore(ctx, &invalid, db.RestoreOptions{Replace: true}); !errors.Is(err, db.ErrInvalidBackup) && !errors.Is(err, db.ErrBackupVersion) {
+				t.Errorf("The backup %+v should be rejected: %v", invalid, err)
+			}
+		}
+	})
+
+	t.Run("Migrate the data saved with the previous layouts", func(t *testing.T) {
+		ctx := context.Background()
+		rdb, pool, resource := tests.InitTestDocker("6379")
+		defer tests.CloseTestDocker(rdb, pool, resource)
+		store := db.NewRedisStore(rdb)
+
+		// Ingredients and recipe saved as JSON strings, before the index existed
+		rdb.Set(ctx, "1:ingredient:000000000000000000000001", `[{"amount":1,"unit":"g","recipe_id":""},{"amount":2,"unit":"g","recipe_id":"000000000000000000000001"}]`, 0)
+		rdb.Set(ctx, "1:recipe:000000000000000000000001", `["000000000000000000000002","000000000000000000000001"]`, 0)
+		rdb.Set(ctx, "2:ingredient:000000000000000000000002", `[{"amount":2,"unit":"i","recipe_id":""}]`, 0)
+		rdb.HSet(ctx, "1:pantry", "000000000000000000000003:g", "500")
+		// The keys of the other applications sharing the Redis
+		rdb.Set(ctx, "catalog:cache:flour", "{}", 0)
+		rdb.Set(ctx, "session", "1", 0)
+
+		// Running the migrations twice must give the same result
+		for i := 0; i < 2; i++ {
+			if err := store.Migrate(ctx); err != nil {
+				t.Fatalf("Failed to migrate: %v", err)
+			}
+		}
+
+		version, err := store.GetSchemaVersion(ctx)
+		if err != nil || version != db.SchemaVersion() {
+			t.Errorf("Failed to save the schema version: %v %v", version, err)
+		}
+
+		list, err := store.GetShoppingList(ctx, "user:1")
+		if err != nil || len(*list) != 1 || (*list)[0].ID != "000000000000000000000001" {
+			t.Fatalf("Failed to migrate the ingredient of the first user: %v %v", list, err)
+		}
+		if q := (*list)[0].Quantities; len(q) != 2 || q[0].Amount != 1 || q[1].Amount != 2 || q[1].RecipeID != "000000000000000000000001" {
+			t.Errorf("Failed to migrate the quantities: %v", q)
+		}
+		r, err := store.GetRecipe(ctx, "user:1", "000000000000000000000001")
+		if err != nil || len(r.IngredientsID) != 2 || r.IngredientsID[0] != "000000000000000000000002" || r.CreatedAt.IsZero() {
+			t.Errorf("Failed to migrate the recipe: %v %v", r, err)
+		}
+		list, _ = store.GetShoppingList(ctx, "user:2")
+		if len(*list) != 1 || (*list)[0].Quantities[0].Amount != 2 {
+			t.Errorf("Failed to migrate the ingredient of the second user: %v", list)
+		}
+		if keyType := rdb.Type(ctx, "user:2:ingredient:000000000000000000000002").Val(); keyType != "hash" {
+			t.Errorf("The ingredient should be saved as a hash, got %v", keyType)
+		}
+		if items, err := store.GetPantryItem(ctx, "1", "000000000000000000000003"); err != nil || items[0].Amount != 500 {
+			t.Errorf("The pantry should be moved under the user prefix: %v %v", items, err)
+		}
+		if n, _ := rdb.Exists(ctx, "1:pantry", "1:ingredients", "1:events").Result(); n != 0 {
+			t.Errorf("The keys of the users should not be left without the prefix")
+		}
+		if n, _ := rdb.Exists(ctx, "catalog:cache:flour", "session").Result(); n != 2 {
+			t.Errorf("The keys that are not ours should be left as they are")
+		}
+
+		// The content saved before the events is the start of the projection
+		store.AddIngredient(ctx, "user:1", "000000000000000000000001", db.Ingredient{Quantities: []db.Quantity{{Amount: 3, Unit: "g"}}})
+		list, err = store.GetShoppingListAt(ctx, "user:1", time.Now())
+		if err != nil || len(*list) != 1 || (*list)[0].Quantities[0].Amount != 4 {
+			t.Errorf("The snapshot should be replayed before the events: %v %v", list, err)
+		}
+	})
+
+	t.Run("Resume an interrupted migration", func(t *testing.T) {
+		ctx := context.Background()
+		rdb, pool, resource := tests.InitTestDocker("6379")
+		defer tests.CloseTestDocker(rdb, pool, resource)
+		store := db.NewRedisStore(rdb)
+
+		// The index was built, and the conversion stopped after the first key
+		rdb.Set(ctx, "schema:version", 1, 0)
+		rdb.HSet(ctx, "1:ingredient:000000000000000000000001", "q:g:", "1")
+		rdb.SAdd(ctx, "1:ingredients", "000000000000000000000001", "000000000000000000000002")
+		rdb.Set(ctx, "1:ingredient:000000000000000000000002", `[{"amount":5,"unit":"kg","recipe_id":""}]`, 0)
+
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		list, err := store.GetShoppingList(ctx, "user:1")
+		if err != nil || len(*list) != 2 || (*list)[0].Quantities[0].Amount != 1 || (*list)[1].Quantities[0].Amount != 5000 {
+			t.Errorf("Failed to resume the migration: %v %v", list, err)
+		}
+	})
+
+	t.Run("Wait for the migration of another instance", func(t *testing.T) {
+		ctx := context.Background()
+		rdb, pool, resource := tests.InitTestDocker("6379")
+		defer tests.CloseTestDocker(rdb, pool, resource)
+		store := db.NewRedisStore(rdb)
+
+		rdb.Set(ctx, "schema:migration:lock", "other", time.Minute)
+		done := make(chan error, 1)
+		go func() { done <- store.Migrate(ctx) }()
+
+		select {
+		case err := <-done:
+			t.Fatalf("The migration should wait for the lock of the other instance: %v", err)
+		case <-time.After(time.Second):
+		}
+
+		// The other instance finishes its migration and releases its lock
+		rdb.Set(ctx, "schema:version", db.SchemaVersion(), 0)
+		rdb.Del(ctx, "schema:migration:lock")
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Failed to wait for the migration: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("The migration should stop waiting once the schema is up to date")
+		}
+	})
+
+	t.Run("Release only the migration lock of the instance", func(t *testing.T) {
+		ctx := context.Background()
+		rdb, pool, resource := tests.InitTestDocker("6379")
+		defer tests.CloseTestDocker(rdb, pool, resource)
+		store := db.NewRedisStore(rdb)
+
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		if n, _ := rdb.Exists(ctx, "schema:migration:lock").Result(); n != 0 {
+			t.Errorf("The migration should release its lock")
+		}
+
+		// The schema is up to date, the lock of another instance is left alone
+		rdb.Set(ctx, "schema:migration:lock", "other", time.Minute)
+		if err := store.Migrate(ctx); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		if owner, _ := rdb.Get(ctx, "schema:migration:lock").Result(); owner != "other" {
+			t.Errorf("The lock of another instance should not be released, got %q", owner)
+		}
+	})
+
+}
+
+// testEvents checks that the store reads the events by their time, the same way for all the stores
+func testEvents(t *testing.T, store db.Store) {
+	ctx := context.Background()
+
+	store.AddIngredient(ctx, "1", "000000000000000000000001", db.Ingredient{Quantities: []db.Quantity{{Amount: 1, Unit: "i"}}})
+	time.Sleep(2 * time.Millisecond)
+	store.AddIngredient(ctx, "1", "000000000000000000000002", db.Ingredient{Quantities: []db.Quantity{{Amount: 2, Unit: "i"}}})
+
+	events, err := store.GetEvents(ctx, "1", time.Time{})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Wrong events: %v %v", events, err)
+	}
+	for i, event := range events {
+		if until, _ := store.GetEvents(ctx, "1", event.At); len(until) != i+1 {
+			t.Errorf("The events until the time of the event %d should include it: %v", i, until)
+		}
+		// Within the same millisecond as the event
+		if before, _ := store.GetEvents(ctx, "1", event.At.Add(-time.Nanosecond)); len(before) != i {
+			t.Errorf("The events until before the event %d should not include it: %v", i, before)
+		}
+	}
+	list, err := store.GetShoppingListAt(ctx, "1", events[0].At)
+	if err != nil || len(*list) != 1 || (*list)[0].ID != "000000000000000000000001" {
+		t.Errorf("The list should be rebuilt at the time of the first event: %v %v", list, err)
+	}
+}
+
+func TestEventsWithMemoryStore(t *testing.T) {
+	testEvents(t, db.NewMemoryStore())
+}
+
+// testAddIngredients checks that the store adds all the ingredients or none of them
+func testAddIngredients(t *testing.T, store db.Store) {
+	ctx := db.WithUser(context.Background(), "1")
+
+	ingredients := []db.Ingredient{
+		{ID: "000000000000000000000001", Quantities: []db.Quantity{{Amount: 1, Unit: "kg"}}},
+		{ID: "000000000000000000000002", Quantities: []db.Quantity{{Amount: 2, Unit: "i"}}},
+		{ID: "000000000000000000000001", Quantities: []db.Quantity{{Amount: 500, Unit: "g"}}},
+	}
+	if err := store.AddIngredients(ctx, "1", ingredients); err != nil {
+		t.Fatalf("Failed to add the ingredients: %v", err)
+	}
+	list, _ := store.GetShoppingList(ctx, "1")
+	if len(*list) != 2 || (*list)[0].Quantities[0].Amount != 1500 {
+		t.Errorf("The quantities of the same ingredient should be merged: %v", list)
+	}
+
+	// An ingredient of a recipe that is not in the list fails the whole operation
+	ingredients = []db.Ingredient{
+		{ID: "000000000000000000000003", Quantities: []db.Quantity{{Amount: 1, Unit: "i"}}},
+		{ID: "000000000000000000000004", Quantities: []db.Quantity{{Amount: 1, Unit: "i", RecipeID: "000000000000000000000001"}}},
+	}
+	if err := store.AddIngredients(ctx, "1", ingredients); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if list, _ := store.GetShoppingList(ctx, "1"); len(*list) != 2 {
+		t.Errorf("The list should not change: %v", list)
+	}
+
+	// The ingredients are undone at once
+	if _, err := store.Undo(ctx, "1", "1"); err != nil {
+		t.Fatalf("Failed to undo: %v", err)
+	}
+	if list, _ := store.GetShoppingList(ctx, "1"); len(*list) != 0 {
+		t.Errorf("The list should be empty: %v", list)
+	}
+}
+
+func TestAddIngredientsWithMemoryStore(t *testing.T) {
+	testAddIngredients(t, db.NewMemoryStore())
 }
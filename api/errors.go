@@ -63,6 +63,46 @@ func NewUnauthorizedError(err error) error {
 	return echo.NewHTTPError(http.StatusUnauthorized, jsonError)
 }
 
+func NewForbiddenError(err error) error {
+	jsonError := EchoError{
+		Code:     http.StatusForbidden,
+		Message:  "Forbidden Error",
+		Error:    err.Error(),
+		IssuedAt: time.Now(),
+	}
+	return echo.NewHTTPError(http.StatusForbidden, jsonError)
+}
+
+func NewNotAcceptableError(err error) error {
+	jsonError := EchoError{
+		Code:     http.StatusNotAcceptable,
+		Message:  "Not Acceptable Error",
+		Error:    err.Error(),
+		IssuedAt: time.Now(),
+	}
+	return echo.NewHTTPError(http.StatusNotAcceptable, jsonError)
+}
+
+func NewBadGatewayError(err error) error {
+	jsonError := EchoError{
+		Code:     http.StatusBadGateway,
+		Message:  "Bad Gateway Error",
+		Error:    err.Error(),
+		IssuedAt: time.Now(),
+	}
+	return echo.NewHTTPError(http.StatusBadGateway, jsonError)
+}
+
+func NewUnprocessableEntityError(err error) error {
+	jsonError := EchoError{
+		Code:     http.StatusUnprocessableEntity,
+		Message:  "Unprocessable Entity Error",
+		Error:    err.Error(),
+		IssuedAt: time.Now(),
+	}
+	return echo.NewHTTPError(http.StatusUnprocessableEntity, jsonError)
+}
+
 func NewBadRequestError(err error) error {
 	jsonError := EchoError{
 		Code:     http.StatusBadRequest,
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+	"shopping-list/db"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (api *ApiHandler) getEvents(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getEvents")
+	defer span.End()
+	l := logger.WithField("request", "getEvents").WithContext(ctx)
+
+	params := new(EventsRequest)
+	if err := c.Bind(params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+
+	list, err := api.getList(ctx, userID(c), c.Param("listId"), db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	events, err := api.store.GetEvents(ctx, list.Namespace(), params.Until)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the events")
+		return NewStoreError(err)
+	}
+	span.SetAttributes(attribute.Int("events.count", len(events)))
+	return c.JSON(http.StatusOK, events)
+}
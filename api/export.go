@@ -0,0 +1,362 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"shopping-list/db"
+	"shopping-list/services"
+	"shopping-list/units"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Export formats of the media types accepted by the clients
+var exportMediaTypes = map[string]string{
+	"text/csv":         FormatCSV,
+	"text/markdown":    FormatMarkdown,
+	"text/x-markdown":  FormatMarkdown,
+	"text/plain":       FormatText,
+	"text/*":           FormatText,
+	"application/json": FormatJSON,
+	"application/*":    FormatJSON,
+	"*/*":              FormatJSON,
+}
+
+var exportContentTypes = map[string]string{
+	FormatCSV:      "text/csv; charset=UTF-8",
+	FormatMarkdown: "text/markdown; charset=UTF-8",
+	FormatText:     echo.MIMETextPlainCharsetUTF8,
+	FormatJSON:     echo.MIMEApplicationJSONCharsetUTF8,
+}
+
+// Title of the section of the ingredients added without recipe when grouping by recipe
+const noRecipeTitle = "Other"
+
+var errNotAcceptable = errors.New("none of the accepted media types is an export format: text/csv, text/markdown, text/plain, application/json")
+
+func (api *ApiHandler) exportShoppingList(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "exportShoppingList")
+	defer span.End()
+	l := logger.WithField("request", "exportShoppingList").WithContext(ctx)
+
+	params := new(ExportRequest)
+	if err := c.Bind(params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(params); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+	format := params.Format
+	if format == "" {
+		var ok bool
+		if format, ok = negotiateFormat(c.Request().Header.Get(echo.HeaderAccept)); !ok {
+			FailOnError(l, errNotAcceptable, "Negotiation of the format failed")
+			return NewNotAcceptableError(errNotAcceptable)
+		}
+	}
+	span.SetAttributes(attribute.String("format", format))
+
+	list, err := api.getList(ctx, userID(c), c.Param("listId"), db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	ingredients, err := api.store.GetShoppingList(ctx, list.Namespace())
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get shopping list")
+		return NewInternalServerError(err)
+	}
+	items := filterShoppingList(*ingredients, &ShoppingListRequest{Checked: params.Checked})
+	span.SetAttributes(attribute.Int("ingredients.count", len(items)))
+
+	// The ingredients missing from the catalog, or all of them when it is unavailable, are named by their ID
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	catalog, err := api.catalog.GetIngredients(ctx, ids)
+	if err != nil {
+		span.SetAttributes(attribute.String("catalog.err", err.Error()))
+		WarnOnError(l, err, "Failed to get the ingredients from the catalog")
+	}
+	expanded := NewShoppingListItems(items, catalog)
+
+	var sections []ExportSection
+	switch params.GroupBy {
+	case GroupByRecipe:
+		sections = api.groupByRecipe(ctx, expanded)
+	case GroupByType:
+		order, err := api.aisleOrder(ctx, userID(c))
+		if err != nil {
+			span.SetAttributes(attribute.String("err", err.Error()))
+			FailOnError(l, err, "Failed to get the aisle order")
+			return NewStoreError(err)
+		}
+		for _, section := range api.groupByType(expanded, order.Aisles) {
+			sections = append(sections, ExportSection{Title: section.Type, Items: NewExportItems(section.Items)})
+		}
+	default:
+		sections = []ExportSection{{Items: NewExportItems(expanded)}}
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="shopping-list.%s"`, format))
+	if format == FormatJSON {
+		if params.GroupBy == "" {
+			return c.JSON(http.StatusOK, sections[0].Items)
+		}
+		return c.JSON(http.StatusOK, sections)
+	}
+	var content []byte
+	switch format {
+	case FormatCSV:
+		content, err = exportCSV(sections)
+	case FormatMarkdown:
+		content = exportText(list.Name, sections, true)
+	case FormatText:
+		content = exportText(list.Name, sections, false)
+	}
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to export the shopping list")
+		return NewInternalServerError(err)
+	}
+	return c.Blob(http.StatusOK, exportContentTypes[format], content)
+}
+
+// negotiateFormat returns the export format of the media type of the Accept header with the highest quality,
+// JSON when the header is empty. It returns false when no accepted media type is an export format.
+func negotiateFormat(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, true
+	}
+	type mediaRange struct {
+		format  string
+		quality float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		format, ok := exportMediaTypes[strings.ToLower(strings.TrimSpace(params[0]))]
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		for _, param := range params[1:] {
+			if value, found := strings.CutPrefix(strings.TrimSpace(param), "q="); found {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{format: format, quality: quality})
+		}
+	}
+	if len(ranges) == 0 {
+		return "", false
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+	return ranges[0].format, true
+}
+
+func NewExportItems(items []ShoppingListItem) []ExportItem {
+	exported := make([]ExportItem, len(items))
+	for i, item := range items {
+		exported[i] = newExportItem(item, item.Quantities)
+	}
+	return exported
+}
+
+// newExportItem sums the quantities of the item by unit, whatever their recipe
+func newExportItem(item ShoppingListItem, quantities []db.Quantity) ExportItem {
+	exported := ExportItem{ID: item.ID, Name: item.ID, Quantities: make([]db.Quantity, 0, len(quantities)), Checked: item.Checked}
+	if item.Catalog != nil && item.Catalog.Name != "" {
+		exported.Name = item.Catalog.Name
+	}
+	for _, quantity := range quantities {
+		i := slices.IndexFunc(exported.Quantities, func(saved db.Quantity) bool { return saved.Unit == quantity.Unit })
+		if i < 0 {
+			exported.Quantities = append(exported.Quantities, db.Quantity{Amount: quantity.Amount, Unit: quantity.Unit})
+		} else {
+			exported.Quantities[i].Amount += quantity.Amount
+		}
+	}
+	formatted := make([]string, len(exported.Quantities))
+	for i, quantity := range exported.Quantities {
+		formatted[i] = units.Format(quantity.Amount, quantity.Unit)
+	}
+	exported.Quantity = strings.Join(formatted, " + ")
+	return exported
+}
+
+// groupByRecipe puts the items in a section per recipe, with the quantities of the recipe only. The sections are
+// titled with the name of the recipe in the Recipe MS, or its ID when unknown, and ordered by title.
+// The quantities added without recipe are in the last section.
+func (api *ApiHandler) groupByRecipe(ctx context.Context, items []ShoppingListItem) []ExportSection {
+	byRecipe := make(map[string][]ExportItem)
+	for _, item := range items {
+		quantities := make(map[string][]db.Quantity)
+		recipeIds := make([]string, 0)
+		for _, quantity := range item.Quantities {
+			if _, ok := quantities[quantity.RecipeID]; !ok {
+				recipeIds = append(recipeIds, quantity.RecipeID)
+			}
+			quantities[quantity.RecipeID] = append(quantities[quantity.RecipeID], quantity)
+		}
+		for _, recipeId := range recipeIds {
+			byRecipe[recipeId] = append(byRecipe[recipeId], newExportItem(item, quantities[recipeId]))
+		}
+	}
+
+	titles := api.recipeNames(ctx, byRecipe)
+	sections := make([]ExportSection, 0, len(byRecipe))
+	for recipeId, recipeItems := range byRecipe {
+		if recipeId != "" {
+			sections = append(sections, ExportSection{Title: titles[recipeId], Items: recipeItems})
+		}
+	}
+	sort.Slice(sections, func(i, j int) bool {
+		return sections[i].Title < sections[j].Title
+	})
+	if len(byRecipe[""]) > 0 {
+		sections = append(sections, ExportSection{Title: noRecipeTitle, Items: byRecipe[""]})
+	}
+	return sections
+}
+
+// recipeNames returns the names of the recipes in the Recipe MS, by ID. The recipes unknown by the Recipe MS,
+// or all of them after its first failure, are named by their ID.
+func (api *ApiHandler) recipeNames(ctx context.Context, recipes map[string][]ExportItem) map[string]string {
+	names := make(map[string]string, len(recipes))
+	available := true
+	for recipeId := range recipes {
+		names[recipeId] = recipeId
+		if recipeId == "" || !available {
+			continue
+		}
+		recipe, err := api.recipes.GetRecipe(ctx, recipeId)
+		if err != nil {
+			available = errors.Is(err, services.ErrNotFound)
+			continue
+		}
+		if recipe.Name != "" {
+			names[recipeId] = recipe.Name
+		}
+	}
+	return names
+}
+
+// exportCSV writes a row per ingredient, with the section of the ingredient when grouped.
+// The csv writer quotes the fields with commas, quotes or line breaks, and the fields that a spreadsheet would
+// read as a formula are escaped, see escapeCell.
+func exportCSV(sections []ExportSection) ([]byte, error) {
+	var buffer bytes.Buffer
+	w := csv.NewWriter(&buffer)
+	if err := w.Write([]string{"section", "id", "name", "quantity", "checked"}); err != nil {
+		return nil, err
+	}
+	for _, section := range sections {
+		for _, item := range section.Items {
+			row := []string{escapeCell(section.Title), escapeCell(item.ID), escapeCell(item.Name), escapeCell(item.Quantity), strconv.FormatBool(item.Checked)}
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// The first characters of the cells that a spreadsheet reads as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// escapeCell prefixes with a quote the cell that a spreadsheet would read as a formula, the quote is not displayed
+func escapeCell(cell string) string {
+	if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeCell removes the quote added by escapeCell
+func unescapeCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// Line breaks in the names would start a new item of the list
+var lineEscaper = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ")
+
+// Characters of the names that Markdown would read as formatting: emphasis, links, tables, headings or HTML
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\", "`", "\\`", "*", "\\*", "_", "\\_", "[", "\\[", "]", "\\]",
+	"|", "\\|", "<", "\\<", ">", "\\>", "#", "\\#",
+	"\r\n", " ", "\n", " ", "\r", " ",
+)
+
+// escapeText makes a name of the list written as is on a line of the export
+func escapeText(text string, markdown bool) string {
+	if markdown {
+		return markdownEscaper.Replace(text)
+	}
+	return lineEscaper.Replace(text)
+}
+
+// exportText writes the list as a check list to print, or as a Markdown task list
+func exportText(title string, sections []ExportSection, markdown bool) []byte {
+	if title == "" {
+		title = "Shopping list"
+	}
+	title = escapeText(title, markdown)
+	var buffer bytes.Buffer
+	if markdown {
+		fmt.Fprintf(&buffer, "# %s\n", title)
+	} else {
+		fmt.Fprintf(&buffer, "%s\n%s\n", title, strings.Repeat("=", len([]rune(title))))
+	}
+	for _, section := range sections {
+		buffer.WriteString("\n")
+		if section.Title != "" {
+			if markdown {
+				fmt.Fprintf(&buffer, "## %s\n\n", escapeText(section.Title, true))
+			} else {
+				fmt.Fprintf(&buffer, "%s\n", escapeText(section.Title, false))
+			}
+		}
+		for _, item := range section.Items {
+			box := "[ ]"
+			if item.Checked {
+				box = "[x]"
+			}
+			if markdown {
+				box = "- " + box
+			}
+			line := fmt.Sprintf("%s %s", box, escapeText(item.Name, markdown))
+			if item.Quantity != "" {
+				line += ": " + item.Quantity
+			}
+			buffer.WriteString(line + "\n")
+		}
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"shopping-list/db"
+	"shopping-list/parser"
+	"shopping-list/services"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Limits of the body of an import
+const (
+	MaxImportSize  = 1 << 20
+	MaxImportLines = 500
+)
+
+var (
+	errImportTooLarge     = fmt.Errorf("the import is limited to %d bytes and %d lines", MaxImportSize, MaxImportLines)
+	errUnknownIngredient  = errors.New("the ingredient is not in the catalog")
+	errCatalogUnavailable = errors.New("the catalog is unavailable to find the ingredient")
+	// The bullets and the check boxes of the exported lists
+	lineBullet = regexp.MustCompile(`^(?:[-*]\s+)?(?:\[[ xX]\]\s+)?`)
+)
+
+func (api *ApiHandler) importShoppingList(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "importShoppingList")
+	defer span.End()
+	l := logger.WithField("request", "importShoppingList").WithContext(ctx)
+
+	params := new(ImportRequest)
+	// The body is the content to import, only the query parameters are bound
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(params); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+	format := params.Format
+	if format == "" {
+		format = ImportText
+		if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "text/csv") {
+			format = ImportCSV
+		}
+	}
+	content, err := io.ReadAll(io.LimitReader(c.Request().Body, MaxImportSize+1))
+	if err != nil {
+		FailOnError(l, err, "Reading the body failed")
+		return NewBadRequestError(err)
+	}
+	if len(content) > MaxImportSize {
+		FailOnError(l, errImportTooLarge, "The import is too large")
+		return NewBadRequestError(errImportTooLarge)
+	}
+
+	list, err := api.getList(ctx, userID(c), c.Param("listId"), db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+
+	var items []ImportedItem
+	var unparsed []UnparsedLine
+	if format == ImportCSV {
+		items, unparsed, err = parseCSV(content)
+	} else {
+		items, unparsed, err = parseText(content)
+	}
+	if err != nil {
+		FailOnError(l, err, "Parsing the import failed")
+		return NewBadRequestError(err)
+	}
+	items, unresolved := api.resolveNames(ctx, l, items)
+
+	response := ImportResponse{Added: make([]ImportedItem, 0, len(items)), Unparsed: append(unparsed, unresolved...)}
+	ingredients := make([]db.Ingredient, 0, len(items))
+	for _, item := range items {
+		if err := c.Validate(&item.AddIngredientRequest); err != nil {
+			response.Unparsed = append(response.Unparsed, UnparsedLine{Line: item.Line, Text: item.Name, Error: err.Error()})
+			continue
+		}
+		ingredient := NewIngredient(&item.AddIngredientRequest, "")
+		ingredient.ID = item.ID
+		ingredients = append(ingredients, *ingredient)
+		response.Added = append(response.Added, item)
+	}
+	// The lines are added in one operation, undone at once
+	if len(ingredients) > 0 {
+		if err := api.store.AddIngredients(ctx, list.Namespace(), ingredients); err != nil {
+			span.SetAttributes(attribute.String("err", err.Error()))
+			FailOnError(l, err, "Failed to add the ingredients")
+			return NewStoreError(err)
+		}
+	}
+	slices.SortStableFunc(response.Unparsed, func(a, b UnparsedLine) int {
+		return a.Line - b.Line
+	})
+	span.SetAttributes(attribute.Int("ingredients.count", len(response.Added)), attribute.Int("unparsed.count", len(response.Unparsed)))
+	l.WithFields(logrus.Fields{
+		"added":    len(response.Added),
+		"unparsed": len(response.Unparsed),
+	}).Info("Imported the shopping list")
+	return c.JSON(http.StatusOK, response)
+}
+
+// resolveNames sets the catalog ID of the items named by the catalog. The items unknown by the catalog, or all of
+// them after the first failure of the Catalog MS, are left out and returned as unparsed lines.
+func (api *ApiHandler) resolveNames(ctx context.Context, l *logrus.Entry, items []ImportedItem) ([]ImportedItem, []UnparsedLine) {
+	resolved := make([]ImportedItem, 0, len(items))
+	unresolved := make([]UnparsedLine, 0)
+	var failure error
+	// The quantities of a line share its name, the line is reported once
+	report := func(item ImportedItem, err error) {
+		if n := len(unresolved); n == 0 || unresolved[n-1].Line != item.Line || unresolved[n-1].Text != item.Name {
+			unresolved = append(unresolved, UnparsedLine{Line: item.Line, Text: item.Name, Error: err.Error()})
+		}
+	}
+	for _, item := range items {
+		if item.Resolved {
+			resolved = append(resolved, item)
+			continue
+		}
+		if failure != nil {
+			report(item, failure)
+			continue
+		}
+		ingredient, err := api.catalog.FindIngredient(ctx, item.Name)
+		if errors.Is(err, services.ErrNotFound) {
+			report(item, errUnknownIngredient)
+			continue
+		}
+		if err != nil {
+			WarnOnError(l, err, "Failed to find the ingredients in the catalog")
+			failure = errCatalogUnavailable
+			report(item, failure)
+			continue
+		}
+		item.ID, item.Resolved = ingredient.ID, true
+		resolved = append(resolved, item)
+	}
+	return resolved, unresolved
+}
+
+// parseText parses a quantity of an ingredient per line: 2 kg potatoes, 1 1/2 cups milk, 2-3 onions, a pinch
+// of salt, or the lines of the exports, [ ] Flour: 1.5 kg. The blank lines, the titles and the headings are skipped.
+func parseText(content []byte) ([]ImportedItem, []UnparsedLine, error) {
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if len(lines) > MaxImportLines {
+		return nil, nil, errImportTooLarge
+	}
+	items := make([]ImportedItem, 0, len(lines))
+	unparsed := make([]UnparsedLine, 0)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if skipLine(line) {
+			continue
+		}
+		parsed, err := parseLine(line)
+		if err != nil {
+			unparsed = append(unparsed, UnparsedLine{Line: i + 1, Text: line, Error: err.Error()})
+			continue
+		}
+		for _, item := range parsed {
+			item.Line = i + 1
+			items = append(items, item)
+		}
+	}
+	return items, unparsed, nil
+}
+
+// skipLine tells if the line has no ingredient: a blank line, a heading or the underline of a title
+func skipLine(line string) bool {
+	return line == "" || strings.HasPrefix(line, "#") || strings.Trim(line, "=-") == ""
+}
+
+// parseLine parses the quantities of the ingredient of the line. The line is read as a line of the exports,
+// name: quantities, only when the text after the colon is quantities: 2 kg potatoes: organic is a plain line.
+func parseLine(line string) ([]ImportedItem, error) {
+	line = lineBullet.ReplaceAllString(line, "")
+	if name, quantity, found := strings.Cut(line, ":"); found {
+		if items, err := parseQuantities(name, quantity); err == nil {
+			return items, nil
+		}
+	}
+	parsed, err := parser.Parse(line)
+	if err != nil {
+		return nil, err
+	}
+	return []ImportedItem{newImportedItem(parsed.Name, parsed.Quantity)}, nil
+}
+
+// parseQuantities parses the quantities of the exports, summed by unit: 1.5 kg + 2
+func parseQuantities(name string, quantities string) ([]ImportedItem, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, parser.ErrNoName
+	}
+	items := make([]ImportedItem, 0)
+	for _, text := range strings.Split(quantities, "+") {
+		quantity, err := parser.ParseQuantity(text)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, newImportedItem(name, quantity))
+	}
+	return items, nil
+}
+
+// newImportedItem adds the upper bound of the range of amounts, to buy enough
+func newImportedItem(name string, quantity parser.Quantity) ImportedItem {
+	amount := max(quantity.Amount, quantity.MaxAmount)
+	return ImportedItem{
+		Name:                 name,
+		AddIngredientRequest: AddIngredientRequest{Quantity: Quantity{Amount: amount, Unit: quantity.Unit}},
+	}
+}
+
+// parseRecords parses the rows of a CSV without header as lines of text, numbered by row. The fields are joined
+// on a single line, a quoted field may span several lines of the file.
+func parseRecords(records [][]string) ([]ImportedItem, []UnparsedLine, error) {
+	items := make([]ImportedItem, 0, len(records))
+	unparsed := make([]UnparsedLine, 0)
+	for i, record := range records {
+		line := strings.Join(strings.Fields(strings.Join(record, " ")), " ")
+		if skipLine(line) {
+			continue
+		}
+		parsed, err := parseLine(line)
+		if err != nil {
+			unparsed = append(unparsed, UnparsedLine{Line: i + 1, Text: line, Error: err.Error()})
+			continue
+		}
+		for _, item := range parsed {
+			item.Line = i + 1
+			items = append(items, item)
+		}
+	}
+	return items, unparsed, nil
+}
+
+// parseCSV parses the rows of the CSV. With a header naming the columns id or name, and quantity or amount and unit,
+// like the CSV exports, a row is a quantity of the ingredient. Without header, a row is parsed as a line of text.
+func parseCSV(content []byte) ([]ImportedItem, []UnparsedLine, error) {
+	reader := csv.NewReader(strings.NewReader(string(content)))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) > MaxImportLines {
+		return nil, nil, errImportTooLarge
+	}
+	if len(records) == 0 {
+		return nil, nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, column := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	_, hasID := columns["id"]
+	_, hasName := columns["name"]
+	if !hasID && !hasName {
+		return parseRecords(records)
+	}
+
+	// The cells escaped by the CSV exports are read back as they were
+	field := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return unescapeCell(strings.TrimSpace(record[i]))
+		}
+		return ""
+	}
+	items := make([]ImportedItem, 0, len(records)-1)
+	unparsed := make([]UnparsedLine, 0)
+	for i, record := range records[1:] {
+		// The rows are numbered from the header
+		line := i + 2
+		id, name := field(record, "id"), field(record, "name")
+		if name == "" {
+			name = id
+		}
+		quantity := field(record, "quantity")
+		if quantity == "" {
+			quantity = strings.TrimSpace(field(record, "amount") + " " + field(record, "unit"))
+		}
+		parsed, err := parseQuantities(name, quantity)
+		if err != nil {
+			unparsed = append(unparsed, UnparsedLine{Line: line, Text: strings.Join(record, ","), Error: err.Error()})
+			continue
+		}
+		for _, item := range parsed {
+			item.Line = line
+			if id != "" {
+				item.ID, item.Resolved = id, true
+			}
+			items = append(items, item)
+		}
+	}
+	return items, unparsed, nil
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shopping-list/db"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (api *ApiHandler) undo(c echo.Context) error {
+	return api.revertOperations(c, "undo", api.store.Undo)
+}
+
+func (api *ApiHandler) redo(c echo.Context) error {
+	return api.revertOperations(c, "redo", api.store.Redo)
+}
+
+// revertOperations undoes or redoes the last operations of the user on the list. It stops at the first operation
+// that cannot be reverted, its error is returned only when no operation was reverted.
+func (api *ApiHandler) revertOperations(c echo.Context, name string, revert func(ctx context.Context, ns string, userId string) (*db.Operation, error)) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), name)
+	defer span.End()
+	l := logger.WithField("request", name).WithContext(ctx)
+
+	params := new(JournalRequest)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(params); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+	if params.Steps == 0 {
+		params.Steps = 1
+	}
+
+	userId := userID(c)
+	list, err := api.getList(ctx, userId, c.Param("listId"), db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	operations := make([]*db.Operation, 0, params.Steps)
+	for len(operations) < params.Steps {
+		op, err := revert(ctx, list.Namespace(), userId)
+		if err != nil {
+			if len(operations) > 0 && (errors.Is(err, db.ErrNotFound) || errors.Is(err, db.ErrJournalConflict)) {
+				break
+			}
+			span.SetAttributes(attribute.String("err", err.Error()))
+			FailOnError(l, err, "Failed to "+name+" the operation")
+			return NewStoreError(err)
+		}
+		operations = append(operations, op)
+	}
+	span.SetAttributes(attribute.Int("operations.count", len(operations)))
+	l.WithFields(logrus.Fields{
+		"listId":     list.ID,
+		"operations": len(operations),
+	}).Info("Reverted the operations")
+	return c.JSON(http.StatusOK, NewOperationResponses(operations))
+}
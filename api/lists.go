@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"shopping-list/db"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// getList returns the list when the role of the user allows the needed role, or its primary list when listId is empty
+func (api *ApiHandler) getList(ctx context.Context, userId string, listId string, need db.Role) (*db.List, error) {
+	if listId == "" {
+		return api.store.GetPrimaryList(ctx, userId)
+	}
+	return api.store.AuthorizeList(ctx, userId, listId, need)
+}
+
+// NewStoreError converts the errors of the store to the HTTP errors
+func NewStoreError(err error) error {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		return NewNotFoundError(err)
+	case errors.Is(err, db.ErrForbidden):
+		return NewForbiddenError(err)
+	case errors.Is(err, db.ErrOwnerRole):
+		return NewBadRequestError(err)
+	case errors.Is(err, db.ErrPrimaryList), errors.Is(err, db.ErrEmptyTrip), errors.Is(err, db.ErrJournalConflict):
+		return NewConflictError(err)
+	default:
+		return NewInternalServerError(err)
+	}
+}
+
+func (api *ApiHandler) getLists(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getLists")
+	defer span.End()
+	l := logger.WithField("request", "getLists").WithContext(ctx)
+
+	lists, err := api.store.GetLists(ctx, userID(c))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the lists")
+		return NewStoreError(err)
+	}
+	span.SetAttributes(attribute.Int("lists.count", len(lists)))
+	return c.JSON(http.StatusOK, lists)
+}
+
+func (api *ApiHandler) createList(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "createList")
+	defer span.End()
+	l := logger.WithField("request", "createList").WithContext(ctx)
+
+	request := new(ListRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding list failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	list, err := api.store.CreateList(ctx, userID(c), request.Name)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to create the list")
+		return NewStoreError(err)
+	}
+	l.WithField("listId", list.ID).Info("List created")
+	return c.JSON(http.StatusCreated, list)
+}
+
+func (api *ApiHandler) renameList(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "renameList")
+	defer span.End()
+	l := logger.WithField("request", "renameList").WithContext(ctx)
+
+	request := new(ListRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding list failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	list, err := api.store.RenameList(ctx, userID(c), c.Param("listId"), request.Name)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to rename the list")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+func (api *ApiHandler) deleteList(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "deleteList")
+	defer span.End()
+	l := logger.WithField("request", "deleteList").WithContext(ctx)
+
+	listId := c.Param("listId")
+	if err := api.store.DeleteList(ctx, userID(c), listId); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to delete the list")
+		return NewStoreError(err)
+	}
+	l.WithField("listId", listId).Info("List deleted")
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *ApiHandler) getMembers(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getMembers")
+	defer span.End()
+	l := logger.WithField("request", "getMembers").WithContext(ctx)
+
+	members, err := api.store.GetMembers(ctx, userID(c), c.Param("listId"))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the members")
+		return NewStoreError(err)
+	}
+	span.SetAttributes(attribute.Int("members.count", len(members)))
+	return c.JSON(http.StatusOK, members)
+}
+
+func (api *ApiHandler) setMember(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "setMember")
+	defer span.End()
+	l := logger.WithField("request", "setMember").WithContext(ctx)
+
+	request := new(MemberRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding member failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	listId := c.Param("listId")
+	if err := api.store.SetMember(ctx, userID(c), listId, request.UserID, db.Role(request.Role)); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to set the member")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"listId":   listId,
+		"memberId": request.UserID,
+		"role":     request.Role,
+	}).Info("Member set")
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *ApiHandler) removeMember(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "removeMember")
+	defer span.End()
+	l := logger.WithField("request", "removeMember").WithContext(ctx)
+
+	listId, memberId := c.Param("listId"), c.Param("userId")
+	if err := api.store.RemoveMember(ctx, userID(c), listId, memberId); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to remove the member")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"listId":   listId,
+		"memberId": memberId,
+	}).Info("Member removed")
+	return c.NoContent(http.StatusNoContent)
+}
@@ -122,12 +122,12 @@ func (api *ApiHandler) consumeAddIngredientMessage(ctx context.Context) {
 func (api *ApiHandler) processAddIngredientMessage(ctx context.Context, l *logrus.Entry, msg amqp.Delivery) error {
 	ctx, span := api.tracer.Start(ctx, "processAddIngredientMessage")
 	defer span.End()
-	
+
 	l = l.WithContext(ctx).WithField("function", "processAddIngredientMessage")
 	l.Info("Processing message")
 	ingredient := new(messages.AddIngredientMessage)
 	err := json.Unmarshal(msg.Body, ingredient)
-	
+
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "Failed to unmarshal the message")
@@ -152,8 +152,16 @@ func (api *ApiHandler) processAddIngredientMessage(ctx context.Context, l *logru
 		Quantities: quantities,
 	}
 
+	list, err := api.getList(ctx, ingredient.UserID, ingredient.ListID, db.RoleEditor)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "Failed to get the list")
+		l.WithError(err).WithField("listId", ingredient.ListID).Error("Failed to get the list")
+		return err
+	}
+
 	addCtx, addSpan := api.tracer.Start(ctx, "AddIngredientDB")
-	ingInserted, err := db.AddIngredient(api.rdb, ingredient.UserID, ingredient.ID, ingredientDb)
+	ingInserted, _, err := api.store.AddIngredient(addCtx, list.Namespace(), ingredient.ID, ingredientDb)
 	l = l.WithContext(addCtx).WithField("ingredientId", ingredient.ID)
 	defer addSpan.End()
 	if err != nil {
@@ -166,6 +174,7 @@ func (api *ApiHandler) processAddIngredientMessage(ctx context.Context, l *logru
 	l.WithFields(logrus.Fields{
 		"ingredientId": ingInserted.ID,
 		"userId":       ingredient.UserID,
+		"listId":       list.ID,
 		"quantites":    quantities,
 	}).Info("Ingredient added to the shopping list")
 
@@ -218,17 +227,23 @@ func (api *ApiHandler) consumesMessages() {
 			l.WithField("message", string(d.Body)).WithError(err).Error("Failed to validate the message")
 			break
 		}
-		recipeDb, ingredientsDb := NewRecipe(recipe)
+		// The user is optional in the HTTP requests, the messages must name it
+		if recipe.UserID == "" {
+			l.WithField("message", string(d.Body)).WithError(db.ErrInvalidUserID).Error("Failed to validate the message")
+			continue
+		}
 		l.WithFields(logrus.Fields{
 			"recipeId":         recipe.ID,
 			"recipeUserId":     recipe.UserID,
 			"ingredientsCount": len(recipe.Ingredients),
 		}).Info("Received a message")
 
-		l.WithField("ingredients", ingredientsDb).Debug("Creating shopping list with list of ingredients")
-		err = db.AddRecipe(api.rdb, recipe.UserID, recipe.ID, recipeDb, ingredientsDb)
+		l.WithField("ingredients", recipe.Ingredients).Debug("Creating shopping list with list of ingredients")
+		deductions, err := api.addRecipeToShoppingList(context.Background(), recipe.UserID, recipe)
 		if err != nil {
 			l.WithError(err).Error("Failed to insert the recipe")
+			continue
 		}
+		l.WithField("deductions", deductions).Debug("Ingredients taken from the pantry")
 	}
 }
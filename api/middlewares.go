@@ -1 +1,164 @@
 package api
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"shopping-list/configuration"
+	"shopping-list/db"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// UserIDFromContext returns the user authenticated by the middleware, empty when there is none.
+// The operations of the store made in this context are recorded in the journal of the user.
+func UserIDFromContext(ctx context.Context) string {
+	return db.UserFromContext(ctx)
+}
+
+// userID returns the user making the request
+func userID(c echo.Context) string {
+	return UserIDFromContext(c.Request().Context())
+}
+
+// jwks is a JSON Web Key Set, only the RSA and the symmetric keys are used
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		// Modulus and exponent of the RSA keys
+		N string `json:"n"`
+		E string `json:"e"`
+		// Value of the symmetric keys
+		K string `json:"k"`
+	} `json:"keys"`
+}
+
+// keySet holds the keys verifying the tokens, by kid
+type keySet struct {
+	secret     []byte
+	hmacKeys   map[string][]byte
+	publicKeys map[string]*rsa.PublicKey
+}
+
+// loadJWKS reads the RSA and the symmetric keys of the JWKS file
+func (k *keySet) loadJWKS(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set := new(jwks)
+	if err := json.Unmarshal(content, set); err != nil {
+		return err
+	}
+	for _, key := range set.Keys {
+		switch key.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return fmt.Errorf("invalid modulus of key %q: %w", key.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return fmt.Errorf("invalid exponent of key %q: %w", key.Kid, err)
+			}
+			k.publicKeys[key.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return fmt.Errorf("invalid value of key %q: %w", key.Kid, err)
+			}
+			k.hmacKeys[key.Kid] = secret
+		}
+	}
+	return nil
+}
+
+// verificationKey returns the key verifying the token, the token without kid uses the only key of its kind
+func (k *keySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		if key, ok := k.hmacKeys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(k.secret) > 0 {
+			return k.secret, nil
+		}
+	case jwt.SigningMethodRS256.Alg():
+		if key, ok := k.publicKeys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(k.publicKeys) == 1 {
+			for _, key := range k.publicKeys {
+				return key, nil
+			}
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// NewAuthMiddleware authenticates the requests with a HS256 or RS256 bearer token. The HS256 tokens are verified
+// with the JWT secret, the RS256 tokens and the HS256 tokens with a kid with the keys of the JWKS file.
+// The subject of the token is the user of the request, see UserIDFromContext.
+func NewAuthMiddleware(conf *configuration.Configuration) (echo.MiddlewareFunc, error) {
+	keys := &keySet{
+		secret:     []byte(conf.JWTSecret),
+		hmacKeys:   make(map[string][]byte),
+		publicKeys: make(map[string]*rsa.PublicKey),
+	}
+	if conf.JWKSFile != "" {
+		if err := keys.loadJWKS(conf.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			l := logger.WithField("middleware", "auth").WithContext(c.Request().Context())
+
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			bearer, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || bearer == "" {
+				DebugOnError(l, ErrMissingToken, "Authentication failed")
+				return NewUnauthorizedError(ErrMissingToken)
+			}
+			claims := jwt.MapClaims{}
+			if _, err := parser.ParseWithClaims(bearer, claims, keys.verificationKey); err != nil {
+				DebugOnError(l, err, "Authentication failed")
+				return NewUnauthorizedError(fmt.Errorf("%w: %v", ErrInvalidToken, err))
+			}
+			subject, _ := claims["sub"].(string)
+			if subject == "" {
+				DebugOnError(l, ErrInvalidToken, "Token without subject")
+				return NewUnauthorizedError(fmt.Errorf("%w: missing subject", ErrInvalidToken))
+			}
+			// The subject is part of the keys of the store
+			if !db.ValidUserID(subject) {
+				DebugOnError(l, db.ErrInvalidUserID, "Token with an invalid subject")
+				return NewUnauthorizedError(fmt.Errorf("%w: %v", ErrInvalidToken, db.ErrInvalidUserID))
+			}
+
+			ctx := db.WithUser(c.Request().Context(), subject)
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}, nil
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"shopping-list/tests"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate the RSA key: %v", err)
+	}
+	jwksFile := t.TempDir() + "/jwks.json"
+	os.WriteFile(jwksFile, []byte(`{"keys":[
+		{"kty":"RSA","kid":"rsa-1","n":"`+base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes())+
+		`","e":"`+base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes())+`"},
+		{"kty":"oct","kid":"hmac-1","k":"`+base64.RawURLEncoding.EncodeToString([]byte("other secret"))+`"}]}`), 0o600)
+
+	conf := tests.GetDefaultConf()
+	conf.JWKSFile = jwksFile
+	api, e := setupMemoryTestWithConf(t, conf)
+	auth, err := NewAuthMiddleware(api.conf)
+	if err != nil {
+		t.Fatalf("Failed to load the JWKS: %v", err)
+	}
+	e.GET("/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, userID(c))
+	}, auth)
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, _ := token.SignedString(key)
+		return signed
+	}
+	expired := time.Now().Add(-time.Hour).Unix()
+
+	cases := []struct {
+		name   string
+		header string
+		code   int
+		user   string
+	}{
+		{"HS256 with the secret", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "42"}), http.StatusOK, "42"},
+		{"HS256 with a key of the JWKS", "Bearer " + sign(jwt.SigningMethodHS256, "hmac-1", []byte("other secret"), jwt.MapClaims{"sub": "43"}), http.StatusOK, "43"},
+		{"RS256 with a key of the JWKS", "Bearer " + sign(jwt.SigningMethodRS256, "rsa-1", privateKey, jwt.MapClaims{"sub": "44"}), http.StatusOK, "44"},
+		{"RS256 with the only RSA key", "Bearer " + sign(jwt.SigningMethodRS256, "", privateKey, jwt.MapClaims{"sub": "45"}), http.StatusOK, "45"},
+		{"Missing token", "", http.StatusUnauthorized, ""},
+		{"Not a bearer token", "Basic dXNlcjpwYXNz", http.StatusUnauthorized, ""},
+		{"Malformed token", "Bearer not-a-token", http.StatusUnauthorized, ""},
+		{"Wrong secret", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte("wrong"), jwt.MapClaims{"sub": "42"}), http.StatusUnauthorized, ""},
+		{"Unknown kid", "Bearer " + sign(jwt.SigningMethodRS256, "rsa-2", privateKey, jwt.MapClaims{"sub": "42"}), http.StatusUnauthorized, ""},
+		{"Unsupported algorithm", "Bearer " + sign(jwt.SigningMethodHS512, "", []byte(testSecret), jwt.MapClaims{"sub": "42"}), http.StatusUnauthorized, ""},
+		{"Expired token", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "42", "exp": expired}), http.StatusUnauthorized, ""},
+		{"Token without subject", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{}), http.StatusUnauthorized, ""},
+		{"Empty subject", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": ""}), http.StatusUnauthorized, ""},
+		{"Subject with the key separator", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "list:42"}), http.StatusUnauthorized, ""},
+		{"Subject with a pattern", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "4*"}), http.StatusUnauthorized, ""},
+		{"Subject with a question mark", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "4?"}), http.StatusUnauthorized, ""},
+		{"Subject with a bracket", "Bearer " + sign(jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "[4]"}), http.StatusUnauthorized, ""},
+	}
+	for _, test := range cases {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			if test.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, test.header)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != test.code || (test.code == http.StatusOK && rec.Body.String() != test.user) {
+				t.Errorf("Expected %d %q, got %d %s", test.code, test.user, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("Only the health checks are public", func(t *testing.T) {
+		for _, target := range []string{"/health/alive", "/health/ready"} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s should not require a token, got %d", target, rec.Code)
+			}
+		}
+		for _, target := range []string{"/shopping-list", "/shopping-list/lists", "/pantry", "/aisles", "/recipe/stats"} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), ErrMissingToken.Error()) {
+				t.Errorf("%s should require a token, got %d %s", target, rec.Code, rec.Body.String())
+			}
+		}
+	})
+
+	t.Run("The user of the token is the user of the request", func(t *testing.T) {
+		doRequestAs(e, "2", http.MethodPost, "/shopping-list/lists", `{"name":"Party"}`)
+		if rec := doRequestAs(e, "2", http.MethodGet, "/shopping-list/lists", ""); !strings.Contains(rec.Body.String(), "Party") {
+			t.Errorf("The list should be owned by the user of the token: %s", rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/lists", ""); strings.Contains(rec.Body.String(), "Party") {
+			t.Errorf("The list should not be visible by another user: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("An unreadable JWKS file fails", func(t *testing.T) {
+		conf := tests.GetDefaultConf()
+		conf.JWKSFile = t.TempDir() + "/missing.json"
+		if _, err := NewAuthMiddleware(conf); err == nil {
+			t.Errorf("Expected an error")
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"shopping-list/db"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (api *ApiHandler) getPantry(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getPantry")
+	defer span.End()
+	l := logger.WithField("request", "getPantry").WithContext(ctx)
+
+	items, err := api.store.GetPantry(ctx, userID(c))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the pantry")
+		return NewStoreError(err)
+	}
+	span.SetAttributes(attribute.Int("items.count", len(items)))
+	return c.JSON(http.StatusOK, items)
+}
+
+func (api *ApiHandler) getPantryItem(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getPantryItem")
+	defer span.End()
+	l := logger.WithField("request", "getPantryItem").WithContext(ctx)
+
+	items, err := api.store.GetPantryItem(ctx, userID(c), c.Param("id"))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the pantry item")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+func (api *ApiHandler) setPantryItem(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "setPantryItem")
+	defer span.End()
+	l := logger.WithField("request", "setPantryItem").WithContext(ctx)
+
+	request := new(PantryItemRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding pantry item failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	userId := userID(c)
+	item := db.PantryItem{ID: request.ID, Amount: request.Amount, Unit: request.Unit}
+	if err := api.store.SetPantryItem(ctx, userId, item); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to set the pantry item")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"ingredientId": item.ID,
+		"amount":       item.Amount,
+		"unit":         item.Unit,
+	}).Info("Pantry item set")
+
+	items, err := api.store.GetPantryItem(ctx, userId, request.ID)
+	if err != nil {
+		FailOnError(l, err, "Failed to get the pantry item")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+func (api *ApiHandler) removePantryItem(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "removePantryItem")
+	defer span.End()
+	l := logger.WithField("request", "removePantryItem").WithContext(ctx)
+
+	request := new(RemovePantryItemRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding pantry item failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	if err := api.store.RemovePantryItem(ctx, userID(c), request.ID, request.Unit); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to remove the pantry item")
+		return NewStoreError(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"shopping-list/services"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNoIngredient is returned when no ingredient of the recipe of the Recipe MS has a quantity
+var ErrNoIngredient = errors.New("the recipe has no ingredient with a quantity")
+
+// NewServiceError converts the errors of the other microservices to the HTTP errors
+func NewServiceError(err error) error {
+	if errors.Is(err, services.ErrNotFound) {
+		return NewNotFoundError(err)
+	}
+	return NewBadGatewayError(err)
+}
+
+func (api *ApiHandler) addServiceRecipe(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "addServiceRecipe")
+	defer span.End()
+	l := logger.WithField("request", "addServiceRecipe").WithContext(ctx)
+
+	request := new(AddServiceRecipeRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	// The query parameters are only bound by default for the GET, DELETE and HEAD requests
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, request); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	recipe, err := api.recipes.GetRecipe(ctx, request.ID)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the recipe from the Recipe MS")
+		return NewServiceError(err)
+	}
+
+	userId := userID(c)
+	recipeRequest, skipped := NewServiceRecipeRequest(recipe, request.Servings, userId, request.ListID)
+	if len(recipeRequest.Ingredients) == 0 {
+		FailOnError(l, ErrNoIngredient, "Validation of the recipe of the Recipe MS failed")
+		return NewUnprocessableEntityError(ErrNoIngredient)
+	}
+	if err := c.Validate(recipeRequest); err != nil {
+		FailOnError(l, err, "Validation of the recipe of the Recipe MS failed")
+		return NewUnprocessableEntityError(err)
+	}
+	deductions, err := api.addRecipeToShoppingList(ctx, userId, recipeRequest)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to add recipe")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"recipeId": recipe.ID,
+		"servings": request.Servings,
+		"skipped":  len(skipped),
+	}).Info("Recipe added from the Recipe MS")
+	response := NewAddRecipeResponse(recipeRequest, deductions)
+	response.Skipped = skipped
+	return c.JSON(http.StatusOK, response)
+}
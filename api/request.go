@@ -1,10 +1,14 @@
 package api
 
-import "shopping-list/db"
+import (
+	"shopping-list/db"
+	"shopping-list/services"
+	"time"
+)
 
 type Quantity struct {
 	Amount float64 `json:"amount" validate:"required,min=0"`
-	Unit   string  `json:"unit" validate:"oneof=i g kg ml l"`
+	Unit   string  `json:"unit" validate:"unit"`
 }
 
 type Ingredient struct {
@@ -22,12 +26,150 @@ type AddIngredientRequest struct {
 	Quantity
 }
 
+// IngredientRequest gets the ingredient, only its quantities for the recipe when RecipeID is set
+type IngredientRequest struct {
+	ID       string `param:"id" validate:"required"`
+	RecipeID string `param:"recipe_id"`
+	// The ingredient is in the primary list of the user when empty
+	ListID string `query:"listId"`
+}
+
+// RemoveIngredientRequest removes the quantity of the recipe, the quantity added without recipe when RecipeID
+// is empty, or all the quantities of the ingredient when All is true
+type RemoveIngredientRequest struct {
+	ID       string `param:"id" validate:"required"`
+	RecipeID string `param:"recipe_id"`
+	All      string `query:"all" validate:"omitempty,oneof=true false"`
+	ListID   string `query:"listId"`
+}
+
 type AddRecipeRequest struct {
-	ID          string                 `json:"id" validate:"required"`
-	UserID      string                 `json:"userId" validate:"required"`
+	ID string `json:"id" validate:"required"`
+	// User of the recipes received from the queue, the HTTP routes use the user of the token
+	UserID string `json:"userId" validate:"omitempty,userid"`
+	// The recipe is added to the primary list of the user when empty
+	ListID      string                 `json:"listId" validate:"omitempty"`
 	Ingredients []AddIngredientRequest `json:"ingredients" validate:"required,dive,required"`
 }
 
+// AddServiceRecipeRequest adds a recipe of the Recipe MS, its quantities are scaled to the servings.
+// The recipe is added for its own number of servings when Servings is 0.
+type AddServiceRecipeRequest struct {
+	ID       string `param:"id" validate:"required"`
+	Servings int    `query:"servings" validate:"omitempty,min=1,max=100"`
+	ListID   string `query:"listId" validate:"omitempty"`
+}
+
+// Value of the sort parameter of GET /shopping-list putting the ingredients left to buy first
+const SortByChecked = "checked"
+
+// Value of the expand parameter of GET /shopping-list adding the catalog information of the ingredients
+const ExpandCatalog = "catalog"
+
+// Value of the groupBy parameter of GET /shopping-list grouping the ingredients by catalog type
+const GroupByType = "type"
+
+// Value of the units parameter of GET /shopping-list displaying the quantities in the best fitting unit
+const UnitsBestFit = "best"
+
+type ShoppingListRequest struct {
+	Checked string `query:"checked" validate:"omitempty,oneof=true false"`
+	Sort    string `query:"sort" validate:"omitempty,oneof=checked"`
+	// The quantities are returned in the base unit of their dimension (g, ml, i) by default
+	Units string `query:"units" validate:"omitempty,oneof=best"`
+	// The ingredients are returned with their name, description and type in the catalog when expanded
+	Expand string `query:"expand" validate:"omitempty,oneof=catalog"`
+	// The ingredients are returned in sections following the aisle order of the user when grouped by type
+	GroupBy string `query:"groupBy" validate:"omitempty,oneof=type"`
+	// The list is rebuilt from its events as it was at this RFC 3339 time, the current list when zero
+	At time.Time `query:"at"`
+}
+
+// Formats of GET /shopping-list/export
+const (
+	FormatCSV      = "csv"
+	FormatMarkdown = "md"
+	FormatText     = "txt"
+	FormatJSON     = "json"
+)
+
+// Value of the groupBy parameter of GET /shopping-list/export grouping the ingredients by recipe
+const GroupByRecipe = "recipe"
+
+// ExportRequest exports the list in the format, negotiated with the Accept header when empty
+type ExportRequest struct {
+	Format  string `query:"format" validate:"omitempty,oneof=csv md txt json"`
+	Checked string `query:"checked" validate:"omitempty,oneof=true false"`
+	// The ingredients are exported in sections of their recipe, or of their catalog type following the aisle order
+	GroupBy string `query:"groupBy" validate:"omitempty,oneof=recipe type"`
+}
+
+// Formats of POST /shopping-list/import
+const (
+	ImportCSV  = "csv"
+	ImportText = "txt"
+)
+
+// ImportRequest imports the lines of the body in the format, given by the Content-Type when empty
+type ImportRequest struct {
+	Format string `query:"format" validate:"omitempty,oneof=csv txt"`
+}
+
+// EventsRequest gets the events of the list recorded until the RFC 3339 time, all of them when zero
+type EventsRequest struct {
+	Until time.Time `query:"until"`
+}
+
+// AisleOrderRequest sets the order of the aisles of the favourite store of the user, the missing types come last
+type AisleOrderRequest struct {
+	Aisles []string `json:"aisles" validate:"required,min=1,unique,dive,oneof=vegetable fruit meat fish dairy spice sugar cereals nuts other"`
+}
+
+type CheckItemRequest struct {
+	ID      string `param:"id" json:"-" validate:"required"`
+	Checked *bool  `json:"checked" validate:"required"`
+}
+
+type PantryItemRequest struct {
+	ID     string  `param:"id" json:"-" validate:"required"`
+	Amount float64 `json:"amount" validate:"required,gt=0"`
+	Unit   string  `json:"unit" validate:"unit"`
+}
+
+// RemovePantryItemRequest removes the ingredient in the unit, or in all the units when none is given
+type RemovePantryItemRequest struct {
+	ID   string `param:"id" validate:"required"`
+	Unit string `query:"unit" validate:"omitempty,unit"`
+}
+
+type ListRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type MemberRequest struct {
+	UserID string `param:"userId" json:"-" validate:"required,userid"`
+	Role   string `json:"role" validate:"required,oneof=editor viewer"`
+}
+
+// Number of recipes returned by GET /recipe/stats when no limit is given
+const DefaultRecipeStatsLimit = 10
+
+type RecipeStatsRequest struct {
+	Limit int `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// Number of trips returned by GET /shopping-list/history when no limit is given
+const DefaultHistoryLimit = 20
+
+type HistoryRequest struct {
+	Limit int `query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// JournalRequest undoes or redoes the last Steps operations of the user on the list, one by default
+type JournalRequest struct {
+	Steps int `query:"steps" validate:"omitempty,min=1,max=50"`
+}
+
 func NewRecipe(addRecipeRequest *AddRecipeRequest) (*db.Recipe, *[]db.Ingredient) {
 	recipe := &db.Recipe{
 		IngredientsID: make([]string, len(addRecipeRequest.Ingredients)),
@@ -56,6 +198,33 @@ func NewRecipe(addRecipeRequest *AddRecipeRequest) (*db.Recipe, *[]db.Ingredient
 	return recipe, &ingredients
 }
 
+// NewServiceRecipeRequest converts the recipe of the Recipe MS, scaled to the servings, to a recipe added by the user.
+// The ingredients without quantity, like "salt to taste" or a line scaled down to zero, are left out and their IDs returned.
+func NewServiceRecipeRequest(recipe *services.Recipe, servings int, userId string, listId string) (*AddRecipeRequest, []string) {
+	if servings == 0 {
+		servings = recipe.Servings
+	}
+	ingredients := recipe.Scale(servings)
+	request := &AddRecipeRequest{
+		ID:          recipe.ID,
+		UserID:      userId,
+		ListID:      listId,
+		Ingredients: make([]AddIngredientRequest, 0, len(ingredients)),
+	}
+	skipped := make([]string, 0)
+	for _, ingredient := range ingredients {
+		if ingredient.Quantity <= 0 {
+			skipped = append(skipped, ingredient.ID)
+			continue
+		}
+		request.Ingredients = append(request.Ingredients, AddIngredientRequest{
+			ID:       ingredient.ID,
+			Quantity: Quantity{Amount: ingredient.Quantity, Unit: ingredient.Units},
+		})
+	}
+	return request, skipped
+}
+
 func NewIngredient(addIngredientRequest *AddIngredientRequest, recipeID string) *db.Ingredient {
 	return &db.Ingredient{
 		Quantities: []db.Quantity{
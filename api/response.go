@@ -1,5 +1,11 @@
 package api
 
+import (
+	"shopping-list/db"
+	"shopping-list/services"
+	"time"
+)
+
 const (
 	LiveStatus     = "OK"
 	ReadyStatus    = "READY"
@@ -15,3 +21,108 @@ func NewHealthResponse(status string) *HealthResponse {
 		Status: status,
 	}
 }
+
+// AddRecipeResponse explains, for each ingredient, what was taken from the pantry instead of being added to the list
+type AddRecipeResponse struct {
+	ID         string         `json:"id"`
+	ListID     string         `json:"listId,omitempty"`
+	Deductions []db.Deduction `json:"deductions"`
+	// IDs of the ingredients of a recipe of the Recipe MS left out because they have no quantity
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+func NewAddRecipeResponse(recipe *AddRecipeRequest, deductions []db.Deduction) *AddRecipeResponse {
+	return &AddRecipeResponse{
+		ID:         recipe.ID,
+		ListID:     recipe.ListID,
+		Deductions: deductions,
+	}
+}
+
+// CatalogInfo is the description of an ingredient in the Catalog MS
+type CatalogInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+}
+
+// ShoppingListItem is an ingredient of the list, with its catalog information when expanded and found in the catalog
+type ShoppingListItem struct {
+	db.Ingredient
+	Catalog *CatalogInfo `json:"catalog,omitempty"`
+}
+
+func NewShoppingListItems(ingredients []db.Ingredient, catalog map[string]services.IngredientCatalog) []ShoppingListItem {
+	items := make([]ShoppingListItem, len(ingredients))
+	for i, ingredient := range ingredients {
+		items[i] = ShoppingListItem{Ingredient: ingredient}
+		if info, ok := catalog[ingredient.ID]; ok {
+			items[i].Catalog = &CatalogInfo{Name: info.Name, Description: info.Description, Type: info.Type}
+		}
+	}
+	return items
+}
+
+// ShoppingListSection gathers the ingredients of the list of a same catalog type
+type ShoppingListSection struct {
+	Type  string             `json:"type"`
+	Items []ShoppingListItem `json:"items"`
+}
+
+// ExportItem is an ingredient of the exported list, named after the catalog and with its quantities summed by unit
+type ExportItem struct {
+	ID         string        `json:"id"`
+	Name       string        `json:"name"`
+	Quantity   string        `json:"quantity"`
+	Quantities []db.Quantity `json:"quantities"`
+	Checked    bool          `json:"checked"`
+}
+
+// ExportSection gathers the ingredients of a recipe or of a catalog type, the title is empty when not grouped
+type ExportSection struct {
+	Title string       `json:"title"`
+	Items []ExportItem `json:"items"`
+}
+
+// ImportedItem is a quantity of an ingredient parsed from a line of the import. The ingredient is named
+// after the line, ID is its catalog ID, or the ID of the CSV row. Resolved tells that the ID is known.
+type ImportedItem struct {
+	Line     int    `json:"line"`
+	Name     string `json:"name"`
+	Resolved bool   `json:"resolved"`
+	AddIngredientRequest
+}
+
+// UnparsedLine is a line of the import that could not be added to the list
+type UnparsedLine struct {
+	Line  int    `json:"line"`
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+// ImportResponse reports the quantities added to the list, and the lines left out
+type ImportResponse struct {
+	Added    []ImportedItem `json:"added"`
+	Unparsed []UnparsedLine `json:"unparsed"`
+}
+
+// AisleOrderResponse is the order of the aisles used to group the list, Custom is false for the default order
+type AisleOrderResponse struct {
+	Aisles []string `json:"aisles"`
+	Custom bool     `json:"custom"`
+}
+
+// OperationResponse is an operation of the journal undone or redone
+type OperationResponse struct {
+	ID   string       `json:"id"`
+	Type db.EventType `json:"type"`
+	At   time.Time    `json:"at"`
+}
+
+func NewOperationResponses(operations []*db.Operation) []OperationResponse {
+	responses := make([]OperationResponse, len(operations))
+	for i, op := range operations {
+		responses[i] = OperationResponse{ID: op.ID, Type: op.Type, At: op.At}
+	}
+	return responses
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"shopping-list/db"
+	"shopping-list/units"
+	"sort"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
@@ -37,7 +41,7 @@ func (api *ApiHandler) getReadyStatus(c echo.Context) error {
 	l := logger.WithContext(ctx).WithField("request", "getReadyStatus")
 	status := NewHealthResponse(ReadyStatus)
 
-	err := api.rdb.Ping(c.Request().Context()).Err()
+	err := api.store.Ping(ctx)
 	if err != nil {
 		status = NewHealthResponse(NotReadyStatus)
 		FailOnError(l, err, "Redis ping failed")
@@ -54,20 +58,130 @@ func (api *ApiHandler) getReadyStatus(c echo.Context) error {
 
 func (api *ApiHandler) getShoppingList(c echo.Context) error {
 	ctx, span := api.tracer.Start(c.Request().Context(), "getShoppingList")
+	defer span.End()
 	l := logger.WithField("request", "getShoppingList").WithContext(ctx)
 
 	l.Debug("Getting Shopping List")
 
-	ingredients, err := db.GetShoppingList(api.rdb, "1")
+	params := new(ShoppingListRequest)
+	if err := c.Bind(params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(params); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
 
+	list, err := api.getList(ctx, userID(c), c.Param("listId"), db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	var ingredients *[]db.Ingredient
+	if params.At.IsZero() {
+		ingredients, err = api.store.GetShoppingList(ctx, list.Namespace())
+	} else {
+		ingredients, err = api.store.GetShoppingListAt(ctx, list.Namespace(), params.At)
+	}
 	if err != nil {
 		span.SetAttributes(attribute.String("err", err.Error()))
 		FailOnError(l, err, "Failed to get shopping list")
 		return NewInternalServerError(err)
 	}
-	span.SetAttributes(attribute.Int("ingredients.count", len(*ingredients)))
-	span.End()
-	return c.JSON(http.StatusOK, ingredients)
+	items := filterShoppingList(*ingredients, params)
+	span.SetAttributes(attribute.Int("ingredients.count", len(items)))
+	if params.Expand != ExpandCatalog && params.GroupBy != GroupByType {
+		return c.JSON(http.StatusOK, items)
+	}
+
+	// The list is still returned when the catalog is unavailable, without the catalog information
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	catalog, err := api.catalog.GetIngredients(ctx, ids)
+	if err != nil {
+		span.SetAttributes(attribute.String("catalog.err", err.Error()))
+		WarnOnError(l, err, "Failed to get the ingredients from the catalog")
+	}
+	expanded := NewShoppingListItems(items, catalog)
+	if params.GroupBy != GroupByType {
+		return c.JSON(http.StatusOK, expanded)
+	}
+
+	order, err := api.aisleOrder(ctx, userID(c))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the aisle order")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, api.groupByType(expanded, order.Aisles))
+}
+
+// filterShoppingList keeps the ingredients with the requested checked state, converts their quantities
+// in the requested units, and puts the ingredients left to buy first when sorting by checked state
+func filterShoppingList(ingredients []db.Ingredient, params *ShoppingListRequest) []db.Ingredient {
+	items := make([]db.Ingredient, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		if params.Checked == "" || strconv.FormatBool(ingredient.Checked) == params.Checked {
+			ingredient.Quantities = convertQuantities(ingredient.Quantities, params.Units)
+			items = append(items, ingredient)
+		}
+	}
+	if params.Sort == SortByChecked {
+		sort.SliceStable(items, func(i, j int) bool {
+			return !items[i].Checked && items[j].Checked
+		})
+	}
+	return items
+}
+
+// convertQuantities displays the quantities, saved in the base unit of their dimension,
+// in the best fitting unit when requested
+func convertQuantities(quantities []db.Quantity, unit string) []db.Quantity {
+	if unit == UnitsBestFit {
+		for i := range quantities {
+			quantities[i].Amount, quantities[i].Unit = units.BestFit(quantities[i].Amount, quantities[i].Unit)
+		}
+	}
+	return quantities
+}
+
+func (api *ApiHandler) checkItem(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "checkItem")
+	defer span.End()
+	l := logger.WithField("request", "checkItem").WithContext(ctx)
+
+	request := new(CheckItemRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding item failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	userId := userID(c)
+	list, err := api.getList(ctx, userId, c.Param("listId"), db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	ingredient, err := api.store.CheckIngredient(ctx, list.Namespace(), request.ID, userId, *request.Checked)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to check the item")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"ingredientId": request.ID,
+		"checked":      ingredient.Checked,
+	}).Info("Item checked")
+	return c.JSON(http.StatusOK, ingredient)
 }
 
 func (api *ApiHandler) addRecipe(c echo.Context) error {
@@ -85,125 +199,212 @@ func (api *ApiHandler) addRecipe(c echo.Context) error {
 		return NewBadRequestError(err)
 	}
 	l.Info("Validating Recipe " + recipe.ID)
-	recipeDb, ingredientsDb := NewRecipe(recipe)
-	err := db.AddRecipe(api.rdb, "1", recipe.ID, recipeDb, ingredientsDb)
+	deductions, err := api.addRecipeToShoppingList(c.Request().Context(), userID(c), recipe)
 	if err != nil {
 		FailOnError(l, err, "Failed to add recipe")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, NewAddRecipeResponse(recipe, deductions))
+}
+
+// addRecipeToShoppingList adds the ingredients of the recipe, minus what is in the pantry of the user, to the requested
+// list of the user, its primary list by default, and records the usage of the recipe.
+// It is shared by the HTTP route and the recipe consumer.
+func (api *ApiHandler) addRecipeToShoppingList(ctx context.Context, userId string, recipe *AddRecipeRequest) ([]db.Deduction, error) {
+	list, err := api.getList(ctx, userId, recipe.ListID, db.RoleEditor)
+	if err != nil {
+		return nil, err
+	}
+	recipeDb, ingredientsDb := NewRecipe(recipe)
+	return api.store.AddRecipe(ctx, list.Namespace(), userId, recipe.ID, recipeDb, ingredientsDb)
+}
+
+func (api *ApiHandler) getRecipeStats(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getRecipeStats")
+	defer span.End()
+	l := logger.WithField("request", "getRecipeStats").WithContext(ctx)
+
+	params := new(RecipeStatsRequest)
+	if err := c.Bind(params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(params); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultRecipeStatsLimit
+	}
+
+	stats, err := api.store.GetRecipeStats(ctx, userID(c), params.Limit)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get recipe stats")
 		return NewInternalServerError(err)
 	}
-	// TODO Change the response to return the recipe
-	return c.JSON(http.StatusNoContent, recipe)
+	span.SetAttributes(attribute.Int("recipes.count", len(stats)))
+	return c.JSON(http.StatusOK, stats)
+}
+
+func (api *ApiHandler) getIngredient(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getIngredient")
+	defer span.End()
+	l := logger.WithField("request", "getIngredient").WithContext(ctx)
+
+	l.Debug("Getting Ingredient")
+	request := new(IngredientRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	list, err := api.getList(ctx, userID(c), request.ListID, db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	var ingredient *db.Ingredient
+	if request.RecipeID != "" {
+		ingredient, err = api.store.GetIngredientRecipe(ctx, list.Namespace(), request.ID, request.RecipeID)
+		// The ingredient is in the list, but not for this recipe
+		if err == nil && len(ingredient.Quantities) == 0 {
+			err = db.ErrNotFound
+		}
+	} else {
+		ingredient, err = api.store.GetIngredient(ctx, list.Namespace(), request.ID)
+	}
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get ingredient")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, ingredient)
+}
+
+func (api *ApiHandler) addIngredient(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "addIngredient")
+	defer span.End()
+	l := logger.WithField("request", "addIngredient").WithContext(ctx)
+
+	l.Debug("Adding Ingredient")
+	ingredient := new(AddIngredientRequest)
+	if err := c.Bind(ingredient); err != nil {
+		FailOnError(l, err, "Binding ingredient failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(ingredient); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	recipeId := c.Param("recipe_id")
+	list, err := api.getList(ctx, userID(c), c.QueryParam("listId"), db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	// The store adds the ingredient to the recipe, ErrNotFound when the recipe is not in the list
+	ingredientRes, created, err := api.store.AddIngredient(ctx, list.Namespace(), ingredient.ID, *NewIngredient(ingredient, recipeId))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to add ingredient")
+		return NewStoreError(err)
+	}
+	// 201 when the ingredient is new in the list, 200 when the quantity is merged with the saved ones
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	l.WithFields(logrus.Fields{
+		"ingredientId": ingredient.ID,
+		"recipeId":     recipeId,
+	}).Info("Added Ingredient")
+	return c.JSON(status, ingredientRes)
 }
 
-// func (api *ApiHandler) getIngredient(c echo.Context) error {
-// 	l := logger.WithField("request", "getIngredient")
-// 	l.Debug("Getting Ingredient")
+func (api *ApiHandler) removeIngredient(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "removeIngredient")
+	defer span.End()
+	l := logger.WithField("request", "removeIngredient").WithContext(ctx)
 
-// 	ingredientId := c.Param("id")
-// 	recipeId := c.Param("recipe_id")
-
-// 	ingredient, err := db.GetIngredient(api.rdb, "1", ingredientId, recipeId)
-
-// 	if err != nil {
-// 		FailOnError(l, err, "Failed to get ingredient")
-// 		return NewNotFoundError(err)
-// 	}
-
-// 	return c.JSON(http.StatusOK, ingredient)
-// }
-
-// func (api *ApiHandler) removeIngredient(c echo.Context) error {
-// 	l := logger.WithField("request", "removeIngredient")
-
-// 	l.Debug("Removing Ingredient")
-
-// 	ingredientId := c.Param("id")
-// 	recipeId := c.Param("recipe_id")
-// 	allQuantities := c.QueryParam("all")
-// 	removeAll := false
-// 	// If all is true, remove all quantities of the ingredient
-// 	if allQuantities == "true" {
-// 		removeAll = true
-// 	}
-
-// 	err := db.RemoveIngredient(api.rdb, "1", ingredientId, recipeId, removeAll)
-// 	if err != nil {
-// 		FailOnError(l, err, "Failed to remove ingredient")
-// 		return NewNotFoundError(err)
-// 	}
-
-// 	l.WithFields(logrus.Fields{
-// 		ingredientId: ingredientId,
-// 		recipeId:     recipeId,
-// 	}).Info("Removed Ingredient")
-
-// 	// Then remove the ingredients from the recipe if recipeId is not empty
-// 	if recipeId != "" {
-// 		err = db.RemoveIngredientFromRecipe(api.rdb, "1", ingredientId, recipeId)
-// 		if err != nil {
-// 			FailOnError(l, err, "Failed to remove ingredient from recipe")
-// 			return NewInternalServerError(err)
-// 		}
-// 	}
-// 	return c.JSON(http.StatusNoContent, nil)
-// }
-
-// func (api *ApiHandler) getRecipe(c echo.Context) error {
-// 	l := logger.WithField("request", "getRecipe")
-
-// 	l.Debug("Getting Recipe")
-
-// 	recipeId := c.Param("id")
-
-// 	recipe, err := db.GetRecipe(api.rdb, "1", recipeId)
-// 	if err != nil {
-// 		FailOnError(l, err, "Failed to get recipe")
-// 		return NewNotFoundError(err)
-// 	}
-// 	return c.JSON(http.StatusOK, recipe)
-
-// }
-
-// func (api *ApiHandler) removeRecipe(c echo.Context) error {
-// 	l := logger.WithField("request", "removeRecipe")
-
-// 	l.Debug("Removing Recipe")
-
-// 	recipeId := c.Param("id")
-
-// 	err := db.RemoveRecipe(api.rdb, "1", recipeId)
-// 	if err != nil {
-// 		FailOnError(l, err, "Failed to remove recipe")
-// 		return NewNotFoundError(err)
-// 	}
-// 	return c.JSON(http.StatusNoContent, nil)
-// }
-
-// func (api *ApiHandler) addIngredient(c echo.Context) error {
-// 	l := logger.WithField("request", "addIngredient")
-
-// 	l.Debug("Adding Ingredient")
-
-// 	ingredient := new(AddIngredientRequest)
-
-// 	if err := c.Bind(ingredient); err != nil {
-// 		FailOnError(l, err, "Binding ingredient failed")
-// 		return NewBadRequestError(err)
-// 	}
-// 	if err := c.Validate(ingredient); err != nil {
-// 		FailOnError(l, err, "Validation failed")
-// 		return NewBadRequestError(err)
-// 	}
-
-// 	recipeId := ""
-// 	recipeId = c.Param("recipe_id")
-
-// 	ingredientDb := NewIngredient(ingredient, recipeId)
-// 	ingredientRes, err := db.AddIngredient(api.rdb, "1", ingredient.ID, *ingredientDb)
-// 	if err != nil {
-// 		FailOnError(l, err, "Failed to add ingredient")
-// 		return NewInternalServerError(err)
-// 	}
-
-// 	return c.JSON(http.StatusOK, ingredientRes)
-// }
+	l.Debug("Removing Ingredient")
+	request := new(RemoveIngredientRequest)
+	if err := c.Bind(request); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(request); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+
+	list, err := api.getList(ctx, userID(c), request.ListID, db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	// If all is true, remove all quantities of the ingredient, the recipes are updated in the same transaction
+	err = api.store.RemoveIngredient(ctx, list.Namespace(), request.ID, request.RecipeID, request.All == "true")
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to remove ingredient")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"ingredientId": request.ID,
+		"recipeId":     request.RecipeID,
+	}).Info("Removed Ingredient")
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (api *ApiHandler) getRecipe(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getRecipe")
+	defer span.End()
+	l := logger.WithField("request", "getRecipe").WithContext(ctx)
+
+	l.Debug("Getting Recipe")
+	recipeId := c.Param("id")
+	list, err := api.getList(ctx, userID(c), c.QueryParam("listId"), db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	recipe, err := api.store.GetRecipe(ctx, list.Namespace(), recipeId)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get recipe")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, recipe)
+}
+
+func (api *ApiHandler) removeRecipe(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "removeRecipe")
+	defer span.End()
+	l := logger.WithField("request", "removeRecipe").WithContext(ctx)
+
+	l.Debug("Removing Recipe")
+	recipeId := c.Param("id")
+	list, err := api.getList(ctx, userID(c), c.QueryParam("listId"), db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	if err := api.store.RemoveRecipe(ctx, list.Namespace(), recipeId); err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to remove recipe")
+		return NewStoreError(err)
+	}
+	l.WithField("recipeId", recipeId).Info("Removed Recipe")
+	return c.NoContent(http.StatusNoContent)
+}
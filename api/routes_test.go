@@ -0,0 +1,1112 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"shopping-list/configuration"
+	"shopping-list/db"
+	"shopping-list/services"
+	"shopping-list/tests"
+	"shopping-list/validation"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+)
+
+// setupMemoryTest creates an API backed by the in-memory store, with all the routes registered
+func setupMemoryTest(tb testing.TB) (*ApiHandler, *echo.Echo) {
+	return setupMemoryTestWithConf(tb, tests.GetDefaultConf())
+}
+
+func setupMemoryTestWithConf(tb testing.TB, conf *configuration.Configuration) (*ApiHandler, *echo.Echo) {
+	conf.TranslateValidation = true
+	conf.JWTSecret = testSecret
+	api := NewApiHandler(conf, db.NewMemoryStore(), nil)
+	e := New(validation.New(conf))
+	api.Register(e.Group(conf.ListenRoute), conf)
+	return api, e
+}
+
+// Secret signing the tokens of the tests
+const testSecret = "secret"
+
+// testToken returns a token of the user signed with the test secret
+func testToken(userId string) string {
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": userId}).SignedString([]byte(testSecret))
+	return token
+}
+
+// doRequest sends the request as the user 1
+func doRequest(e *echo.Echo, method string, target string, body string) *httptest.ResponseRecorder {
+	return doRequestAs(e, "1", method, target, body)
+}
+
+func doRequestAs(e *echo.Echo, userId string, method string, target string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+testToken(userId))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRoutesWithMemoryStore(t *testing.T) {
+
+	t.Run("Add a recipe then get the shopping list", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		// The user of the token is used, the request does not name it
+		body := `{"id":"000000000000000000000001","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		rec := doRequest(e, http.MethodPost, "/recipe", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to add the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+
+		rec = doRequest(e, http.MethodGet, "/shopping-list", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to get the shopping list: %d %s", rec.Code, rec.Body.String())
+		}
+		var ingredients []db.Ingredient
+		if err := json.Unmarshal(rec.Body.Bytes(), &ingredients); err != nil {
+			t.Fatalf("Failed to unmarshal the shopping list: %v", err)
+		}
+		if len(ingredients) != 2 {
+			t.Fatalf("Expected 2 ingredients, got %v", ingredients)
+		}
+		if ingredients[0].Quantities[0].Amount != 100 || ingredients[0].Quantities[0].RecipeID != "000000000000000000000001" {
+			t.Errorf("Wrong quantity for the first ingredient: %v", ingredients[0])
+		}
+	})
+
+	t.Run("Reject an invalid recipe", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		rec := doRequest(e, http.MethodPost, "/recipe", `{"id":"000000000000000000000001","userId":"1"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected a bad request, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("The ready status uses the store", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		rec := doRequest(e, http.MethodGet, "/health/ready", "")
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), ReadyStatus) {
+			t.Errorf("Expected the API to be ready, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Get the most used recipes", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		recipe := func(id string) string {
+			return `{"id":"` + id + `","userId":"1","ingredients":[{"id":"000000000000000000000001","amount":1,"unit":"g"}]}`
+		}
+		doRequest(e, http.MethodPost, "/recipe", recipe("000000000000000000000001"))
+		doRequest(e, http.MethodPost, "/recipe", recipe("000000000000000000000002"))
+		doRequest(e, http.MethodPost, "/recipe", recipe("000000000000000000000002"))
+
+		rec := doRequest(e, http.MethodGet, "/recipe/stats?limit=1", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to get the recipe stats: %d %s", rec.Code, rec.Body.String())
+		}
+		var stats []db.RecipeStats
+		if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("Failed to unmarshal the recipe stats: %v", err)
+		}
+		if len(stats) != 1 || stats[0].RecipeID != "000000000000000000000002" || stats[0].TimesAdded != 2 || stats[0].LastUsedAt.IsZero() {
+			t.Errorf("Wrong recipe stats: %v", stats)
+		}
+
+		rec = doRequest(e, http.MethodGet, "/recipe/stats?limit=1000", "")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("The limit should be validated, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Manage the named lists", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		rec := doRequest(e, http.MethodPost, "/shopping-list/lists", `{"name":"Party"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Failed to create the list: %d %s", rec.Code, rec.Body.String())
+		}
+		var list db.List
+		json.Unmarshal(rec.Body.Bytes(), &list)
+
+		body := `{"id":"000000000000000000000001","userId":"1","listId":"` + list.ID + `","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"}]}`
+		if rec := doRequest(e, http.MethodPost, "/recipe", body); rec.Code != http.StatusOK {
+			t.Fatalf("Failed to add the recipe to the list: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var ingredients []db.Ingredient
+		rec = doRequest(e, http.MethodGet, "/shopping-list/"+list.ID, "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if rec.Code != http.StatusOK || len(ingredients) != 1 {
+			t.Errorf("Wrong content of the list: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 0 {
+			t.Errorf("The primary list should be empty: %s", rec.Body.String())
+		}
+
+		rec = doRequest(e, http.MethodPatch, "/shopping-list/"+list.ID, `{"name":"Birthday"}`)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Birthday") {
+			t.Errorf("Failed to rename the list: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var lists []db.List
+		rec = doRequest(e, http.MethodGet, "/shopping-list/lists", "")
+		json.Unmarshal(rec.Body.Bytes(), &lists)
+		if len(lists) != 2 || !lists[0].Primary {
+			t.Errorf("Wrong lists: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodDelete, "/shopping-list/"+lists[0].ID, ""); rec.Code != http.StatusConflict {
+			t.Errorf("The primary list should not be deleted: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodDelete, "/shopping-list/"+list.ID, ""); rec.Code != http.StatusNoContent {
+			t.Errorf("Failed to delete the list: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/"+list.ID, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The deleted list should not be found: %d", rec.Code)
+		}
+	})
+
+	t.Run("Reject an unknown list", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		body := `{"id":"000000000000000000000001","userId":"1","listId":"unknown","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"}]}`
+		if rec := doRequest(e, http.MethodPost, "/recipe", body); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Enforce the roles on the shared lists", func(t *testing.T) {
+		api, e := setupMemoryTest(t)
+		ctx := context.Background()
+
+		// List of another user, shared with the user of the requests
+		list, _ := api.store.CreateList(ctx, "2", "Party")
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/"+list.ID, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The list should not be found before being shared: %d", rec.Code)
+		}
+		api.store.SetMember(ctx, "2", list.ID, "1", db.RoleViewer)
+
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/"+list.ID, ""); rec.Code != http.StatusOK {
+			t.Errorf("The viewer should read the list: %d %s", rec.Code, rec.Body.String())
+		}
+		body := `{"id":"000000000000000000000001","userId":"1","listId":"` + list.ID + `","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"}]}`
+		if rec := doRequest(e, http.MethodPost, "/recipe", body); rec.Code != http.StatusForbidden {
+			t.Errorf("The viewer should not add recipes: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodPut, "/shopping-list/"+list.ID+"/members/3", `{"role":"editor"}`); rec.Code != http.StatusForbidden {
+			t.Errorf("The viewer should not invite members: %d %s", rec.Code, rec.Body.String())
+		}
+
+		api.store.SetMember(ctx, "2", list.ID, "1", db.RoleEditor)
+		if rec := doRequest(e, http.MethodPost, "/recipe", body); rec.Code != http.StatusOK {
+			t.Errorf("The editor should add recipes: %d %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodDelete, "/shopping-list/"+list.ID+"/members/1", ""); rec.Code != http.StatusNoContent {
+			t.Errorf("The member should leave the list: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/"+list.ID, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The list should not be found after leaving it: %d", rec.Code)
+		}
+	})
+
+	t.Run("Manage the members of a list", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		rec := doRequest(e, http.MethodPost, "/shopping-list/lists", `{"name":"Party"}`)
+		var list db.List
+		json.Unmarshal(rec.Body.Bytes(), &list)
+
+		if rec := doRequest(e, http.MethodPut, "/shopping-list/"+list.ID+"/members/2", `{"role":"owner"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The role should be validated: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPut, "/shopping-list/"+list.ID+"/members/list:2", `{"role":"viewer"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The user ID of the member should be validated: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPut, "/shopping-list/"+list.ID+"/members/2", `{"role":"viewer"}`); rec.Code != http.StatusNoContent {
+			t.Fatalf("Failed to invite the member: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var members []db.Member
+		rec = doRequest(e, http.MethodGet, "/shopping-list/"+list.ID+"/members", "")
+		json.Unmarshal(rec.Body.Bytes(), &members)
+		if len(members) != 2 || members[1].UserID != "2" || members[1].Role != db.RoleViewer {
+			t.Errorf("Wrong members: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodDelete, "/shopping-list/"+list.ID+"/members/2", ""); rec.Code != http.StatusNoContent {
+			t.Errorf("Failed to remove the member: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodDelete, "/shopping-list/"+list.ID+"/members/2", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The removed member should not be found: %d", rec.Code)
+		}
+	})
+
+	t.Run("Check the items of the shopping list", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+
+		rec := doRequest(e, http.MethodPatch, "/shopping-list/items/000000000000000000000001", `{"checked":true}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to check the item: %d %s", rec.Code, rec.Body.String())
+		}
+		var item db.Ingredient
+		json.Unmarshal(rec.Body.Bytes(), &item)
+		if !item.Checked || item.CheckedBy != "1" || item.CheckedAt == nil {
+			t.Errorf("Wrong checked item: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodPatch, "/shopping-list/items/000000000000000000000001", `{}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The checked state should be required: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPatch, "/shopping-list/items/unknown", `{"checked":true}`); rec.Code != http.StatusNotFound {
+			t.Errorf("Unknown items should not be found: %d", rec.Code)
+		}
+
+		var ingredients []db.Ingredient
+		rec = doRequest(e, http.MethodGet, "/shopping-list?checked=false", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 1 || ingredients[0].ID != "000000000000000000000002" {
+			t.Errorf("Wrong unchecked items: %s", rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/shopping-list?sort=checked", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 2 || ingredients[0].Checked || !ingredients[1].Checked {
+			t.Errorf("The items left to buy should be first: %s", rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list?checked=maybe", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("The checked filter should be validated: %d", rec.Code)
+		}
+	})
+
+	t.Run("Complete a trip then browse the history", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		if rec := doRequest(e, http.MethodPost, "/shopping-list/complete", ""); rec.Code != http.StatusConflict {
+			t.Errorf("An empty trip should not be completed: %d", rec.Code)
+		}
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		doRequest(e, http.MethodPatch, "/shopping-list/items/000000000000000000000002", `{"checked":true}`)
+
+		rec := doRequest(e, http.MethodPost, "/shopping-list/complete", "")
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Failed to complete the trip: %d %s", rec.Code, rec.Body.String())
+		}
+		var trip db.Trip
+		json.Unmarshal(rec.Body.Bytes(), &trip)
+
+		var trips []db.Trip
+		rec = doRequest(e, http.MethodGet, "/shopping-list/history", "")
+		json.Unmarshal(rec.Body.Bytes(), &trips)
+		if len(trips) != 1 || trips[0].ID != trip.ID || len(trips[0].Ingredients) != 1 {
+			t.Errorf("Wrong history: %s", rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/history/"+trip.ID, ""); rec.Code != http.StatusOK {
+			t.Errorf("Failed to get the trip: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list/history/unknown", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Unknown trips should not be found: %d", rec.Code)
+		}
+	})
+
+	t.Run("Manage the pantry and explain the deductions", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		rec := doRequest(e, http.MethodPut, "/pantry/000000000000000000000001", `{"amount":30,"unit":"g"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to set the pantry item: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodPut, "/pantry/000000000000000000000001", `{"amount":0,"unit":"g"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The amount should be validated: %d", rec.Code)
+		}
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"}]}`
+		rec = doRequest(e, http.MethodPost, "/recipe", body)
+		var response AddRecipeResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusOK || len(response.Deductions) != 1 || response.Deductions[0].FromPantry != 30 || response.Deductions[0].Shortfall != 70 {
+			t.Errorf("Wrong deductions: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var pantry []db.PantryItem
+		rec = doRequest(e, http.MethodGet, "/pantry", "")
+		json.Unmarshal(rec.Body.Bytes(), &pantry)
+		if len(pantry) != 0 {
+			t.Errorf("The pantry should be empty: %s", rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/pantry/000000000000000000000001", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The used item should not be found: %d", rec.Code)
+		}
+
+		doRequest(e, http.MethodPut, "/pantry/000000000000000000000002", `{"amount":1,"unit":"kg"}`)
+		if rec := doRequest(e, http.MethodDelete, "/pantry/000000000000000000000002?unit=kg", ""); rec.Code != http.StatusNoContent {
+			t.Errorf("Failed to remove the pantry item: %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Merge the quantities of different units", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":500,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"tbsp"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		body = `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":1,"unit":"kg"},
+			{"id":"000000000000000000000002","amount":1,"unit":"tsp"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+
+		var ingredients []db.Ingredient
+		rec := doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 2 || len(ingredients[0].Quantities) != 1 || ingredients[0].Quantities[0].Amount != 1500 || ingredients[0].Quantities[0].Unit != "g" {
+			t.Fatalf("The quantities should be merged in the base unit: %s", rec.Body.String())
+		}
+		if q := ingredients[1].Quantities; len(q) != 1 || q[0].Amount != 35 || q[0].Unit != "ml" {
+			t.Errorf("The volumes should be merged in ml: %v", q)
+		}
+
+		rec = doRequest(e, http.MethodGet, "/shopping-list?units=best", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if q := ingredients[0].Quantities; len(q) != 1 || q[0].Amount != 1.5 || q[0].Unit != "kg" {
+			t.Errorf("The quantity should be displayed in kg: %v", q)
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list?units=imperial", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("The units should be validated: %d", rec.Code)
+		}
+	})
+
+	t.Run("Accept the units of the registry with their aliases", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":2,"unit":"cs"},
+			{"id":"000000000000000000000002","amount":250,"unit":"grams"}]}`
+		if rec := doRequest(e, http.MethodPost, "/recipe", body); rec.Code != http.StatusOK {
+			t.Fatalf("The aliases should be accepted: %d %s", rec.Code, rec.Body.String())
+		}
+		var ingredients []db.Ingredient
+		rec := doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 2 || ingredients[0].Quantities[0].Unit != "ml" || ingredients[1].Quantities[0].Unit != "g" {
+			t.Errorf("The quantities should be saved in the canonical units: %s", rec.Body.String())
+		}
+
+		body = `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":1,"unit":"pound"}]}`
+		rec = doRequest(e, http.MethodPost, "/recipe", body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "must be a known unit") {
+			t.Errorf("An unknown unit should be rejected: %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Add a recipe of the Recipe MS scaled to the servings", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/recipe/000000000000000000000001": services.Recipe{
+				ID:       "000000000000000000000001",
+				Servings: 4,
+				Ingredients: []services.IngredientRecipe{
+					{ID: "000000000000000000000001", Quantity: 200, Units: "g"},
+					{ID: "000000000000000000000002", Quantity: 2, Units: "is"},
+				},
+			},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.RecipeServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+
+		rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000001/add?servings=6", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to add the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+		var ingredients []db.Ingredient
+		rec = doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 2 || ingredients[0].Quantities[0].Amount != 300 || ingredients[1].Quantities[0].Amount != 3 {
+			t.Errorf("The quantities should be scaled to the servings: %s", rec.Body.String())
+		}
+
+		// Without servings the recipe is added as it is
+		doRequest(e, http.MethodPost, "/recipe/000000000000000000000001/add", "")
+		rec = doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if ingredients[0].Quantities[0].Amount != 500 {
+			t.Errorf("The recipe should be added for its own servings: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000002/add", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found for an unknown recipe, got %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000001/add?servings=0", ""); rec.Code != http.StatusOK {
+			t.Errorf("No servings should add the recipe as it is, got %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000001/add?servings=-1", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("The servings should be validated, got %d", rec.Code)
+		}
+
+		stub.FailNext(10)
+		if rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000001/add", ""); rec.Code != http.StatusBadGateway {
+			t.Errorf("Expected a bad gateway when the Recipe MS fails, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Leave out the ingredients of the Recipe MS without quantity", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/recipe/000000000000000000000001": services.Recipe{
+				ID:       "000000000000000000000001",
+				Servings: 4,
+				Ingredients: []services.IngredientRecipe{
+					{ID: "000000000000000000000001", Quantity: 200, Units: "g"},
+					{ID: "000000000000000000000002", Quantity: 0.001, Units: "g"},
+					{ID: "000000000000000000000003", Quantity: 0, Units: "tsp"},
+				},
+			},
+			"/recipe/000000000000000000000002": services.Recipe{
+				ID:          "000000000000000000000002",
+				Servings:    4,
+				Ingredients: []services.IngredientRecipe{{ID: "000000000000000000000003", Quantity: 0, Units: "tsp"}},
+			},
+			"/recipe/000000000000000000000003": services.Recipe{
+				ID:          "000000000000000000000003",
+				Servings:    4,
+				Ingredients: []services.IngredientRecipe{{ID: "000000000000000000000001", Quantity: 1, Units: "pound"}},
+			},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.RecipeServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+
+		// The second line is scaled down to zero
+		rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000001/add?servings=1", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to add the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+		var response AddRecipeResponse
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if len(response.Skipped) != 2 || response.Skipped[0] != "000000000000000000000002" || response.Skipped[1] != "000000000000000000000003" {
+			t.Errorf("The ingredients without quantity should be reported: %s", rec.Body.String())
+		}
+		var ingredients []db.Ingredient
+		rec = doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 1 || ingredients[0].Quantities[0].Amount != 50 {
+			t.Errorf("Only the ingredients with a quantity should be added: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000002/add", ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("A recipe without any quantity should be unprocessable, got %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPost, "/recipe/000000000000000000000003/add", ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("A recipe with an unknown unit should be unprocessable, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Expand the ingredients with the catalog", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/ingredient/000000000000000000000001": services.IngredientCatalog{
+				ID: "000000000000000000000001", Name: "Flour", Description: "Wheat flour", Type: "cereals",
+			},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.CatalogServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+
+		// The list is still returned when the catalog fails
+		var items []ShoppingListItem
+		stub.FailNext(100)
+		rec := doRequest(e, http.MethodGet, "/shopping-list?expand=catalog", "")
+		json.Unmarshal(rec.Body.Bytes(), &items)
+		if rec.Code != http.StatusOK || len(items) != 2 || items[0].Catalog != nil {
+			t.Errorf("The list should degrade gracefully: %d %s", rec.Code, rec.Body.String())
+		}
+		stub.FailNext(0)
+
+		items = nil
+		rec = doRequest(e, http.MethodGet, "/shopping-list?expand=catalog", "")
+		json.Unmarshal(rec.Body.Bytes(), &items)
+		if rec.Code != http.StatusOK || len(items) != 2 || items[0].Catalog == nil || items[0].Catalog.Name != "Flour" || items[0].Quantities[0].Amount != 100 {
+			t.Fatalf("The ingredient should be expanded: %d %s", rec.Code, rec.Body.String())
+		}
+		if items[1].Catalog != nil {
+			t.Errorf("The ingredient missing from the catalog should not be expanded: %v", items[1])
+		}
+		if strings.Contains(doRequest(e, http.MethodGet, "/shopping-list", "").Body.String(), "catalog") {
+			t.Errorf("The ingredients should only be expanded on request")
+		}
+	})
+
+	t.Run("Group the shopping list by aisle", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/ingredient/000000000000000000000001": services.IngredientCatalog{ID: "000000000000000000000001", Name: "Carrot", Type: "vegetable"},
+			"/ingredient/000000000000000000000002": services.IngredientCatalog{ID: "000000000000000000000002", Name: "Milk", Type: "dairy"},
+			"/ingredient/000000000000000000000003": services.IngredientCatalog{ID: "000000000000000000000003", Name: "Cheese", Type: "dairy"},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.CatalogServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":2,"unit":"i"},
+			{"id":"000000000000000000000002","amount":1,"unit":"l"},
+			{"id":"000000000000000000000003","amount":200,"unit":"g"},
+			{"id":"000000000000000000000004","amount":1,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+
+		sectionTypes := func() []string {
+			var sections []ShoppingListSection
+			rec := doRequest(e, http.MethodGet, "/shopping-list?groupBy=type", "")
+			json.Unmarshal(rec.Body.Bytes(), &sections)
+			types := make([]string, len(sections))
+			for i, section := range sections {
+				types[i] = section.Type
+			}
+			return types
+		}
+		if types := sectionTypes(); strings.Join(types, ",") != "vegetable,dairy,other" {
+			t.Errorf("The sections should follow the default aisle order: %v", types)
+		}
+
+		rec := doRequest(e, http.MethodPut, "/aisles", `{"aisles":["dairy","other"]}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to set the aisle order: %d %s", rec.Code, rec.Body.String())
+		}
+		if types := sectionTypes(); strings.Join(types, ",") != "dairy,other,vegetable" {
+			t.Errorf("The sections should follow the custom aisle order: %v", types)
+		}
+		var order AisleOrderResponse
+		rec = doRequest(e, http.MethodGet, "/aisles", "")
+		json.Unmarshal(rec.Body.Bytes(), &order)
+		if !order.Custom || len(order.Aisles) != 2 {
+			t.Errorf("Wrong aisle order: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodPut, "/aisles", `{"aisles":["dairy","toys"]}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The types should be validated: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPut, "/aisles", `{"aisles":["dairy","dairy"]}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The types should be unique: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodDelete, "/aisles", ""); rec.Code != http.StatusNoContent {
+			t.Errorf("Failed to remove the aisle order: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodDelete, "/aisles", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found without custom order: %d", rec.Code)
+		}
+		if types := sectionTypes(); strings.Join(types, ",") != "vegetable,dairy,other" {
+			t.Errorf("The sections should follow the default aisle order again: %v", types)
+		}
+	})
+
+	t.Run("Export the shopping list", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/ingredient/000000000000000000000001": services.IngredientCatalog{ID: "000000000000000000000001", Name: "Flour", Type: "cereals"},
+			"/recipe/000000000000000000000001":     services.Recipe{ID: "000000000000000000000001", Name: "Pancakes"},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.CatalogServiceURL = stub.URL
+		conf.RecipeServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":1,"unit":"kg"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000001", `{"amount":500,"unit":"g"}`)
+
+		export := func(target string, accept string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+testToken("1"))
+			if accept != "" {
+				req.Header.Set(echo.HeaderAccept, accept)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := export("/shopping-list/export?format=csv", "")
+		expected := "section,id,name,quantity,checked\n" +
+			",000000000000000000000001,Flour,1.5 kg,false\n" +
+			",000000000000000000000002,000000000000000000000002,2,false\n"
+		if rec.Code != http.StatusOK || rec.Body.String() != expected || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/csv") {
+			t.Errorf("Unexpected CSV export: %d %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Header().Get(echo.HeaderContentDisposition), `filename="shopping-list.csv"`) {
+			t.Errorf("The export should be downloaded: %v", rec.Header())
+		}
+
+		rec = export("/shopping-list/export?groupBy=recipe", "application/json;q=0.5, text/markdown")
+		expected = "# Shopping list\n\n" +
+			"## Pancakes\n\n" +
+			"- [ ] Flour: 1 kg\n" +
+			"- [ ] 000000000000000000000002: 2\n\n" +
+			"## Other\n\n" +
+			"- [ ] Flour: 500 g\n"
+		if rec.Code != http.StatusOK || rec.Body.String() != expected || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), "text/markdown") {
+			t.Errorf("Unexpected Markdown export: %d %q", rec.Code, rec.Body.String())
+		}
+
+		doRequest(e, http.MethodPatch, "/shopping-list/items/000000000000000000000002", `{"checked":true}`)
+		rec = export("/shopping-list/export?groupBy=type", "text/plain")
+		expected = "Shopping list\n=============\n\n" +
+			"cereals\n[ ] Flour: 1.5 kg\n\n" +
+			"other\n[x] 000000000000000000000002: 2\n"
+		if rec.Code != http.StatusOK || rec.Body.String() != expected {
+			t.Errorf("Unexpected text export: %d %q", rec.Code, rec.Body.String())
+		}
+
+		var items []ExportItem
+		rec = export("/shopping-list/export?checked=false", "")
+		json.Unmarshal(rec.Body.Bytes(), &items)
+		if rec.Code != http.StatusOK || len(items) != 1 || items[0].Name != "Flour" || items[0].Quantity != "1.5 kg" || items[0].Quantities[0].Amount != 1500 {
+			t.Errorf("Unexpected JSON export: %d %s", rec.Code, rec.Body.String())
+		}
+
+		if rec = export("/shopping-list/export", "image/png, text/csv;q=0"); rec.Code != http.StatusNotAcceptable {
+			t.Errorf("Expected 406, got %d %s", rec.Code, rec.Body.String())
+		}
+		if rec = export("/shopping-list/export?format=pdf", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("Escape the names in the exports", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/ingredient/000000000000000000000001": services.IngredientCatalog{ID: "000000000000000000000001", Name: "Salt *fine* | _sea_\n<b>#1</b>", Type: "condiment"},
+			"/ingredient/000000000000000000000002": services.IngredientCatalog{ID: "000000000000000000000002", Name: `Pepper, "black"`, Type: "condiment"},
+			"/ingredient/000000000000000000000003": services.IngredientCatalog{ID: "000000000000000000000003", Name: `=HYPERLINK("http://example.com")`, Type: "condiment"},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.CatalogServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000001", `{"amount":1,"unit":"i"}`)
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000002", `{"amount":2,"unit":"i"}`)
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000003", `{"amount":3,"unit":"i"}`)
+
+		rec := doRequest(e, http.MethodGet, "/shopping-list/export?format=md", "")
+		expected := "# Shopping list\n\n" +
+			"- [ ] Salt \\*fine\\* \\| \\_sea\\_ \\<b\\>\\#1\\</b\\>: 1\n" +
+			"- [ ] Pepper, \"black\": 2\n" +
+			"- [ ] =HYPERLINK(\"http://example.com\"): 3\n"
+		if rec.Code != http.StatusOK || rec.Body.String() != expected {
+			t.Errorf("The Markdown should be escaped: %d %q", rec.Code, rec.Body.String())
+		}
+
+		rec = doRequest(e, http.MethodGet, "/shopping-list/export?format=txt", "")
+		if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 6 || lines[3] != "[ ] Salt *fine* | _sea_ <b>#1</b>: 1" {
+			t.Errorf("A name should stay on its line: %q", rec.Body.String())
+		}
+
+		rec = doRequest(e, http.MethodGet, "/shopping-list/export?format=csv", "")
+		records, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+		if err != nil || len(records) != 4 || records[1][2] != "Salt *fine* | _sea_\n<b>#1</b>" || records[2][2] != `Pepper, "black"` {
+			t.Errorf("The CSV should read the names back: %q %v", rec.Body.String(), err)
+		}
+		// A spreadsheet must not run the name as a formula
+		if len(records) == 4 && records[3][2] != `'=HYPERLINK("http://example.com")` {
+			t.Errorf("The formula should be escaped: %q", records[3][2])
+		}
+		var response ImportResponse
+		rec = doRequestAs(e, "2", http.MethodPost, "/shopping-list/import?format=csv", rec.Body.String())
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if len(response.Added) != 3 || response.Added[2].Name != `=HYPERLINK("http://example.com")` {
+			t.Errorf("The escaped name should be imported as it was: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Import the shopping list", func(t *testing.T) {
+		stub := tests.NewServiceStub(map[string]interface{}{
+			"/ingredient/name/potatoes":            services.IngredientCatalog{ID: "000000000000000000000001", Name: "Potatoes", Type: "vegetable"},
+			"/ingredient/000000000000000000000001": services.IngredientCatalog{ID: "000000000000000000000001", Name: "Potatoes", Type: "vegetable"},
+			"/ingredient/name/milk":                services.IngredientCatalog{ID: "000000000000000000000002", Name: "Milk", Type: "dairy"},
+			"/ingredient/name/flour":               services.IngredientCatalog{ID: "000000000000000000000003", Name: "Flour", Type: "cereals"},
+			"/ingredient/name/onions":              services.IngredientCatalog{ID: "000000000000000000000004", Name: "Onions", Type: "vegetable"},
+			"/ingredient/name/potatoes: organic":   services.IngredientCatalog{ID: "000000000000000000000005", Name: "Organic potatoes", Type: "vegetable"},
+		})
+		defer stub.Close()
+		conf := tests.GetDefaultConf()
+		conf.CatalogServiceURL = stub.URL
+		_, e := setupMemoryTestWithConf(t, conf)
+
+		send := func(userId string, method string, target string, contentType string, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(method, target, strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, contentType)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+testToken(userId))
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			return rec
+		}
+
+		body := "# Groceries\n\n2 kg potatoes\n- [ ] 1 cup of milk\n500g Potatoes\nsome salt\n3 eggs\n2 kg\n[x] Flour: 1.5 kg + 2\n2-3 onions\n"
+		var response ImportResponse
+		rec := send("1", http.MethodPost, "/shopping-list/import", echo.MIMETextPlain, body)
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusOK || len(response.Added) != 6 || len(response.Unparsed) != 3 {
+			t.Fatalf("Unexpected import: %d %s", rec.Code, rec.Body.String())
+		}
+		if added := response.Added[0]; added.Line != 3 || !added.Resolved || added.ID != "000000000000000000000001" || added.Amount != 2 || added.Unit != "kg" {
+			t.Errorf("The name should be resolved in the catalog: %+v", added)
+		}
+		if added := response.Added[1]; !added.Resolved || added.ID != "000000000000000000000002" || added.Amount != 1 || added.Unit != "cup" {
+			t.Errorf("The name of the check list line should be resolved: %+v", added)
+		}
+		if added := response.Added[5]; added.ID != "000000000000000000000004" || added.Amount != 3 || added.Unit != "i" {
+			t.Errorf("The upper bound of the range should be added: %+v", added)
+		}
+		if response.Unparsed[0].Line != 6 || response.Unparsed[0].Text != "some salt" || response.Unparsed[2].Line != 8 {
+			t.Errorf("Unexpected unparsed lines: %+v", response.Unparsed)
+		}
+		// The names unknown by the catalog are reported instead of being added under a made-up ID
+		if unknown := response.Unparsed[1]; unknown.Line != 7 || unknown.Text != "eggs" || unknown.Error != errUnknownIngredient.Error() {
+			t.Errorf("The unknown name should be reported: %+v", unknown)
+		}
+		if rec := doRequest(e, http.MethodGet, "/ingredient/eggs", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The unknown name should not be added: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var ingredient db.Ingredient
+		rec = doRequest(e, http.MethodGet, "/ingredient/000000000000000000000001", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if len(ingredient.Quantities) != 1 || ingredient.Quantities[0].Amount != 2500 {
+			t.Errorf("The quantities should be merged: %s", rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/ingredient/000000000000000000000003", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if len(ingredient.Quantities) != 2 {
+			t.Errorf("The quantities of the export line should be added: %s", rec.Body.String())
+		}
+
+		// The CSV export of a list is imported in another list
+		export := doRequest(e, http.MethodGet, "/shopping-list/export?format=csv", "").Body.String()
+		response = ImportResponse{}
+		rec = send("2", http.MethodPost, "/shopping-list/import", "text/csv", export)
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusOK || len(response.Added) != 5 || len(response.Unparsed) != 0 {
+			t.Fatalf("Unexpected CSV import: %d %s", rec.Code, rec.Body.String())
+		}
+		if export2 := doRequestAs(e, "2", http.MethodGet, "/shopping-list/export?format=csv", "").Body.String(); export2 != strings.ReplaceAll(export, "true", "false") {
+			t.Errorf("The imported list should match the exported one:\n%s\n%s", export, export2)
+		}
+
+		rec = send("2", http.MethodPost, "/shopping-list/import?format=csv", echo.MIMETextPlain, "name,amount,unit\nmilk,1,l\nsugar,,\n")
+		response = ImportResponse{}
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusOK || len(response.Added) != 1 || len(response.Unparsed) != 1 || response.Unparsed[0].Line != 3 {
+			t.Errorf("Unexpected CSV import with amounts: %d %s", rec.Code, rec.Body.String())
+		}
+
+		// A colon is a line of the exports only when quantities follow it
+		response = ImportResponse{}
+		rec = send("3", http.MethodPost, "/shopping-list/import", echo.MIMETextPlain, "2 kg potatoes: organic\n")
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusOK || len(response.Added) != 1 || response.Added[0].ID != "000000000000000000000005" || response.Added[0].Amount != 2 {
+			t.Errorf("The plain line with a colon should be parsed: %d %s", rec.Code, rec.Body.String())
+		}
+
+		// The rows of a CSV without header are numbered by row, a quoted field may span lines
+		response = ImportResponse{}
+		rec = send("3", http.MethodPost, "/shopping-list/import", "text/csv", "\"1 kg\npotatoes\"\nsome salt\n")
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		if rec.Code != http.StatusOK || len(response.Added) != 1 || response.Added[0].Line != 1 || len(response.Unparsed) != 1 || response.Unparsed[0].Line != 2 {
+			t.Errorf("Unexpected CSV import without header: %d %s", rec.Code, rec.Body.String())
+		}
+
+		// The lines are added in one operation
+		if rec := doRequestAs(e, "2", http.MethodPost, "/shopping-list/undo?steps=1", ""); rec.Code != http.StatusOK {
+			t.Fatalf("Failed to undo the import: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequestAs(e, "2", http.MethodGet, "/shopping-list", "")
+		var items []ShoppingListItem
+		json.Unmarshal(rec.Body.Bytes(), &items)
+		if len(items) != 4 || items[1].ID != "000000000000000000000002" || len(items[1].Quantities) != 1 || items[1].Quantities[0].Amount != 240 {
+			t.Errorf("Undoing the last import should leave the lines of the first one: %s", rec.Body.String())
+		}
+
+		if rec = send("1", http.MethodPost, "/shopping-list/import?format=pdf", echo.MIMETextPlain, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", rec.Code)
+		}
+		if rec = send("1", http.MethodPost, "/shopping-list/import", "text/csv", "name\n\"flour"); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for an invalid CSV, got %d", rec.Code)
+		}
+		if rec = send("1", http.MethodPost, "/shopping-list/import", echo.MIMETextPlain, strings.Repeat("1 egg\n", MaxImportLines)); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for a large import, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Manage the ingredients of the shopping list", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+		const id = "000000000000000000000001"
+
+		if rec := doRequest(e, http.MethodGet, "/ingredient/"+id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found for an unknown ingredient: %d", rec.Code)
+		}
+		rec := doRequest(e, http.MethodPost, "/ingredient/"+id, `{"amount":200,"unit":"g"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected created for a new ingredient: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodPost, "/ingredient/"+id, `{"amount":1,"unit":"kg"}`)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected ok when the quantities are merged: %d %s", rec.Code, rec.Body.String())
+		}
+		var ingredient db.Ingredient
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if ingredient.ID != id || len(ingredient.Quantities) != 1 || ingredient.Quantities[0].Amount != 1200 {
+			t.Errorf("The quantities should be merged: %s", rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/ingredient/"+id, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to get the ingredient: %d %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodPost, "/ingredient/"+id, `{"amount":-1,"unit":"g"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The amount should be validated: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPost, "/ingredient/"+id, `{"amount":1,"unit":"pound"}`); rec.Code != http.StatusBadRequest {
+			t.Errorf("The unit should be validated: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodDelete, "/ingredient/"+id+"?all=yes", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("The all parameter should be validated: %d", rec.Code)
+		}
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[{"id":"` + id + `","amount":100,"unit":"g"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		if rec := doRequest(e, http.MethodDelete, "/ingredient/"+id, ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("Failed to remove the ingredient: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/ingredient/"+id, "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if rec.Code != http.StatusOK || len(ingredient.Quantities) != 1 || ingredient.Quantities[0].Amount != 100 {
+			t.Errorf("Only the quantity without recipe should be removed: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodDelete, "/ingredient/"+id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found without quantity outside of a recipe: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodDelete, "/ingredient/"+id+"?all=true", ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("Failed to remove all the quantities: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodGet, "/ingredient/"+id, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The ingredient should be removed: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodDelete, "/ingredient/"+id+"?all=true", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found for a removed ingredient: %d", rec.Code)
+		}
+	})
+
+	t.Run("Manage the recipes of the shopping list", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+		const recipeId = "000000000000000000000001"
+
+		if rec := doRequest(e, http.MethodGet, "/recipe/"+recipeId, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found for an unknown recipe: %d", rec.Code)
+		}
+		if rec := doRequest(e, http.MethodPost, "/recipe/"+recipeId+"/ingredient/000000000000000000000003", `{"amount":1,"unit":"i"}`); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found when adding to an unknown recipe: %d", rec.Code)
+		}
+
+		body := `{"id":"` + recipeId + `","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		rec := doRequest(e, http.MethodGet, "/recipe/"+recipeId, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to get the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+		var recipe db.Recipe
+		json.Unmarshal(rec.Body.Bytes(), &recipe)
+		if len(recipe.IngredientsID) != 2 {
+			t.Errorf("Wrong ingredients of the recipe: %s", rec.Body.String())
+		}
+
+		rec = doRequest(e, http.MethodPost, "/recipe/"+recipeId+"/ingredient/000000000000000000000003", `{"amount":3,"unit":"i"}`)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Failed to add an ingredient to the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodPost, "/recipe/"+recipeId+"/ingredient/000000000000000000000003", `{"amount":1,"unit":"i"}`); rec.Code != http.StatusOK {
+			t.Errorf("The quantity merged with the saved ones should not be created: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/recipe/"+recipeId, "")
+		json.Unmarshal(rec.Body.Bytes(), &recipe)
+		if !slices.Contains(recipe.IngredientsID, "000000000000000000000003") {
+			t.Errorf("The ingredient should be added to the recipe: %s", rec.Body.String())
+		}
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000001", `{"amount":50,"unit":"g"}`)
+		rec = doRequest(e, http.MethodGet, "/recipe/"+recipeId+"/ingredient/000000000000000000000001", "")
+		var ingredient db.Ingredient
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if rec.Code != http.StatusOK || len(ingredient.Quantities) != 1 || ingredient.Quantities[0].Amount != 100 {
+			t.Errorf("Only the quantity of the recipe should be returned: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/recipe/"+recipeId+"/ingredient/000000000000000000000004", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found for an ingredient out of the recipe: %d", rec.Code)
+		}
+
+		if rec := doRequest(e, http.MethodDelete, "/recipe/"+recipeId+"/ingredient/000000000000000000000002", ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("Failed to remove the ingredient of the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/ingredient/000000000000000000000002", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The ingredient only used by the recipe should be removed: %d", rec.Code)
+		}
+		rec = doRequest(e, http.MethodGet, "/recipe/"+recipeId, "")
+		json.Unmarshal(rec.Body.Bytes(), &recipe)
+		if slices.Contains(recipe.IngredientsID, "000000000000000000000002") {
+			t.Errorf("The ingredient should be removed from the recipe: %s", rec.Body.String())
+		}
+
+		if rec := doRequest(e, http.MethodDelete, "/recipe/"+recipeId, ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("Failed to remove the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/recipe/"+recipeId, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The recipe should be removed: %d", rec.Code)
+		}
+		rec = doRequest(e, http.MethodGet, "/ingredient/000000000000000000000001", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if rec.Code != http.StatusOK || len(ingredient.Quantities) != 1 || ingredient.Quantities[0].Amount != 50 {
+			t.Errorf("The quantity added without recipe should be kept: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/ingredient/000000000000000000000003", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("The ingredient added to the recipe should be removed with it: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodDelete, "/recipe/"+recipeId, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found for a removed recipe: %d", rec.Code)
+		}
+	})
+
+	t.Run("Get the shopping list at a past time", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		time.Sleep(2 * time.Millisecond)
+		at := time.Now().UTC().Format(time.RFC3339Nano)
+		time.Sleep(2 * time.Millisecond)
+		if rec := doRequest(e, http.MethodDelete, "/recipe/000000000000000000000001", ""); rec.Code != http.StatusNoContent {
+			t.Fatalf("Failed to remove the recipe: %d %s", rec.Code, rec.Body.String())
+		}
+
+		var ingredients []db.Ingredient
+		rec := doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 0 {
+			t.Errorf("The current list should be empty: %s", rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/shopping-list?at="+url.QueryEscape(at), "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if rec.Code != http.StatusOK || len(ingredients) != 2 || ingredients[0].Quantities[0].Amount != 100 {
+			t.Errorf("The list should be rebuilt as it was: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodGet, "/shopping-list?at=yesterday", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("The time should be validated: %d", rec.Code)
+		}
+
+		var events []db.Event
+		rec = doRequest(e, http.MethodGet, "/shopping-list/events", "")
+		json.Unmarshal(rec.Body.Bytes(), &events)
+		if rec.Code != http.StatusOK || len(events) != 2 || events[0].Type != db.RecipeAdded || events[1].Type != db.RecipeRemoved {
+			t.Errorf("Wrong events: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/shopping-list/events?until="+url.QueryEscape(at), "")
+		json.Unmarshal(rec.Body.Bytes(), &events)
+		if len(events) != 1 {
+			t.Errorf("Only the events before the time should be returned: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("Undo and redo the last operations", func(t *testing.T) {
+		_, e := setupMemoryTest(t)
+
+		if rec := doRequest(e, http.MethodPost, "/shopping-list/undo", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("Expected not found without operation: %d", rec.Code)
+		}
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000001", `{"amount":200,"unit":"g"}`)
+		body := `{"id":"000000000000000000000001","userId":"1","ingredients":[
+			{"id":"000000000000000000000001","amount":100,"unit":"g"},
+			{"id":"000000000000000000000002","amount":2,"unit":"i"}]}`
+		doRequest(e, http.MethodPost, "/recipe", body)
+		doRequest(e, http.MethodPost, "/recipe", body)
+
+		var operations []OperationResponse
+		rec := doRequest(e, http.MethodPost, "/shopping-list/undo?steps=2", "")
+		json.Unmarshal(rec.Body.Bytes(), &operations)
+		if rec.Code != http.StatusOK || len(operations) != 2 || operations[0].Type != db.RecipeAdded {
+			t.Fatalf("Failed to undo the recipes: %d %s", rec.Code, rec.Body.String())
+		}
+		var ingredients []db.Ingredient
+		rec = doRequest(e, http.MethodGet, "/shopping-list", "")
+		json.Unmarshal(rec.Body.Bytes(), &ingredients)
+		if len(ingredients) != 1 || len(ingredients[0].Quantities) != 1 || ingredients[0].Quantities[0].Amount != 200 {
+			t.Errorf("Only the ingredient added before the recipes should stay: %s", rec.Body.String())
+		}
+
+		rec = doRequest(e, http.MethodPost, "/shopping-list/redo?steps=5", "")
+		json.Unmarshal(rec.Body.Bytes(), &operations)
+		if rec.Code != http.StatusOK || len(operations) != 2 {
+			t.Errorf("The redo should stop after the undone operations: %d %s", rec.Code, rec.Body.String())
+		}
+		rec = doRequest(e, http.MethodGet, "/ingredient/000000000000000000000001", "")
+		var ingredient db.Ingredient
+		json.Unmarshal(rec.Body.Bytes(), &ingredient)
+		if len(ingredient.Quantities) != 2 || ingredient.Quantities[1].Amount != 200 {
+			t.Errorf("The merged quantities should be redone: %s", rec.Body.String())
+		}
+
+		// Another member changed the ingredient since
+		rec = doRequest(e, http.MethodPost, "/shopping-list/lists", `{"name":"Party"}`)
+		var list db.List
+		json.Unmarshal(rec.Body.Bytes(), &list)
+		doRequest(e, http.MethodPut, "/shopping-list/"+list.ID+"/members/2", `{"role":"editor"}`)
+		doRequest(e, http.MethodPost, "/ingredient/000000000000000000000003?listId="+list.ID, `{"amount":1,"unit":"i"}`)
+		doRequestAs(e, "2", http.MethodPost, "/ingredient/000000000000000000000003?listId="+list.ID, `{"amount":1,"unit":"i"}`)
+		if rec := doRequest(e, http.MethodPost, "/shopping-list/"+list.ID+"/undo", ""); rec.Code != http.StatusConflict {
+			t.Errorf("Expected a conflict: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequestAs(e, "2", http.MethodPost, "/shopping-list/"+list.ID+"/undo", ""); rec.Code != http.StatusOK {
+			t.Errorf("Failed to undo the operation of the member: %d %s", rec.Code, rec.Body.String())
+		}
+		if rec := doRequest(e, http.MethodPost, "/shopping-list/undo?steps=51", ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("The steps should be validated: %d", rec.Code)
+		}
+	})
+}
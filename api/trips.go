@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"shopping-list/db"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (api *ApiHandler) completeTrip(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "completeTrip")
+	defer span.End()
+	l := logger.WithField("request", "completeTrip").WithContext(ctx)
+
+	userId := userID(c)
+	list, err := api.getList(ctx, userId, c.Param("listId"), db.RoleEditor)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	trip, err := api.store.CompleteTrip(ctx, list.Namespace(), userId)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to complete the trip")
+		return NewStoreError(err)
+	}
+	l.WithFields(logrus.Fields{
+		"listId":      list.ID,
+		"tripId":      trip.ID,
+		"ingredients": len(trip.Ingredients),
+	}).Info("Trip completed")
+	span.SetAttributes(attribute.Int("ingredients.count", len(trip.Ingredients)))
+	return c.JSON(http.StatusCreated, trip)
+}
+
+func (api *ApiHandler) getTrips(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getTrips")
+	defer span.End()
+	l := logger.WithField("request", "getTrips").WithContext(ctx)
+
+	params := new(HistoryRequest)
+	if err := c.Bind(params); err != nil {
+		FailOnError(l, err, "Binding parameters failed")
+		return NewBadRequestError(err)
+	}
+	if err := c.Validate(params); err != nil {
+		FailOnError(l, err, "Validation failed")
+		return NewBadRequestError(err)
+	}
+	if params.Limit == 0 {
+		params.Limit = DefaultHistoryLimit
+	}
+
+	list, err := api.getList(ctx, userID(c), c.Param("listId"), db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	trips, err := api.store.GetTrips(ctx, list.Namespace(), params.Limit)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the trips")
+		return NewStoreError(err)
+	}
+	span.SetAttributes(attribute.Int("trips.count", len(trips)))
+	return c.JSON(http.StatusOK, trips)
+}
+
+func (api *ApiHandler) getTrip(c echo.Context) error {
+	ctx, span := api.tracer.Start(c.Request().Context(), "getTrip")
+	defer span.End()
+	l := logger.WithField("request", "getTrip").WithContext(ctx)
+
+	list, err := api.getList(ctx, userID(c), c.Param("listId"), db.RoleViewer)
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the list")
+		return NewStoreError(err)
+	}
+	trip, err := api.store.GetTrip(ctx, list.Namespace(), c.Param("tripId"))
+	if err != nil {
+		span.SetAttributes(attribute.String("err", err.Error()))
+		FailOnError(l, err, "Failed to get the trip")
+		return NewStoreError(err)
+	}
+	return c.JSON(http.StatusOK, trip)
+}
@@ -3,6 +3,8 @@ package configuration
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,12 +18,27 @@ type Configuration struct {
 	ListenAddress       string
 	ListenRoute         string
 	LogLevel            logrus.Level
+	DBBackend           string
 	DBAddr              string
 	DBPassword          string
 	TranslateValidation bool
 	RabbitURI           string
 	JWTSecret           string
-	OtelServiceName     string
+	// Optional JWKS file of the keys verifying the RS256 tokens
+	JWKSFile        string
+	OtelServiceName string
+	// Optional JSON file of the densities of the ingredients, see units.LoadDensities
+	DensitiesFile string
+	// Base URL of the Recipe MS
+	RecipeServiceURL string
+	// Base URL of the Catalog MS
+	CatalogServiceURL string
+	// Time the ingredients of the catalog are cached, services.DefaultCatalogCacheTTL when 0
+	CatalogCacheTTL time.Duration
+	// Default order of the aisles, as ingredient types, services.IngredientTypes when empty
+	AisleOrder []string
+	// Timeout of each request to the other microservices, services.DefaultTimeout when 0
+	ServiceTimeout time.Duration
 }
 
 func New() *Configuration {
@@ -53,6 +70,14 @@ func New() *Configuration {
 	conf.ListenAddress = os.Getenv("API_ADDRESS")
 	conf.ListenRoute = os.Getenv("API_ROUTE")
 
+	conf.DBBackend = os.Getenv("DB_BACKEND")
+	if conf.DBBackend == "" {
+		conf.DBBackend = "redis"
+	}
+	if conf.DBBackend != "redis" && conf.DBBackend != "memory" {
+		logger.Error("DB_BACKEND must be either `redis` or `memory`")
+		os.Exit(1)
+	}
 	conf.DBAddr = os.Getenv("REDIS_ADDR")
 	conf.DBPassword = os.Getenv("REDIS_PASSWORD")
 
@@ -66,7 +91,32 @@ func New() *Configuration {
 	}
 
 	conf.JWTSecret = os.Getenv("JWT_SECRET")
+	conf.JWKSFile = os.Getenv("JWKS_FILE")
 	conf.OtelServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	conf.DensitiesFile = os.Getenv("DENSITIES_FILE")
+
+	conf.RecipeServiceURL = os.Getenv("RECIPE_SERVICE_URL")
+	conf.CatalogServiceURL = os.Getenv("CATALOG_SERVICE_URL")
+	if aisles := os.Getenv("AISLE_ORDER"); aisles != "" {
+		conf.AisleOrder = strings.Split(aisles, ",")
+		for i, aisle := range conf.AisleOrder {
+			conf.AisleOrder[i] = strings.TrimSpace(aisle)
+		}
+	}
+	if ttl := os.Getenv("CATALOG_CACHE_TTL"); ttl != "" {
+		conf.CatalogCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			logger.Error("Failed to parse duration for CATALOG_CACHE_TTL")
+			os.Exit(1)
+		}
+	}
+	if timeout := os.Getenv("SERVICE_TIMEOUT"); timeout != "" {
+		conf.ServiceTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			logger.Error("Failed to parse duration for SERVICE_TIMEOUT")
+			os.Exit(1)
+		}
+	}
 
 	return &conf
 }
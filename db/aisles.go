@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// aislesKey is the list of the ingredient types in the order of the aisles of the favourite store of the user
+func aislesKey(userId string) string {
+	return userKey(userId) + ":aisles"
+}
+
+func (r *RedisStore) GetAisleOrder(ctx context.Context, userId string) ([]string, error) {
+	aisles, err := r.rdb.LRange(ctx, aislesKey(userId), 0, -1).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the aisle order of user: " + userId)
+		return nil, err
+	}
+	if len(aisles) == 0 {
+		return nil, ErrNotFound
+	}
+	return aisles, nil
+}
+
+func (r *RedisStore) SetAisleOrder(ctx context.Context, userId string, aisles []string) error {
+	values := make([]interface{}, len(aisles))
+	for i, aisle := range aisles {
+		values[i] = aisle
+	}
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, aislesKey(userId))
+		pipe.RPush(ctx, aislesKey(userId), values...)
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to set the aisle order of user: " + userId)
+	}
+	return err
+}
+
+func (r *RedisStore) RemoveAisleOrder(ctx context.Context, userId string) error {
+	removed, err := r.rdb.Del(ctx, aislesKey(userId)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to remove the aisle order of user: " + userId)
+		return err
+	}
+	if removed == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,500 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// A backup is a portable JSON copy of the keys of Redis, each with its type and its content, so that it covers
+// every entity saved by the store, the ones to come included. The backup of a user has the keys of the user,
+// user:<userId>:*, and the keys of the lists they own, list:<listId> and list:<listId>:*. The backup of the whole
+// dataset has all the keys but the ones of the running migrations.
+const (
+	BackupFormat = "shopping-list-backup"
+	// BackupVersion is the version of the format of the backups written by this code
+	BackupVersion = 1
+)
+
+var (
+	ErrInvalidBackup = errors.New("the file is not a backup of the shopping lists")
+	// ErrBackupVersion is returned when the backup was written by a newer version, or with another data layout
+	ErrBackupVersion = errors.New("the version of the backup is not supported")
+)
+
+// Types of the keys of a backup
+const (
+	backupString = "string"
+	backupHash   = "hash"
+	backupList   = "list"
+	backupSet    = "set"
+	backupZSet   = "zset"
+	backupStream = "stream"
+)
+
+type Backup struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// SchemaVersion is the version of the data layout of the keys, see Migrate
+	SchemaVersion int       `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// User of the backup, empty for the whole dataset
+	User string      `json:"user,omitempty"`
+	Keys []BackupKey `json:"keys"`
+}
+
+// BackupKey is a key of Redis, only the field of its type is set
+type BackupKey struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	// Time to live in milliseconds, zero when the key does not expire
+	TTL    int64             `json:"ttl,omitempty"`
+	String *string           `json:"string,omitempty"`
+	Hash   map[string]string `json:"hash,omitempty"`
+	List   []string          `json:"list,omitempty"`
+	Set    []string          `json:"set,omitempty"`
+	ZSet   []BackupMember    `json:"zset,omitempty"`
+	Stream []BackupEntry     `json:"stream,omitempty"`
+}
+
+type BackupMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+type BackupEntry struct {
+	ID     string            `json:"id"`
+	Values map[string]string `json:"values"`
+}
+
+// RestoreOptions choose how the backup is restored. The restore merges the backup with the saved data by default:
+// the hashes, the sets and the sorted sets get the fields and the members of the backup, the other keys are only
+// restored when missing. Replace deletes the keys of the scope of the backup first, and removes the lists deleted or
+// left from the lists of the other members. DryRun only reports the changes.
+type RestoreOptions struct {
+	Replace bool
+	DryRun  bool
+}
+
+// RestoreReport counts the keys restored, the created keys were missing and the updated ones were already saved
+type RestoreReport struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	// Keys of the scope of the backup deleted because they are not in the backup, only when replacing
+	Deleted int `json:"deleted"`
+	// Keys already saved and kept as they are, only when merging
+	Kept int `json:"kept"`
+}
+
+// Backup copies the keys of the user, or of the whole dataset when the user is empty
+func (r *RedisStore) Backup(ctx context.Context, userId string) (*Backup, error) {
+	l := logger.WithField("method", "Backup").WithField("user", userId)
+
+	version, err := r.GetSchemaVersion(ctx)
+	if err != nil {
+		l.WithError(err).Error("Failed to get the schema version")
+		return nil, err
+	}
+	keys, err := r.backupScope(ctx, userId)
+	if err != nil {
+		l.WithError(err).Error("Failed to list the keys")
+		return nil, err
+	}
+	backup := &Backup{
+		Format:        BackupFormat,
+		Version:       BackupVersion,
+		SchemaVersion: version,
+		CreatedAt:     now(),
+		User:          userId,
+		Keys:          make([]BackupKey, 0, len(keys)),
+	}
+	for _, key := range keys {
+		saved, err := r.backupKey(ctx, key)
+		if errors.Is(err, redis.Nil) {
+			// The key expired or was deleted since the scan
+			continue
+		}
+		if err != nil {
+			l.WithError(err).WithField("key", key).Error("Failed to copy the key")
+			return nil, err
+		}
+		backup.Keys = append(backup.Keys, *saved)
+	}
+	l.WithField("keys", len(backup.Keys)).Info("Backup done")
+	return backup, nil
+}
+
+// backupScope returns the sorted keys of the user, or all the keys when the user is empty
+func (r *RedisStore) backupScope(ctx context.Context, userId string) ([]string, error) {
+	if userId == "" {
+		keys, err := r.scanKeys(ctx, "*")
+		if err != nil {
+			return nil, err
+		}
+		return slices.DeleteFunc(keys, func(key string) bool {
+			return strings.HasPrefix(key, "schema:migration:")
+		}), nil
+	}
+
+	keys, err := r.scanKeys(ctx, escapePattern(userKey(userId))+":*")
+	if err != nil {
+		return nil, err
+	}
+	// The lists are read from the index, GetLists would create the primary list of an unknown user
+	listIds, err := r.rdb.SMembers(ctx, userListsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, listId := range listIds {
+		list, err := getList(ctx, r.rdb, listId)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The lists shared with the user are backed up with their owner. The content of the primary list is in the
+		// namespace of its owner, only its record and its members are under list:<listId>.
+		if list.Owner != userId {
+			continue
+		}
+		listKeys, err := r.scanKeys(ctx, escapePattern(listKey(list.ID))+"*")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range listKeys {
+			if key == listKey(list.ID) || strings.HasPrefix(key, listKey(list.ID)+":") {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+func (r *RedisStore) scanKeys(ctx context.Context, match string) ([]string, error) {
+	keys := make([]string, 0)
+	iter := r.rdb.Scan(ctx, 0, match, scanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys), nil
+}
+
+// escapePattern escapes the special characters of the glob patterns of SCAN
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// backupKey copies the key with the content of its type, redis.Nil when the key does not exist
+func (r *RedisStore) backupKey(ctx context.Context, key string) (*BackupKey, error) {
+	keyType, err := r.rdb.Type(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	saved := &BackupKey{Key: key, Type: keyType}
+	switch keyType {
+	case "none":
+		return nil, redis.Nil
+	case backupString:
+		value, err := r.rdb.Get(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		saved.String = &value
+	case backupHash:
+		saved.Hash, err = r.rdb.HGetAll(ctx, key).Result()
+	case backupList:
+		saved.List, err = r.rdb.LRange(ctx, key, 0, -1).Result()
+	case backupSet:
+		saved.Set, err = r.rdb.SMembers(ctx, key).Result()
+		slices.Sort(saved.Set)
+	case backupZSet:
+		var members []redis.Z
+		members, err = r.rdb.ZRangeWithScores(ctx, key, 0, -1).Result()
+		for _, member := range members {
+			saved.ZSet = append(saved.ZSet, BackupMember{Member: fmt.Sprint(member.Member), Score: member.Score})
+		}
+	case backupStream:
+		var messages []redis.XMessage
+		messages, err = r.rdb.XRange(ctx, key, "-", "+").Result()
+		for _, message := range messages {
+			values := make(map[string]string, len(message.Values))
+			for field, value := range message.Values {
+				values[field] = fmt.Sprint(value)
+			}
+			saved.Stream = append(saved.Stream, BackupEntry{ID: message.ID, Values: values})
+		}
+	default:
+		return nil, fmt.Errorf("unsupported type %s of the key %s", keyType, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := r.rdb.PTTL(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ttl > 0 {
+		saved.TTL = ttl.Milliseconds()
+	}
+	return saved, nil
+}
+
+// checkBackup tells if the backup can be restored by this code. The keys are restored as they were saved,
+// so their data layout must be the current one, but for a whole dataset replaced then migrated.
+func (r *RedisStore) checkBackup(ctx context.Context, backup *Backup, options RestoreOptions) error {
+	if backup.Format != BackupFormat {
+		return ErrInvalidBackup
+	}
+	if backup.Version < 1 || backup.Version > BackupVersion {
+		return fmt.Errorf("%w: version %d, expected at most %d", ErrBackupVersion, backup.Version, BackupVersion)
+	}
+	if backup.SchemaVersion > SchemaVersion() || (backup.SchemaVersion < SchemaVersion() && (backup.User != "" || !options.Replace)) {
+		return fmt.Errorf("%w: schema version %d, expected %d", ErrBackupVersion, backup.SchemaVersion, SchemaVersion())
+	}
+	for _, key := range backup.Keys {
+		if key.Key == "" || !slices.Contains([]string{backupString, backupHash, backupList, backupSet, backupZSet, backupStream}, key.Type) {
+			return fmt.Errorf("%w: invalid key %q of type %q", ErrInvalidBackup, key.Key, key.Type)
+		}
+		if key.Type == backupString && key.String == nil {
+			return fmt.Errorf("%w: the string key %q has no value", ErrInvalidBackup, key.Key)
+		}
+	}
+	if backup.User != "" {
+		return r.checkScope(ctx, backup)
+	}
+	return nil
+}
+
+// checkScope checks that the backup of a user only has the keys of its scope, see backupScope: the keys of the user
+// and the keys of the lists the user owns, both in the backup and in the dataset. Restoring the backup of a user
+// can then never write the keys of another user.
+func (r *RedisStore) checkScope(ctx context.Context, backup *Backup) error {
+	if !ValidUserID(backup.User) {
+		return fmt.Errorf("%w: %w", ErrInvalidBackup, ErrInvalidUserID)
+	}
+	owned := make(map[string]bool)
+	for _, key := range backup.Keys {
+		listId, found := strings.CutPrefix(key.Key, "list:")
+		if !found || strings.Contains(listId, ":") {
+			continue
+		}
+		if key.Type != backupHash || key.Hash[listOwnerField] != backup.User {
+			return fmt.Errorf("%w: the list %s is not owned by the user %s", ErrInvalidBackup, listId, backup.User)
+		}
+		list, err := getList(ctx, r.rdb, listId)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err == nil && list.Owner != backup.User {
+			return fmt.Errorf("%w: the saved list %s is not owned by the user %s", ErrInvalidBackup, listId, backup.User)
+		}
+		owned[listId] = true
+	}
+	for _, key := range backup.Keys {
+		if strings.HasPrefix(key.Key, userKey(backup.User)+":") {
+			continue
+		}
+		listId, found := strings.CutPrefix(key.Key, "list:")
+		listId, _, _ = strings.Cut(listId, ":")
+		if !found || !owned[listId] {
+			return fmt.Errorf("%w: the key %q is not in the scope of the user %s", ErrInvalidBackup, key.Key, backup.User)
+		}
+	}
+	return nil
+}
+
+// Restore writes the keys of the backup in a single transaction, and migrates them when the backup of the whole
+// dataset has an older data layout
+func (r *RedisStore) Restore(ctx context.Context, backup *Backup, options RestoreOptions) (*RestoreReport, error) {
+	l := logger.WithField("method", "Restore").WithField("user", backup.User)
+
+	if err := r.checkBackup(ctx, backup, options); err != nil {
+		l.WithError(err).Error("Failed to check the backup")
+		return nil, err
+	}
+
+	report := new(RestoreReport)
+	restored := make(map[string]bool, len(backup.Keys))
+	pipe := r.rdb.Pipeline()
+	types := make([]*redis.StatusCmd, len(backup.Keys))
+	for i, key := range backup.Keys {
+		types[i] = pipe.Type(ctx, key.Key)
+		restored[key.Key] = true
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		l.WithError(err).Error("Failed to get the saved keys")
+		return nil, err
+	}
+	var deleted []string
+	var left map[string][]string
+	if options.Replace {
+		scope, err := r.backupScope(ctx, backup.User)
+		if err != nil {
+			l.WithError(err).Error("Failed to list the keys")
+			return nil, err
+		}
+		for _, key := range scope {
+			if !restored[key] {
+				deleted = append(deleted, key)
+			}
+		}
+		report.Deleted = len(deleted)
+		if backup.User != "" {
+			if left, err = r.leftMembers(ctx, backup, scope); err != nil {
+				l.WithError(err).Error("Failed to get the members of the lists")
+				return nil, err
+			}
+		}
+	}
+
+	write := func(pipe redis.Pipeliner) error {
+		// The lists of the other users are out of the scope, the lists deleted or left are removed from them
+		for member, listIds := range left {
+			pipe.SRem(ctx, userListsKey(member), listIds)
+		}
+		if len(deleted) > 0 {
+			pipe.Del(ctx, deleted...)
+		}
+		for i, key := range backup.Keys {
+			savedType := types[i].Val()
+			switch {
+			case savedType == "none":
+				report.Created++
+			case options.Replace || savedType != key.Type:
+				report.Updated++
+				pipe.Del(ctx, key.Key)
+			case key.Type == backupHash || key.Type == backupSet || key.Type == backupZSet:
+				report.Updated++
+			default:
+				// The strings, the lists and the streams already saved are kept when merging
+				report.Kept++
+				continue
+			}
+			restoreKey(ctx, pipe, key)
+			// The members of a list restored alone need to find it among their lists again
+			if listId, found := strings.CutPrefix(key.Key, "list:"); found && strings.HasSuffix(listId, ":members") && strings.Count(listId, ":") == 1 {
+				for member := range key.Hash {
+					pipe.SAdd(ctx, userListsKey(member), strings.TrimSuffix(listId, ":members"))
+				}
+			}
+		}
+		return nil
+	}
+	var err error
+	if options.DryRun {
+		// The writes are queued but never sent
+		err = write(r.rdb.TxPipeline())
+	} else {
+		_, err = r.rdb.TxPipelined(ctx, write)
+	}
+	if err != nil {
+		l.WithError(err).Error("Failed to restore the keys")
+		return nil, err
+	}
+	l.WithFields(logrus.Fields{
+		"created": report.Created,
+		"updated": report.Updated,
+		"deleted": report.Deleted,
+		"kept":    report.Kept,
+		"dryRun":  options.DryRun,
+	}).Info("Restore done")
+
+	if !options.DryRun && backup.SchemaVersion < SchemaVersion() {
+		if err := r.Migrate(ctx); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// leftMembers returns the IDs of the lists of the scope that the other users are no longer members of once the backup
+// of the user is restored, by user: the lists missing from the backup and the members missing from their list.
+func (r *RedisStore) leftMembers(ctx context.Context, backup *Backup, scope []string) (map[string][]string, error) {
+	kept := make(map[string]map[string]string)
+	for _, key := range backup.Keys {
+		kept[key.Key] = key.Hash
+	}
+	left := make(map[string][]string)
+	for _, key := range scope {
+		listId, found := strings.CutPrefix(key, "list:")
+		if !found || !strings.HasSuffix(listId, ":members") || strings.Count(listId, ":") != 1 {
+			continue
+		}
+		members, err := r.rdb.HKeys(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if _, ok := kept[key][member]; !ok && member != backup.User {
+				left[member] = append(left[member], strings.TrimSuffix(listId, ":members"))
+			}
+		}
+	}
+	return left, nil
+}
+
+// restoreKey queues the writes of the content of the key
+func restoreKey(ctx context.Context, pipe redis.Pipeliner, key BackupKey) {
+	switch key.Type {
+	case backupString:
+		pipe.Set(ctx, key.Key, *key.String, 0)
+	case backupHash:
+		if len(key.Hash) > 0 {
+			pipe.HSet(ctx, key.Key, key.Hash)
+		}
+	case backupList:
+		if len(key.List) > 0 {
+			values := make([]interface{}, len(key.List))
+			for i, value := range key.List {
+				values[i] = value
+			}
+			pipe.RPush(ctx, key.Key, values...)
+		}
+	case backupSet:
+		if len(key.Set) > 0 {
+			members := make([]interface{}, len(key.Set))
+			for i, member := range key.Set {
+				members[i] = member
+			}
+			pipe.SAdd(ctx, key.Key, members...)
+		}
+	case backupZSet:
+		members := make([]redis.Z, len(key.ZSet))
+		for i, member := range key.ZSet {
+			members[i] = redis.Z{Member: member.Member, Score: member.Score}
+		}
+		if len(members) > 0 {
+			pipe.ZAdd(ctx, key.Key, members...)
+		}
+	case backupStream:
+		for _, entry := range key.Stream {
+			values := make(map[string]interface{}, len(entry.Values))
+			for field, value := range entry.Values {
+				values[field] = value
+			}
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: key.Key, ID: entry.ID, Values: values})
+		}
+	}
+	if key.TTL > 0 {
+		pipe.PExpire(ctx, key.Key, time.Duration(key.TTL)*time.Millisecond)
+	}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Since the schema version 2, the ingredients and the recipes are saved as Redis hashes.
+//
+// <namespace>:ingredient:<ingredientId> has one field per quantity line, q:<unit>:<recipeId> -> amount,
+// and the checked_by and checked_at fields once the ingredient is checked.
+// <namespace>:recipe:<recipeId> has one field per ingredient, i:<ingredientId> -> position in the recipe,
+// and the created_at and updated_at metadata.
+const (
+	quantityFieldPrefix   = "q:"
+	ingredientFieldPrefix = "i:"
+	createdAtField        = "created_at"
+	updatedAtField        = "updated_at"
+	checkedByField        = "checked_by"
+	checkedAtField        = "checked_at"
+)
+
+func encodeQuantities(quantities []Quantity) map[string]string {
+	fields := make(map[string]string, len(quantities))
+	for _, quantity := range quantities {
+		fields[quantityFieldPrefix+quantity.Unit+":"+quantity.RecipeID] = strconv.FormatFloat(quantity.Amount, 'f', -1, 64)
+	}
+	return fields
+}
+
+func decodeQuantities(fields map[string]string) ([]Quantity, error) {
+	quantities := make([]Quantity, 0, len(fields))
+	for field, value := range fields {
+		if !strings.HasPrefix(field, quantityFieldPrefix) {
+			continue
+		}
+		unit, recipeId, _ := strings.Cut(strings.TrimPrefix(field, quantityFieldPrefix), ":")
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		quantities = append(quantities, Quantity{
+			Amount:   amount,
+			Unit:     unit,
+			RecipeID: recipeId,
+		})
+	}
+	return sortQuantities(quantities), nil
+}
+
+func encodeIngredient(quantities []Quantity, c *check) map[string]string {
+	fields := encodeQuantities(quantities)
+	if c != nil && len(fields) > 0 {
+		fields[checkedByField] = c.by
+		fields[checkedAtField] = c.at.Format(time.RFC3339Nano)
+	}
+	return fields
+}
+
+func decodeIngredient(ingredientId string, fields map[string]string) (*Ingredient, error) {
+	quantities, err := decodeQuantities(fields)
+	if err != nil {
+		return nil, err
+	}
+	var c *check
+	if checkedAt, ok := fields[checkedAtField]; ok {
+		at, err := time.Parse(time.RFC3339Nano, checkedAt)
+		if err != nil {
+			return nil, err
+		}
+		c = &check{by: fields[checkedByField], at: at}
+	}
+	return newIngredient(ingredientId, quantities, c), nil
+}
+
+func encodeRecipe(recipe Recipe) map[string]string {
+	fields := make(map[string]string, len(recipe.IngredientsID)+2)
+	for i, id := range recipe.IngredientsID {
+		fields[ingredientFieldPrefix+id] = strconv.Itoa(i)
+	}
+	fields[createdAtField] = recipe.CreatedAt.Format(time.RFC3339Nano)
+	fields[updatedAtField] = recipe.UpdatedAt.Format(time.RFC3339Nano)
+	return fields
+}
+
+func decodeRecipe(fields map[string]string) (Recipe, error) {
+	recipe := Recipe{}
+	positions := make(map[string]int)
+	var err error
+	for field, value := range fields {
+		switch {
+		case strings.HasPrefix(field, ingredientFieldPrefix):
+			id := strings.TrimPrefix(field, ingredientFieldPrefix)
+			if positions[id], err = strconv.Atoi(value); err != nil {
+				return recipe, err
+			}
+			recipe.IngredientsID = append(recipe.IngredientsID, id)
+		case field == createdAtField:
+			if recipe.CreatedAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return recipe, err
+			}
+		case field == updatedAtField:
+			if recipe.UpdatedAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				return recipe, err
+			}
+		}
+	}
+	slices.SortFunc(recipe.IngredientsID, func(a, b string) int {
+		return positions[a] - positions[b]
+	})
+	return recipe, nil
+}
+
+// saveHash queues the writes turning the before fields of the hash into the after ones,
+// only the fields that changed are written
+func saveHash(ctx context.Context, pipe redis.Pipeliner, key string, before map[string]string, after map[string]string) {
+	if len(after) == 0 {
+		pipe.Del(ctx, key)
+		return
+	}
+
+	removed := make([]string, 0)
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			removed = append(removed, field)
+		}
+	}
+	if len(removed) > 0 {
+		pipe.HDel(ctx, key, removed...)
+	}
+
+	changed := make(map[string]interface{})
+	for field, value := range after {
+		if saved, ok := before[field]; !ok || saved != value {
+			changed[field] = value
+		}
+	}
+	if len(changed) > 0 {
+		pipe.HSet(ctx, key, changed)
+	}
+}
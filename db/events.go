@@ -0,0 +1,208 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Every mutation of a list is appended as an event to the stream of its namespace, in the same transaction
+// as the change of the state. The content of the list is a projection of its events: replaying the events
+// of the stream, in order, rebuilds the state at any time.
+//
+// <namespace>:events is a Redis stream, each entry has the fields type and data, the JSON of the Event.
+// The streams are not trimmed: the projection replays a stream from its first event, a trimmed stream would lose
+// the content of the list. A stream is deleted with its list.
+func eventsKey(ns string) string {
+	return ns + ":events"
+}
+
+type EventType string
+
+const (
+	RecipeAdded                 EventType = "RecipeAdded"
+	RecipeRemoved               EventType = "RecipeRemoved"
+	IngredientAdded             EventType = "IngredientAdded"
+	QuantityRemoved             EventType = "QuantityRemoved"
+	IngredientRemovedFromRecipe EventType = "IngredientRemovedFromRecipe"
+	ItemChecked                 EventType = "ItemChecked"
+	TripCompleted               EventType = "TripCompleted"
+	// OperationUndone and OperationRedone set the entities changed by an operation of the journal, see Patch
+	OperationUndone EventType = "OperationUndone"
+	OperationRedone EventType = "OperationRedone"
+	// ListSnapshot sets the recipes and the ingredients as they were saved before the events were recorded
+	ListSnapshot EventType = "ListSnapshot"
+)
+
+// Event is a mutation of a list, with what is needed to apply it again on the state
+type Event struct {
+	// ID of the entry in the stream, <milliseconds>-<sequence>
+	ID     string    `json:"id"`
+	Type   EventType `json:"type"`
+	At     time.Time `json:"at"`
+	UserID string    `json:"user_id,omitempty"`
+
+	RecipeID     string `json:"recipe_id,omitempty"`
+	IngredientID string `json:"ingredient_id,omitempty"`
+	// Quantities added to the ingredient
+	Quantities []Quantity `json:"quantities,omitempty"`
+	// Ingredients of the recipe added to the list once taken from the pantry, or moved to the trip,
+	// or saved in the snapshot
+	Ingredients []Ingredient      `json:"ingredients,omitempty"`
+	Recipe      *Recipe           `json:"recipe,omitempty"`
+	Recipes     map[string]Recipe `json:"recipes,omitempty"`
+	All         bool              `json:"all,omitempty"`
+	Checked     bool              `json:"checked,omitempty"`
+	TripID      string            `json:"trip_id,omitempty"`
+	// Operation of the journal undone or redone, with the entities it sets
+	OperationID string `json:"operation_id,omitempty"`
+	Patch       *Patch `json:"patch,omitempty"`
+}
+
+// record adds the event of the operation, saved by the store with the changes of the state
+func (s *listState) record(event Event) {
+	event.At = s.now()
+	s.events = append(s.events, event)
+}
+
+// apply replays the event on the state, at the time of the event
+func (s *listState) apply(event Event) error {
+	s.clock = event.At
+	switch event.Type {
+	case RecipeAdded:
+		if event.Recipe == nil || len(event.Recipe.IngredientsID) != len(event.Ingredients) {
+			return fmt.Errorf("invalid event %s: the ingredients do not match the recipe", event.ID)
+		}
+		s.addRecipe(event.RecipeID, event.Recipe, event.Ingredients)
+		return nil
+	case RecipeRemoved:
+		return s.removeRecipe(event.RecipeID)
+	case IngredientAdded:
+		_, _, err := s.addIngredient(event.IngredientID, Ingredient{Quantities: event.Quantities})
+		return err
+	case QuantityRemoved:
+		return s.removeIngredient(event.IngredientID, event.RecipeID, event.All)
+	case IngredientRemovedFromRecipe:
+		return s.removeIngredientFromRecipe(event.IngredientID, event.RecipeID)
+	case ItemChecked:
+		_, err := s.checkIngredient(event.IngredientID, event.UserID, event.Checked)
+		return err
+	case TripCompleted:
+		ingredientIDs := make([]string, len(event.Ingredients))
+		for i, ingredient := range event.Ingredients {
+			ingredientIDs[i] = ingredient.ID
+		}
+		_, err := s.closeTrip(event.TripID, event.UserID, ingredientIDs)
+		return err
+	case OperationUndone, OperationRedone:
+		if event.Patch == nil {
+			return fmt.Errorf("invalid event %s: missing patch", event.ID)
+		}
+		s.setPatch(*event.Patch)
+		return nil
+	case ListSnapshot:
+		for id, recipe := range event.Recipes {
+			s.recipes[id] = recipe
+		}
+		for _, ingredient := range event.Ingredients {
+			delete(s.checks, ingredient.ID)
+			s.setIngredient(&ingredient)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid event %s: unknown type %s", event.ID, event.Type)
+}
+
+// replay builds the state of the list from its events, it fails on the first event that cannot be applied
+// since the state would not be the one of the list
+func replay(events []Event, state *listState) (*listState, error) {
+	for _, event := range events {
+		if err := state.apply(event); err != nil {
+			logger.WithFields(logrus.Fields{
+				"event": event.ID,
+				"type":  event.Type,
+			}).WithError(err).Error("Failed to replay the event")
+			return nil, fmt.Errorf("failed to replay the event %s: %w", event.ID, err)
+		}
+	}
+	state.clock = time.Time{}
+	state.events = nil
+	return state, nil
+}
+
+func encodeEvent(event Event) (map[string]interface{}, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"type": string(event.Type), "data": string(data)}, nil
+}
+
+func decodeEvent(message redis.XMessage) (Event, error) {
+	var event Event
+	data, _ := message.Values["data"].(string)
+	if err := json.Unmarshal([]byte(data), &event); err != nil {
+		return event, err
+	}
+	event.ID = message.ID
+	return event, nil
+}
+
+// saveEvents queues the events of the operation at the end of the stream of the list
+func saveEvents(ctx context.Context, pipe redis.Pipeliner, ns string, events []Event) error {
+	for _, event := range events {
+		values, err := encodeEvent(event)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: eventsKey(ns), Values: values})
+	}
+	return nil
+}
+
+// GetEvents returns the events of the list recorded until the given time, all of them when until is zero.
+// The stream is read in order up to the first event recorded after until, by the time of the event like the MemoryStore.
+func (r *RedisStore) GetEvents(ctx context.Context, ns string, until time.Time) ([]Event, error) {
+	events := make([]Event, 0)
+	start := "-"
+	for {
+		messages, err := r.rdb.XRangeN(ctx, eventsKey(ns), start, "+", scanCount).Result()
+		if err != nil {
+			logger.WithError(err).Error("Failed to get the events")
+			return nil, err
+		}
+		for _, message := range messages {
+			event, err := decodeEvent(message)
+			if err != nil {
+				logger.WithField("event", message.ID).WithError(err).Error("Failed to decode the event")
+				return nil, err
+			}
+			if !until.IsZero() && event.At.After(until) {
+				return events, nil
+			}
+			events = append(events, event)
+		}
+		if len(messages) < scanCount {
+			return events, nil
+		}
+		// The next page starts after the last entry read
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+func (r *RedisStore) GetShoppingListAt(ctx context.Context, ns string, at time.Time) (*[]Ingredient, error) {
+	events, err := r.GetEvents(ctx, ns, at)
+	if err != nil {
+		return nil, err
+	}
+	state, err := replay(events, newListState())
+	if err != nil {
+		return nil, err
+	}
+	ingredients := state.shoppingList()
+	return &ingredients, nil
+}
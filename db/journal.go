@@ -0,0 +1,362 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The operations made by a user on a list are recorded in the journal of the user, with the entities they changed
+// as they were before and after the operation. Undoing an operation sets the entities back to their values before,
+// redoing it sets them again to their values after: the revert is exact, whatever the merges of the quantities.
+//
+// <namespace>:journal:<userId> is the Redis list of the operations to undo, the most recent first, and
+// <namespace>:journal:<userId>:redo the list of the undone operations to redo. A new operation clears the redo list.
+func journalKey(ns string, userId string) string {
+	return ns + ":journal:" + userId
+}
+
+func redoKey(ns string, userId string) string {
+	return journalKey(ns, userId) + ":redo"
+}
+
+// MaxJournalOperations is the number of operations kept in the journal of a user on a list
+const MaxJournalOperations = 50
+
+// ErrJournalConflict is returned when an entity changed by the operation to revert was changed again since
+var ErrJournalConflict = errors.New("the list changed since the operation")
+
+type userContextKey struct{}
+
+// WithUser returns the context of the operations made by the user, only they are recorded in the journal
+func WithUser(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, userContextKey{}, userId)
+}
+
+// UserFromContext returns the user making the operations, empty when there is none
+func UserFromContext(ctx context.Context) string {
+	userId, _ := ctx.Value(userContextKey{}).(string)
+	return userId
+}
+
+// Operation is a mutation of a list with the entities it changed, as they were before and after it
+type Operation struct {
+	ID string `json:"id"`
+	// Type of the first event of the operation
+	Type   EventType `json:"type"`
+	At     time.Time `json:"at"`
+	Before Patch     `json:"before"`
+	After  Patch     `json:"after"`
+}
+
+// Patch is the content of some entities of a list, a nil entity is absent from the list.
+// The pantry is the one of the user of the operation, an empty item is absent from the pantry.
+type Patch struct {
+	Ingredients map[string]*Ingredient `json:"ingredients,omitempty"`
+	Recipes     map[string]*Recipe     `json:"recipes,omitempty"`
+	Trips       map[string]*Trip       `json:"trips,omitempty"`
+	Pantry      map[string][]Quantity  `json:"pantry,omitempty"`
+}
+
+func newPatch() Patch {
+	return Patch{
+		Ingredients: make(map[string]*Ingredient),
+		Recipes:     make(map[string]*Recipe),
+		Trips:       make(map[string]*Trip),
+		Pantry:      make(map[string][]Quantity),
+	}
+}
+
+func (p Patch) empty() bool {
+	return len(p.Ingredients) == 0 && len(p.Recipes) == 0 && len(p.Trips) == 0 && len(p.Pantry) == 0
+}
+
+// newOperation returns the operation changing the before state to the state, nil when nothing changed
+func newOperation(before *listState, state *listState) *Operation {
+	if len(state.events) == 0 {
+		return nil
+	}
+	op := &Operation{
+		ID:     newID(),
+		Type:   state.events[0].Type,
+		At:     state.events[0].At,
+		Before: newPatch(),
+		After:  newPatch(),
+	}
+	for _, id := range state.changedIngredients(before) {
+		op.Before.Ingredients[id] = before.ingredientOrNil(id)
+		op.After.Ingredients[id] = state.ingredientOrNil(id)
+	}
+	for _, id := range state.changedRecipes(before) {
+		op.Before.Recipes[id] = before.recipeOrNil(id)
+		op.After.Recipes[id] = state.recipeOrNil(id)
+	}
+	for _, id := range state.changedTrips(before) {
+		op.Before.Trips[id] = before.tripOrNil(id)
+		op.After.Trips[id] = state.tripOrNil(id)
+	}
+	if state.pantry != nil {
+		for id := range state.pantry {
+			if !slices.Equal(before.pantry[id], state.pantry[id]) {
+				op.Before.Pantry[id] = slices.Clone(before.pantry[id])
+				op.After.Pantry[id] = slices.Clone(state.pantry[id])
+			}
+		}
+		for id := range before.pantry {
+			if _, ok := state.pantry[id]; !ok {
+				op.Before.Pantry[id] = slices.Clone(before.pantry[id])
+				op.After.Pantry[id] = nil
+			}
+		}
+	}
+	if op.After.empty() {
+		return nil
+	}
+	return op
+}
+
+func (s *listState) ingredientOrNil(ingredientId string) *Ingredient {
+	ingredient, err := s.getIngredient(ingredientId)
+	if err != nil {
+		return nil
+	}
+	return ingredient
+}
+
+func (s *listState) recipeOrNil(recipeId string) *Recipe {
+	recipe, err := s.getRecipe(recipeId)
+	if err != nil {
+		return nil
+	}
+	return recipe
+}
+
+func (s *listState) tripOrNil(tripId string) *Trip {
+	trip, ok := s.trips[tripId]
+	if !ok {
+		return nil
+	}
+	return &trip
+}
+
+// changedTrips returns the trips completed or removed since the before state
+func (s *listState) changedTrips(before *listState) []string {
+	ids := make([]string, 0)
+	for _, trip := range s.newTrips(before) {
+		ids = append(ids, trip.ID)
+	}
+	for _, trip := range before.newTrips(s) {
+		ids = append(ids, trip.ID)
+	}
+	return ids
+}
+
+func sameIngredient(a *Ingredient, b *Ingredient) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Checked != b.Checked || a.CheckedBy != b.CheckedBy || (a.CheckedAt == nil) != (b.CheckedAt == nil) {
+		return false
+	}
+	return slices.Equal(a.Quantities, b.Quantities) && (a.CheckedAt == nil || a.CheckedAt.Equal(*b.CheckedAt))
+}
+
+// revert sets the entities of the from patch to their values in the to patch.
+// It returns ErrJournalConflict when one of them is not as in the from patch anymore.
+func (s *listState) revert(op *Operation, from Patch, to Patch, eventType EventType) error {
+	for id, ingredient := range from.Ingredients {
+		if !sameIngredient(s.ingredientOrNil(id), ingredient) {
+			return ErrJournalConflict
+		}
+	}
+	for id, recipe := range from.Recipes {
+		saved := s.recipeOrNil(id)
+		if (saved == nil) != (recipe == nil) || (saved != nil && !saved.equal(*recipe)) {
+			return ErrJournalConflict
+		}
+	}
+	for id, trip := range from.Trips {
+		if (s.tripOrNil(id) == nil) != (trip == nil) {
+			return ErrJournalConflict
+		}
+	}
+	if s.pantry != nil {
+		for id, quantities := range from.Pantry {
+			if !slices.Equal(s.pantry[id], quantities) {
+				return ErrJournalConflict
+			}
+		}
+	}
+
+	s.setPatch(to)
+	// The pantry is not a part of the list
+	patch := to
+	patch.Pantry = nil
+	s.record(Event{Type: eventType, OperationID: op.ID, Patch: &patch})
+	return nil
+}
+
+// setPatch sets the entities to their values in the patch
+func (s *listState) setPatch(patch Patch) {
+	for id, ingredient := range patch.Ingredients {
+		delete(s.ingredients, id)
+		delete(s.checks, id)
+		if ingredient != nil {
+			c := *ingredient
+			c.Quantities = slices.Clone(ingredient.Quantities)
+			s.setIngredient(&c)
+		}
+	}
+	for id, recipe := range patch.Recipes {
+		delete(s.recipes, id)
+		if recipe != nil {
+			c := *recipe
+			c.IngredientsID = slices.Clone(recipe.IngredientsID)
+			s.recipes[id] = c
+		}
+	}
+	for id, trip := range patch.Trips {
+		delete(s.trips, id)
+		if trip != nil {
+			s.trips[id] = *trip
+		}
+	}
+	if s.pantry != nil {
+		for id, quantities := range patch.Pantry {
+			delete(s.pantry, id)
+			if len(quantities) > 0 {
+				s.pantry[id] = slices.Clone(quantities)
+			}
+		}
+	}
+}
+
+// keys returns the ingredients, the recipes and the trips changed by the operation
+func (op *Operation) keys() (ingredientIDs []string, recipeIDs []string, tripIDs []string) {
+	for id := range op.After.Ingredients {
+		ingredientIDs = append(ingredientIDs, id)
+	}
+	for id := range op.After.Recipes {
+		recipeIDs = append(recipeIDs, id)
+	}
+	for id := range op.After.Trips {
+		tripIDs = append(tripIDs, id)
+	}
+	slices.Sort(ingredientIDs)
+	slices.Sort(recipeIDs)
+	slices.Sort(tripIDs)
+	return ingredientIDs, recipeIDs, tripIDs
+}
+
+// saveOperation queues the operation at the top of the journal of the user, and clears the operations to redo
+func saveOperation(ctx context.Context, pipe redis.Pipeliner, ns string, userId string, op *Operation) error {
+	value, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	pipe.LPush(ctx, journalKey(ns, userId), value)
+	pipe.LTrim(ctx, journalKey(ns, userId), 0, MaxJournalOperations-1)
+	pipe.Del(ctx, redoKey(ns, userId))
+	return nil
+}
+
+func (r *RedisStore) Undo(ctx context.Context, ns string, userId string) (*Operation, error) {
+	return r.revertOperation(ctx, ns, userId, true)
+}
+
+func (r *RedisStore) Redo(ctx context.Context, ns string, userId string) (*Operation, error) {
+	return r.revertOperation(ctx, ns, userId, false)
+}
+
+// revertOperation moves the top operation of the journal to the redo list and sets back its entities as they were
+// before the operation, or moves the top operation of the redo list back to the journal and sets its entities again
+func (r *RedisStore) revertOperation(ctx context.Context, ns string, userId string, undo bool) (*Operation, error) {
+	from, to, eventType := journalKey(ns, userId), redoKey(ns, userId), OperationUndone
+	if !undo {
+		from, to, eventType = to, from, OperationRedone
+	}
+
+	var op *Operation
+	txf := func(tx *redis.Tx) error {
+		value, err := tx.LIndex(ctx, from, 0).Result()
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		op = new(Operation)
+		if err := json.Unmarshal([]byte(value), op); err != nil {
+			return err
+		}
+		current, target := op.After, op.Before
+		if !undo {
+			current, target = op.Before, op.After
+		}
+
+		ingredientIDs, recipeIDs, tripIDs := op.keys()
+		keys := make([]string, 0, len(ingredientIDs)+len(recipeIDs)+1)
+		for _, id := range ingredientIDs {
+			keys = append(keys, ingredientKey(ns, id))
+		}
+		for _, id := range recipeIDs {
+			keys = append(keys, recipeKey(ns, id))
+		}
+		if len(op.After.Pantry) > 0 {
+			keys = append(keys, pantryKey(userId))
+		}
+		if len(keys) > 0 {
+			if err := tx.Watch(ctx, keys...).Err(); err != nil {
+				return err
+			}
+		}
+		state, err := r.load(ctx, tx, ns, recipeIDs, ingredientIDs)
+		if err != nil {
+			return err
+		}
+		pantryUser := ""
+		if len(op.After.Pantry) > 0 {
+			pantryUser = userId
+			if state.pantry, err = getPantry(ctx, tx, userId); err != nil {
+				return err
+			}
+		}
+		for _, id := range tripIDs {
+			trip, err := getTrip(ctx, tx, ns, id)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			state.trips[id] = *trip
+		}
+		before := state.clone()
+
+		if err := state.revert(op, current, target, eventType); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := r.commit(ctx, pipe, ns, pantryUser, before, state); err != nil {
+				return err
+			}
+			pipe.LPop(ctx, from)
+			pipe.LPush(ctx, to, value)
+			pipe.LTrim(ctx, to, 0, MaxJournalOperations-1)
+			return nil
+		})
+		return err
+	}
+
+	if err := r.watch(ctx, txf, from); err != nil {
+		if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrJournalConflict) {
+			logger.WithError(err).Error("Failed to revert the operation")
+		}
+		return nil, err
+	}
+	return op, nil
+}
@@ -0,0 +1,426 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The lists are saved as hashes under list:<listId>, with the name, owner, primary and created_at fields.
+// list:<listId>:members is the hash of the role of each member, the owner is not part of it.
+// user:<userId>:lists is the set of the IDs of the lists owned by or shared with the user
+// and user:<userId>:lists:primary the ID of its primary list.
+const (
+	listNameField      = "name"
+	listOwnerField     = "owner"
+	listPrimaryField   = "primary"
+	listCreatedAtField = "created_at"
+)
+
+func listKey(listId string) string {
+	return "list:" + listId
+}
+
+func membersKey(listId string) string {
+	return listKey(listId) + ":members"
+}
+
+// ValidUserID tells if the user ID can be part of the keys: the user IDs are not empty and have neither the separator
+// of the keys nor the special characters of the SCAN patterns
+func ValidUserID(userId string) bool {
+	return userId != "" && !strings.ContainsAny(userId, ":*?[")
+}
+
+// userKey prefixes the keys of the user, so that they never share a key with the lists
+func userKey(userId string) string {
+	return "user:" + userId
+}
+
+func userListsKey(userId string) string {
+	return userKey(userId) + ":lists"
+}
+
+func primaryListKey(userId string) string {
+	return userKey(userId) + ":lists:primary"
+}
+
+// newID returns a random ID, formatted like the IDs of the other services
+func newID() string {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(id)
+}
+
+func newList(userId string, name string, primary bool) *List {
+	return &List{
+		ID:        newID(),
+		Name:      name,
+		Owner:     userId,
+		Primary:   primary,
+		CreatedAt: now(),
+	}
+}
+
+// sortLists puts the primary list first then the oldest lists first
+func sortLists(lists []List) []List {
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Primary != lists[j].Primary {
+			return lists[i].Primary
+		}
+		if !lists[i].CreatedAt.Equal(lists[j].CreatedAt) {
+			return lists[i].CreatedAt.Before(lists[j].CreatedAt)
+		}
+		return lists[i].ID < lists[j].ID
+	})
+	return lists
+}
+
+func encodeList(list *List) map[string]interface{} {
+	primary := "0"
+	if list.Primary {
+		primary = "1"
+	}
+	return map[string]interface{}{
+		listNameField:      list.Name,
+		listOwnerField:     list.Owner,
+		listPrimaryField:   primary,
+		listCreatedAtField: list.CreatedAt.Format(time.RFC3339Nano),
+	}
+}
+
+func decodeList(listId string, fields map[string]string) (*List, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, fields[listCreatedAtField])
+	if err != nil {
+		return nil, err
+	}
+	return &List{
+		ID:        listId,
+		Name:      fields[listNameField],
+		Owner:     fields[listOwnerField],
+		Primary:   fields[listPrimaryField] == "1",
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// authorize sets the role of the user on the list, the owner or the role saved in the members,
+// and checks that it allows the needed role
+func authorize(list *List, userId string, memberRole Role, need Role) (*List, error) {
+	role := memberRole
+	if list.Owner == userId {
+		role = RoleOwner
+	}
+	if role == "" {
+		return nil, ErrNotFound
+	}
+	list.Role = role
+	if !role.Allows(need) {
+		return nil, ErrForbidden
+	}
+	return list, nil
+}
+
+func getList(ctx context.Context, c redis.Cmdable, listId string) (*List, error) {
+	fields, err := c.HGetAll(ctx, listKey(listId)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get list: " + listId)
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+	return decodeList(listId, fields)
+}
+
+func authorizeList(ctx context.Context, c redis.Cmdable, userId string, listId string, need Role) (*List, error) {
+	list, err := getList(ctx, c, listId)
+	if err != nil {
+		return nil, err
+	}
+	role, err := c.HGet(ctx, membersKey(listId), userId).Result()
+	if err != nil && err != redis.Nil {
+		logger.WithError(err).Error("Failed to get the role on list: " + listId)
+		return nil, err
+	}
+	return authorize(list, userId, Role(role), need)
+}
+
+// watch runs txf in an optimistic transaction watching the keys, it is retried when one of them is modified concurrently
+func (r *RedisStore) watch(ctx context.Context, txf func(tx *redis.Tx) error, keys ...string) error {
+	for retry := 0; retry < maxTransactionRetries; retry++ {
+		err := r.rdb.Watch(ctx, txf, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		if err := waitRetry(ctx); err != nil {
+			return err
+		}
+	}
+	return ErrTransactionConflict
+}
+
+func (r *RedisStore) CreateList(ctx context.Context, userId string, name string) (*List, error) {
+	list := newList(userId, name, false)
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, listKey(list.ID), encodeList(list))
+		pipe.SAdd(ctx, userListsKey(userId), list.ID)
+		return nil
+	})
+	if err != nil {
+		logger.WithError(err).Error("Failed to create list: " + name)
+		return nil, err
+	}
+	list.Role = RoleOwner
+	return list, nil
+}
+
+func (r *RedisStore) GetList(ctx context.Context, listId string) (*List, error) {
+	return getList(ctx, r.rdb, listId)
+}
+
+func (r *RedisStore) GetPrimaryList(ctx context.Context, userId string) (*List, error) {
+	var list *List
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		listId, err := tx.Get(ctx, primaryListKey(userId)).Result()
+		if err == nil {
+			list, err = getList(ctx, tx, listId)
+			return err
+		}
+		if err != redis.Nil {
+			return err
+		}
+
+		list = newList(userId, PrimaryListName, true)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, primaryListKey(userId), list.ID, 0)
+			pipe.HSet(ctx, listKey(list.ID), encodeList(list))
+			pipe.SAdd(ctx, userListsKey(userId), list.ID)
+			return nil
+		})
+		return err
+	}, primaryListKey(userId))
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the primary list of user: " + userId)
+		return nil, err
+	}
+	list.Role = RoleOwner
+	return list, nil
+}
+
+func (r *RedisStore) GetLists(ctx context.Context, userId string) ([]List, error) {
+	if _, err := r.GetPrimaryList(ctx, userId); err != nil {
+		return nil, err
+	}
+	listIds, err := r.rdb.SMembers(ctx, userListsKey(userId)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the lists of user: " + userId)
+		return nil, err
+	}
+
+	listCmds := make([]*redis.MapStringStringCmd, len(listIds))
+	roleCmds := make([]*redis.StringCmd, len(listIds))
+	_, err = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, listId := range listIds {
+			listCmds[i] = pipe.HGetAll(ctx, listKey(listId))
+			roleCmds[i] = pipe.HGet(ctx, membersKey(listId), userId)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		logger.WithError(err).Error("Failed to get the lists of user: " + userId)
+		return nil, err
+	}
+
+	lists := make([]List, 0, len(listIds))
+	for i, cmd := range listCmds {
+		// The list was deleted since the index was read
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+		list, err := decodeList(listIds[i], cmd.Val())
+		if err != nil {
+			logger.WithError(err).Error("Failed to decode list: " + listIds[i])
+			return nil, err
+		}
+		// Or the user was removed from its members
+		if list, err = authorize(list, userId, Role(roleCmds[i].Val()), RoleViewer); err != nil {
+			continue
+		}
+		lists = append(lists, *list)
+	}
+	return sortLists(lists), nil
+}
+
+func (r *RedisStore) AuthorizeList(ctx context.Context, userId string, listId string, need Role) (*List, error) {
+	return authorizeList(ctx, r.rdb, userId, listId, need)
+}
+
+func (r *RedisStore) RenameList(ctx context.Context, userId string, listId string, name string) (*List, error) {
+	var list *List
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		if list, err = authorizeList(ctx, tx, userId, listId, RoleOwner); err != nil {
+			return err
+		}
+		list.Name = name
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, listKey(listId), listNameField, name)
+			return nil
+		})
+		return err
+	}, listKey(listId), membersKey(listId))
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (r *RedisStore) DeleteList(ctx context.Context, userId string, listId string) error {
+	var list *List
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		if list, err = authorizeList(ctx, tx, userId, listId, RoleOwner); err != nil {
+			return err
+		}
+		if list.Primary {
+			return ErrPrimaryList
+		}
+		members, err := tx.HKeys(ctx, membersKey(listId)).Result()
+		if err != nil {
+			return err
+		}
+
+		// The list is removed first so that it cannot be used anymore while its content is deleted
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, listKey(listId), membersKey(listId))
+			pipe.SRem(ctx, userListsKey(list.Owner), listId)
+			for _, memberId := range members {
+				pipe.SRem(ctx, userListsKey(memberId), listId)
+			}
+			return nil
+		})
+		return err
+	}, listKey(listId), membersKey(listId))
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrForbidden) && !errors.Is(err, ErrPrimaryList) {
+			logger.WithError(err).Error("Failed to delete list: " + listId)
+		}
+		return err
+	}
+
+	var cursor uint64
+	for {
+		keys, next, err := r.rdb.Scan(ctx, cursor, list.Namespace()+":*", scanCount).Result()
+		if err != nil {
+			logger.WithError(err).Error("Failed to delete the content of list: " + listId)
+			return err
+		}
+		if len(keys) > 0 {
+			if err := r.rdb.Unlink(ctx, keys...).Err(); err != nil {
+				logger.WithError(err).Error("Failed to delete the content of list: " + listId)
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (r *RedisStore) GetMembers(ctx context.Context, userId string, listId string) ([]Member, error) {
+	list, err := r.AuthorizeList(ctx, userId, listId, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := r.rdb.HGetAll(ctx, membersKey(listId)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the members of list: " + listId)
+		return nil, err
+	}
+	return sortMembers(list, roles), nil
+}
+
+func (r *RedisStore) SetMember(ctx context.Context, userId string, listId string, memberId string, role Role) error {
+	return r.watch(ctx, func(tx *redis.Tx) error {
+		list, err := authorizeList(ctx, tx, userId, listId, RoleOwner)
+		if err != nil {
+			return err
+		}
+		if err := checkMember(list, memberId, role); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, membersKey(listId), memberId, string(role))
+			pipe.SAdd(ctx, userListsKey(memberId), listId)
+			return nil
+		})
+		return err
+	}, listKey(listId), membersKey(listId))
+}
+
+func (r *RedisStore) RemoveMember(ctx context.Context, userId string, listId string, memberId string) error {
+	return r.watch(ctx, func(tx *redis.Tx) error {
+		list, err := authorizeList(ctx, tx, userId, listId, removeMemberRole(userId, memberId))
+		if err != nil {
+			return err
+		}
+		if list.Owner == memberId {
+			return ErrOwnerRole
+		}
+		removed, err := tx.HExists(ctx, membersKey(listId), memberId).Result()
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return ErrNotFound
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, membersKey(listId), memberId)
+			pipe.SRem(ctx, userListsKey(memberId), listId)
+			return nil
+		})
+		return err
+	}, listKey(listId), membersKey(listId))
+}
+
+// checkMember tells if the member can be given the role on the list
+func checkMember(list *List, memberId string, role Role) error {
+	if list.Primary {
+		return ErrPrimaryList
+	}
+	if list.Owner == memberId || role == RoleOwner {
+		return ErrOwnerRole
+	}
+	if !role.Allows(RoleViewer) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// removeMemberRole is the role needed to remove the member: the owner removes anyone, the members leave by themselves
+func removeMemberRole(userId string, memberId string) Role {
+	if userId == memberId {
+		return RoleViewer
+	}
+	return RoleOwner
+}
+
+// sortMembers returns the owner of the list then its members sorted by user ID
+func sortMembers(list *List, roles map[string]string) []Member {
+	members := make([]Member, 0, len(roles)+1)
+	for memberId, role := range roles {
+		members = append(members, Member{UserID: memberId, Role: Role(role)})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].UserID < members[j].UserID
+	})
+	return append([]Member{{UserID: list.Owner, Role: RoleOwner}}, members...)
+}
@@ -0,0 +1,597 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store keeping everything in memory.
+// It is meant for the unit tests and to run the API locally without Redis.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]*listState
+	stats  map[string]map[string]*RecipeStats
+	lists  map[string]*List
+	// Primary list ID of each user
+	primaryLists map[string]string
+	// Role of each member of each list
+	members map[string]map[string]Role
+	// Pantry of each user
+	pantries map[string]map[string][]Quantity
+	// Custom aisle order of each user
+	aisles map[string][]string
+	// Events of each list namespace
+	events map[string][]Event
+	// Operations to undo and to redo of each user on each list, by journal key, the most recent last
+	journals map[string][]*Operation
+	redos    map[string][]*Operation
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states:       make(map[string]*listState),
+		stats:        make(map[string]map[string]*RecipeStats),
+		lists:        make(map[string]*List),
+		primaryLists: make(map[string]string),
+		members:      make(map[string]map[string]Role),
+		pantries:     make(map[string]map[string][]Quantity),
+		aisles:       make(map[string][]string),
+		events:       make(map[string][]Event),
+		journals:     make(map[string][]*Operation),
+		redos:        make(map[string][]*Operation),
+	}
+}
+
+func (m *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// list returns the state of the list namespace, m.mu must be held
+func (m *MemoryStore) list(ns string) *listState {
+	state, ok := m.states[ns]
+	if !ok {
+		state = newListState()
+		m.states[ns] = state
+	}
+	return state
+}
+
+// update runs fn on the state of the list namespace, the changes are kept only if fn succeeds
+func (m *MemoryStore) update(ctx context.Context, ns string, fn func(state *listState) error) error {
+	return m.updateWithPantry(ctx, ns, "", fn)
+}
+
+// updateWithPantry is update with the pantry of the user loaded in the state
+func (m *MemoryStore) updateWithPantry(ctx context.Context, ns string, userId string, fn func(state *listState) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := m.list(ns)
+	state := before.clone()
+	if userId != "" {
+		before.pantry = m.pantries[userId]
+		state.pantry = clonePantry(m.pantries[userId])
+	}
+	if err := fn(state); err != nil {
+		before.pantry = nil
+		return err
+	}
+	// Only the operations of a user can be undone
+	if user := UserFromContext(ctx); user != "" {
+		if op := newOperation(before, state); op != nil {
+			key := journalKey(ns, user)
+			m.journals[key] = append(m.journals[key], op)
+			if len(m.journals[key]) > MaxJournalOperations {
+				m.journals[key] = m.journals[key][1:]
+			}
+			delete(m.redos, key)
+		}
+	}
+	before.pantry = nil
+	m.commit(ns, userId, state)
+	return nil
+}
+
+// commit saves the state of the list namespace with the pantry of the user, and the events of the operation
+func (m *MemoryStore) commit(ns string, userId string, state *listState) {
+	if userId != "" {
+		m.pantries[userId] = state.pantry
+		state.pantry = nil
+	}
+	for _, recipeId := range state.usages {
+		m.recordRecipeUsage(userId, recipeId, state.now())
+	}
+	for _, event := range state.events {
+		event.ID = fmt.Sprintf("%d-%d", event.At.UnixMilli(), len(m.events[ns]))
+		m.events[ns] = append(m.events[ns], event)
+	}
+	state.events = nil
+	state.usages = nil
+	state.clock = time.Time{}
+	m.states[ns] = state
+}
+
+func clonePantry(pantry map[string][]Quantity) map[string][]Quantity {
+	c := make(map[string][]Quantity, len(pantry))
+	for id, quantities := range pantry {
+		c[id] = slices.Clone(quantities)
+	}
+	return c
+}
+
+func (m *MemoryStore) GetIngredient(ctx context.Context, ns string, ingredientId string, recipeIds ...string) (*Ingredient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.list(ns).getIngredient(ingredientId, recipeIds...)
+}
+
+func (m *MemoryStore) GetIngredientRecipe(ctx context.Context, ns string, ingredientId string, recipeId string) (*Ingredient, error) {
+	return m.GetIngredient(ctx, ns, ingredientId, recipeId)
+}
+
+func (m *MemoryStore) AddIngredient(ctx context.Context, ns string, ingredientID string, ingredient Ingredient) (*Ingredient, bool, error) {
+	var ingredientSaved *Ingredient
+	var created bool
+	err := m.update(ctx, ns, func(state *listState) error {
+		var err error
+		ingredientSaved, created, err = state.addIngredient(ingredientID, ingredient)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return ingredientSaved, created, nil
+}
+
+func (m *MemoryStore) AddIngredients(ctx context.Context, ns string, ingredients []Ingredient) error {
+	return m.update(ctx, ns, func(state *listState) error {
+		return state.addIngredients(ingredients)
+	})
+}
+
+func (m *MemoryStore) RemoveIngredient(ctx context.Context, ns string, ingredientID string, recipeId string, removeAll bool) error {
+	return m.update(ctx, ns, func(state *listState) error {
+		return state.removeIngredient(ingredientID, recipeId, removeAll)
+	})
+}
+
+func (m *MemoryStore) CheckIngredient(ctx context.Context, ns string, ingredientID string, userId string, checked bool) (*Ingredient, error) {
+	var ingredientSaved *Ingredient
+	err := m.update(ctx, ns, func(state *listState) error {
+		var err error
+		ingredientSaved, err = state.checkIngredient(ingredientID, userId, checked)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ingredientSaved, nil
+}
+
+func (m *MemoryStore) CompleteTrip(ctx context.Context, ns string, userId string) (*Trip, error) {
+	var trip *Trip
+	err := m.updateWithPantry(ctx, ns, userId, func(state *listState) error {
+		var err error
+		trip, err = state.completeTrip(userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trip, nil
+}
+
+func (m *MemoryStore) GetTrips(ctx context.Context, ns string, limit int) ([]Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trips := make([]Trip, 0, len(m.list(ns).trips))
+	for _, trip := range m.list(ns).trips {
+		trips = append(trips, trip)
+	}
+	trips = sortTrips(trips)
+	if len(trips) > limit {
+		trips = trips[:limit]
+	}
+	return trips, nil
+}
+
+func (m *MemoryStore) GetTrip(ctx context.Context, ns string, tripId string) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	trip, ok := m.list(ns).trips[tripId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &trip, nil
+}
+
+func (m *MemoryStore) GetRecipe(ctx context.Context, ns string, recipeId string) (*Recipe, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.list(ns).getRecipe(recipeId)
+}
+
+func (m *MemoryStore) AddRecipe(ctx context.Context, ns string, userId string, recipeID string, recipe *Recipe, ingredients *[]Ingredient) ([]Deduction, error) {
+	var deductions []Deduction
+	err := m.updateWithPantry(ctx, ns, userId, func(state *listState) error {
+		deductions = state.addRecipe(recipeID, recipe, *ingredients)
+		if userId != "" {
+			state.usages = append(state.usages, recipeID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deductions, nil
+}
+
+func (m *MemoryStore) RemoveRecipe(ctx context.Context, ns string, recipeId string) error {
+	return m.update(ctx, ns, func(state *listState) error {
+		return state.removeRecipe(recipeId)
+	})
+}
+
+func (m *MemoryStore) RemoveIngredientFromRecipe(ctx context.Context, ns string, ingredientID string, recipeId string) error {
+	return m.update(ctx, ns, func(state *listState) error {
+		return state.removeIngredientFromRecipe(ingredientID, recipeId)
+	})
+}
+
+func (m *MemoryStore) GetShoppingList(ctx context.Context, ns string) (*[]Ingredient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ingredients := m.list(ns).shoppingList()
+	return &ingredients, nil
+}
+
+func (m *MemoryStore) Undo(ctx context.Context, ns string, userId string) (*Operation, error) {
+	return m.revertOperation(ns, userId, true)
+}
+
+func (m *MemoryStore) Redo(ctx context.Context, ns string, userId string) (*Operation, error) {
+	return m.revertOperation(ns, userId, false)
+}
+
+func (m *MemoryStore) revertOperation(ns string, userId string, undo bool) (*Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := journalKey(ns, userId)
+	from, to, eventType := m.journals, m.redos, OperationUndone
+	if !undo {
+		from, to, eventType = m.redos, m.journals, OperationRedone
+	}
+	if len(from[key]) == 0 {
+		return nil, ErrNotFound
+	}
+	op := from[key][len(from[key])-1]
+	current, target := op.After, op.Before
+	if !undo {
+		current, target = op.Before, op.After
+	}
+
+	state := m.list(ns).clone()
+	pantryUser := ""
+	if len(op.After.Pantry) > 0 {
+		pantryUser = userId
+		state.pantry = clonePantry(m.pantries[userId])
+	}
+	if err := state.revert(op, current, target, eventType); err != nil {
+		return nil, err
+	}
+	m.commit(ns, pantryUser, state)
+	from[key] = from[key][:len(from[key])-1]
+	to[key] = append(to[key], op)
+	return op, nil
+}
+
+func (m *MemoryStore) GetEvents(ctx context.Context, ns string, until time.Time) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := make([]Event, 0, len(m.events[ns]))
+	for _, event := range m.events[ns] {
+		if !until.IsZero() && event.At.After(until) {
+			break
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (m *MemoryStore) GetShoppingListAt(ctx context.Context, ns string, at time.Time) (*[]Ingredient, error) {
+	events, err := m.GetEvents(ctx, ns, at)
+	if err != nil {
+		return nil, err
+	}
+	state, err := replay(events, newListState())
+	if err != nil {
+		return nil, err
+	}
+	ingredients := state.shoppingList()
+	return &ingredients, nil
+}
+
+func (m *MemoryStore) GetPantry(ctx context.Context, userId string) ([]PantryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return pantryItems(m.pantries[userId]), nil
+}
+
+func (m *MemoryStore) GetPantryItem(ctx context.Context, userId string, ingredientId string) ([]PantryItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	quantities, ok := m.pantries[userId][ingredientId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return pantryItems(map[string][]Quantity{ingredientId: quantities}), nil
+}
+
+func (m *MemoryStore) SetPantryItem(ctx context.Context, userId string, item PantryItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pantry := clonePantry(m.pantries[userId])
+	setPantryItem(pantry, item)
+	m.pantries[userId] = pantry
+	return nil
+}
+
+func (m *MemoryStore) RemovePantryItem(ctx context.Context, userId string, ingredientId string, unit string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pantry := clonePantry(m.pantries[userId])
+	if err := removePantryItem(pantry, ingredientId, unit); err != nil {
+		return err
+	}
+	m.pantries[userId] = pantry
+	return nil
+}
+
+// recordRecipeUsage counts the recipe added by the user, the lock is held
+func (m *MemoryStore) recordRecipeUsage(userId string, recipeId string, at time.Time) {
+	if m.stats[userId] == nil {
+		m.stats[userId] = make(map[string]*RecipeStats)
+	}
+	stats, ok := m.stats[userId][recipeId]
+	if !ok {
+		stats = &RecipeStats{RecipeID: recipeId}
+		m.stats[userId][recipeId] = stats
+	}
+	stats.TimesAdded++
+	stats.LastUsedAt = at
+}
+
+func (m *MemoryStore) GetRecipeStats(ctx context.Context, userId string, limit int) ([]RecipeStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]RecipeStats, 0, len(m.stats[userId]))
+	for _, s := range m.stats[userId] {
+		stats = append(stats, *s)
+	}
+	// Same order as the sorted set of the RedisStore
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TimesAdded != stats[j].TimesAdded {
+			return stats[i].TimesAdded > stats[j].TimesAdded
+		}
+		return stats[i].RecipeID > stats[j].RecipeID
+	})
+	if len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats, nil
+}
+
+func (m *MemoryStore) CreateList(ctx context.Context, userId string, name string) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := newList(userId, name, false)
+	m.lists[list.ID] = list
+	saved := *list
+	saved.Role = RoleOwner
+	return &saved, nil
+}
+
+func (m *MemoryStore) GetList(ctx context.Context, listId string) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, ok := m.lists[listId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	saved := *list
+	return &saved, nil
+}
+
+// primaryList returns the primary list of the user, creating it the first time, m.mu must be held
+func (m *MemoryStore) primaryList(userId string) *List {
+	if listId, ok := m.primaryLists[userId]; ok {
+		return m.lists[listId]
+	}
+	list := newList(userId, PrimaryListName, true)
+	m.lists[list.ID] = list
+	m.primaryLists[userId] = list.ID
+	return list
+}
+
+func (m *MemoryStore) GetPrimaryList(ctx context.Context, userId string) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *m.primaryList(userId)
+	saved.Role = RoleOwner
+	return &saved, nil
+}
+
+func (m *MemoryStore) GetLists(ctx context.Context, userId string) ([]List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.primaryList(userId)
+	lists := make([]List, 0)
+	for _, list := range m.lists {
+		if saved, err := m.authorize(userId, list.ID, RoleViewer); err == nil {
+			lists = append(lists, *saved)
+		}
+	}
+	return sortLists(lists), nil
+}
+
+// authorize returns a copy of the list when the role of the user allows the needed role, m.mu must be held
+func (m *MemoryStore) authorize(userId string, listId string, need Role) (*List, error) {
+	list, ok := m.lists[listId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	saved := *list
+	return authorize(&saved, userId, m.members[listId][userId], need)
+}
+
+func (m *MemoryStore) AuthorizeList(ctx context.Context, userId string, listId string, need Role) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.authorize(userId, listId, need)
+}
+
+func (m *MemoryStore) RenameList(ctx context.Context, userId string, listId string, name string) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved, err := m.authorize(userId, listId, RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	m.lists[listId].Name = name
+	saved.Name = name
+	return saved, nil
+}
+
+func (m *MemoryStore) DeleteList(ctx context.Context, userId string, listId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.authorize(userId, listId, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if list.Primary {
+		return ErrPrimaryList
+	}
+	delete(m.lists, listId)
+	delete(m.members, listId)
+	delete(m.states, list.Namespace())
+	delete(m.events, list.Namespace())
+	// The journals of all the users, like the <namespace>:* keys deleted by the RedisStore
+	for _, journals := range []map[string][]*Operation{m.journals, m.redos} {
+		for key := range journals {
+			if strings.HasPrefix(key, journalKey(list.Namespace(), "")) {
+				delete(journals, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) GetMembers(ctx context.Context, userId string, listId string) ([]Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.authorize(userId, listId, RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	roles := make(map[string]string, len(m.members[listId]))
+	for memberId, role := range m.members[listId] {
+		roles[memberId] = string(role)
+	}
+	return sortMembers(list, roles), nil
+}
+
+func (m *MemoryStore) SetMember(ctx context.Context, userId string, listId string, memberId string, role Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.authorize(userId, listId, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if err := checkMember(list, memberId, role); err != nil {
+		return err
+	}
+	if m.members[listId] == nil {
+		m.members[listId] = make(map[string]Role)
+	}
+	m.members[listId][memberId] = role
+	return nil
+}
+
+func (m *MemoryStore) RemoveMember(ctx context.Context, userId string, listId string, memberId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list, err := m.authorize(userId, listId, removeMemberRole(userId, memberId))
+	if err != nil {
+		return err
+	}
+	if list.Owner == memberId {
+		return ErrOwnerRole
+	}
+	if _, ok := m.members[listId][memberId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.members[listId], memberId)
+	return nil
+}
+
+func (m *MemoryStore) GetAisleOrder(ctx context.Context, userId string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	aisles, ok := m.aisles[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return slices.Clone(aisles), nil
+}
+
+func (m *MemoryStore) SetAisleOrder(ctx context.Context, userId string, aisles []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.aisles[userId] = slices.Clone(aisles)
+	return nil
+}
+
+func (m *MemoryStore) RemoveAisleOrder(ctx context.Context, userId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.aisles[userId]; !ok {
+		return ErrNotFound
+	}
+	delete(m.aisles, userId)
+	return nil
+}
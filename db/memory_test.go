@@ -0,0 +1,545 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"shopping-list/units"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Add ingredient merges the quantities", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		i := Ingredient{ID: "000000000000000000000001", Quantities: []Quantity{{Amount: 100, Unit: "g"}}}
+		store.AddIngredient(ctx, "1", i.ID, i)
+		store.AddIngredient(ctx, "1", i.ID, i)
+		store.AddIngredient(ctx, "1", i.ID, Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "kg"}}})
+
+		ig, err := store.GetIngredient(ctx, "1", i.ID)
+		if err != nil {
+			t.Fatalf("Failed to get ingredient: %v", err)
+		}
+		if len(ig.Quantities) != 1 || ig.Quantities[0].Amount != 1200 || ig.Quantities[0].Unit != "g" {
+			t.Errorf("Failed to merge the quantities: %v", ig)
+		}
+	})
+
+	t.Run("Missing keys return ErrNotFound", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		if _, err := store.GetIngredient(ctx, "1", "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		if _, err := store.GetRecipe(ctx, "1", "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Remove the recipe removes its quantities", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		r := Recipe{IngredientsID: []string{"000000000000000000000001", "000000000000000000000002"}}
+		ings := []Ingredient{
+			{Quantities: []Quantity{{Amount: 1, Unit: "g", RecipeID: "r1"}}},
+			{Quantities: []Quantity{{Amount: 2, Unit: "i", RecipeID: "r1"}}},
+		}
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+		store.AddIngredient(ctx, "1", "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 5, Unit: "g"}}})
+
+		if err := store.RemoveRecipe(ctx, "1", "r1"); err != nil {
+			t.Fatalf("Failed to remove the recipe: %v", err)
+		}
+
+		list, _ := store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 || (*list)[0].Quantities[0].Amount != 5 {
+			t.Errorf("Failed to remove the recipe quantities: %v", list)
+		}
+		if _, err := store.GetRecipe(ctx, "1", "r1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("The recipe should be removed: %v", err)
+		}
+	})
+
+	t.Run("An ingredient added to a recipe is removed with it", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		if _, _, err := store.AddIngredient(ctx, "1", "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i", RecipeID: "r1"}}}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for an unknown recipe, got %v", err)
+		}
+		r := Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ings := []Ingredient{{Quantities: []Quantity{{Amount: 1, Unit: "g", RecipeID: "r1"}}}}
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+
+		_, created, err := store.AddIngredient(ctx, "1", "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i", RecipeID: "r1"}}})
+		if err != nil || !created {
+			t.Errorf("The ingredient should be created: %v %v", created, err)
+		}
+		if _, created, _ := store.AddIngredient(ctx, "1", "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i", RecipeID: "r1"}}}); created {
+			t.Errorf("The ingredient saved should not be created again")
+		}
+		recipe, _ := store.GetRecipe(ctx, "1", "r1")
+		if len(recipe.IngredientsID) != 2 || recipe.IngredientsID[1] != "000000000000000000000002" {
+			t.Errorf("The ingredient should be added to the recipe: %v", recipe)
+		}
+
+		store.RemoveRecipe(ctx, "1", "r1")
+		if list, _ := store.GetShoppingList(ctx, "1"); len(*list) != 0 {
+			t.Errorf("No line of the recipe should be left: %v", list)
+		}
+	})
+
+	t.Run("Concurrent additions are not lost", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		var wg sync.WaitGroup
+		for w := 0; w < 50; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for a := 0; a < 20; a++ {
+					store.AddIngredient(ctx, "1", "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "g"}}})
+				}
+			}()
+		}
+		wg.Wait()
+
+		ig, _ := store.GetIngredient(ctx, "1", "000000000000000000000001")
+		if len(ig.Quantities) != 1 || ig.Quantities[0].Amount != 1000 {
+			t.Errorf("Lost update on the ingredient: %v", ig)
+		}
+	})
+
+	t.Run("A failed operation does not change the list", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		store.AddIngredient(ctx, "1", "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "g"}}})
+		if err := store.RemoveRecipe(ctx, "1", "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		list, _ := store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 {
+			t.Errorf("The list should not change: %v", list)
+		}
+	})
+
+	t.Run("Deleting a list removes its content", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		primary, _ := store.GetPrimaryList(ctx, "1")
+		list, _ := store.CreateList(ctx, "1", "Hardware store")
+		store.AddIngredient(WithUser(ctx, "1"), list.Namespace(), "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i"}}})
+		store.AddIngredient(WithUser(ctx, "1"), list.Namespace(), "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i"}}})
+		store.Undo(ctx, list.Namespace(), "1")
+
+		if err := store.DeleteList(ctx, "1", primary.ID); !errors.Is(err, ErrPrimaryList) {
+			t.Errorf("Expected ErrPrimaryList, got %v", err)
+		}
+		if err := store.DeleteList(ctx, "1", list.ID); err != nil {
+			t.Fatalf("Failed to delete the list: %v", err)
+		}
+		if content, _ := store.GetShoppingList(ctx, list.Namespace()); len(*content) != 0 {
+			t.Errorf("The content of the list should be deleted: %v", content)
+		}
+		if len(store.journals) != 0 || len(store.redos) != 0 {
+			t.Errorf("The journals of the list should be deleted: %v %v", store.journals, store.redos)
+		}
+		if lists, _ := store.GetLists(ctx, "1"); len(lists) != 1 || lists[0].ID != primary.ID {
+			t.Errorf("Only the primary list should be left: %v", lists)
+		}
+	})
+
+	t.Run("The primary list of a user never shares the keys of a list", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		list, _ := store.CreateList(ctx, "1", "Groceries")
+		store.AddIngredient(ctx, list.Namespace(), "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i"}}})
+
+		// A user named after the key of the list
+		primary, err := store.GetPrimaryList(ctx, "list:"+list.ID)
+		if err != nil || primary.Namespace() == list.Namespace() {
+			t.Fatalf("The primary list should have its own namespace: %v %v", primary, err)
+		}
+		if content, _ := store.GetShoppingList(ctx, primary.Namespace()); len(*content) != 0 {
+			t.Errorf("The primary list should not have the content of the list: %v", content)
+		}
+	})
+
+	t.Run("The roles of the members are enforced", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		list, _ := store.CreateList(ctx, "1", "Groceries")
+		if _, err := store.AuthorizeList(ctx, "2", list.ID, RoleViewer); !errors.Is(err, ErrNotFound) {
+			t.Errorf("The list should not be found by the other users: %v", err)
+		}
+
+		store.SetMember(ctx, "1", list.ID, "2", RoleViewer)
+		store.SetMember(ctx, "1", list.ID, "3", RoleEditor)
+		if shared, err := store.AuthorizeList(ctx, "2", list.ID, RoleViewer); err != nil || shared.Role != RoleViewer {
+			t.Errorf("The viewer should read the list: %v %v", shared, err)
+		}
+		if _, err := store.AuthorizeList(ctx, "2", list.ID, RoleEditor); !errors.Is(err, ErrForbidden) {
+			t.Errorf("The viewer should not edit the list: %v", err)
+		}
+		if _, err := store.AuthorizeList(ctx, "3", list.ID, RoleEditor); err != nil {
+			t.Errorf("The editor should edit the list: %v", err)
+		}
+		if _, err := store.RenameList(ctx, "3", list.ID, "Party"); !errors.Is(err, ErrForbidden) {
+			t.Errorf("Only the owner renames the list: %v", err)
+		}
+		if err := store.SetMember(ctx, "3", list.ID, "4", RoleViewer); !errors.Is(err, ErrForbidden) {
+			t.Errorf("Only the owner invites members: %v", err)
+		}
+		if err := store.SetMember(ctx, "1", list.ID, "1", RoleViewer); !errors.Is(err, ErrOwnerRole) {
+			t.Errorf("The role of the owner should not change: %v", err)
+		}
+
+		lists, _ := store.GetLists(ctx, "3")
+		if len(lists) != 2 || lists[1].ID != list.ID || lists[1].Role != RoleEditor {
+			t.Errorf("The shared list should be in the lists of the member: %v", lists)
+		}
+		members, _ := store.GetMembers(ctx, "2", list.ID)
+		if len(members) != 3 || members[0].UserID != "1" || members[0].Role != RoleOwner {
+			t.Errorf("Wrong members: %v", members)
+		}
+
+		// The members leave the list by themselves
+		if err := store.RemoveMember(ctx, "2", list.ID, "2"); err != nil {
+			t.Errorf("Failed to leave the list: %v", err)
+		}
+		if _, err := store.AuthorizeList(ctx, "2", list.ID, RoleViewer); !errors.Is(err, ErrNotFound) {
+			t.Errorf("The removed member should not find the list: %v", err)
+		}
+	})
+
+	t.Run("Adding quantities reopens a checked ingredient", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		i := Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "kg"}}}
+		store.AddIngredient(ctx, "1", "000000000000000000000001", i)
+		if _, err := store.CheckIngredient(ctx, "1", "unknown", "1", true); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		checked, err := store.CheckIngredient(ctx, "1", "000000000000000000000001", "2", true)
+		if err != nil || !checked.Checked || checked.CheckedBy != "2" || checked.CheckedAt == nil {
+			t.Fatalf("Failed to check the ingredient: %v %v", checked, err)
+		}
+		// Checking again keeps who checked it first
+		again, _ := store.CheckIngredient(ctx, "1", "000000000000000000000001", "3", true)
+		if again.CheckedBy != "2" || !again.CheckedAt.Equal(*checked.CheckedAt) {
+			t.Errorf("The first check should be kept: %v", again)
+		}
+
+		reopened, _, _ := store.AddIngredient(ctx, "1", "000000000000000000000001", i)
+		if reopened.Checked || reopened.CheckedAt != nil || reopened.Quantities[0].Amount != 2000 {
+			t.Errorf("The ingredient should be reopened: %v", reopened)
+		}
+	})
+
+	t.Run("Complete a trip with the checked ingredients", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		r := Recipe{IngredientsID: []string{"000000000000000000000001", "000000000000000000000002"}}
+		ings := []Ingredient{
+			{Quantities: []Quantity{{Amount: 1, Unit: "g", RecipeID: "r1"}}},
+			{Quantities: []Quantity{{Amount: 2, Unit: "i", RecipeID: "r1"}}},
+		}
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+		if _, err := store.CompleteTrip(ctx, "1", "1"); !errors.Is(err, ErrEmptyTrip) {
+			t.Errorf("Expected ErrEmptyTrip, got %v", err)
+		}
+
+		store.CheckIngredient(ctx, "1", "000000000000000000000001", "1", true)
+		trip, err := store.CompleteTrip(ctx, "1", "1")
+		if err != nil || len(trip.Ingredients) != 1 || !trip.Ingredients[0].Checked {
+			t.Fatalf("Failed to complete the trip: %v %v", trip, err)
+		}
+		list, _ := store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 || (*list)[0].ID != "000000000000000000000002" {
+			t.Errorf("Only the unchecked ingredients should stay: %v", list)
+		}
+
+		// The recipe can still be removed once some of its ingredients were purchased
+		if err := store.RemoveRecipe(ctx, "1", "r1"); err != nil {
+			t.Errorf("Failed to remove the recipe: %v", err)
+		}
+		trips, _ := store.GetTrips(ctx, "1", 10)
+		if len(trips) != 1 || trips[0].ID != trip.ID {
+			t.Errorf("Wrong trips: %v", trips)
+		}
+	})
+
+	t.Run("The pantry is deducted from the recipes and filled by the trips", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		store.SetPantryItem(ctx, "1", PantryItem{ID: "000000000000000000000001", Amount: 150, Unit: "g"})
+		store.SetPantryItem(ctx, "1", PantryItem{ID: "000000000000000000000002", Amount: 5, Unit: "i"})
+
+		r := Recipe{IngredientsID: []string{"000000000000000000000001", "000000000000000000000002"}}
+		ings := []Ingredient{
+			{Quantities: []Quantity{{Amount: 100, Unit: "g", RecipeID: "r1"}}},
+			{Quantities: []Quantity{{Amount: 2, Unit: "i", RecipeID: "r1"}}},
+		}
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+		deductions, err := store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+		if err != nil || len(deductions) != 2 {
+			t.Fatalf("Wrong deductions: %v %v", deductions, err)
+		}
+		if d := deductions[0]; d.Requested != 100 || d.FromPantry != 50 || d.Shortfall != 50 {
+			t.Errorf("Only the rest of the pantry should be taken: %v", d)
+		}
+
+		list, _ := store.GetShoppingList(ctx, "1")
+		if len(*list) != 1 || (*list)[0].Quantities[0].Amount != 50 {
+			t.Errorf("Only the shortfall should be in the list: %v", list)
+		}
+		pantry, _ := store.GetPantry(ctx, "1")
+		if len(pantry) != 1 || pantry[0].ID != "000000000000000000000002" || pantry[0].Amount != 1 {
+			t.Errorf("The pantry should be deducted: %v", pantry)
+		}
+
+		store.CheckIngredient(ctx, "1", "000000000000000000000001", "1", true)
+		store.CompleteTrip(ctx, "1", "1")
+		items, err := store.GetPantryItem(ctx, "1", "000000000000000000000001")
+		if err != nil || len(items) != 1 || items[0].Amount != 50 || items[0].Unit != "g" {
+			t.Errorf("The purchased quantities should be in the pantry: %v %v", items, err)
+		}
+
+		if err := store.RemovePantryItem(ctx, "1", "000000000000000000000001", "ml"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		if err := store.RemovePantryItem(ctx, "1", "000000000000000000000001", ""); err != nil {
+			t.Errorf("Failed to remove the pantry item: %v", err)
+		}
+	})
+
+	t.Run("The recipes added are counted with the list", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		r := Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ings := []Ingredient{{Quantities: []Quantity{{Amount: 100, Unit: "g", RecipeID: "r1"}}}}
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+
+		stats, err := store.GetRecipeStats(ctx, "1", 10)
+		if err != nil || len(stats) != 1 || stats[0].RecipeID != "r1" || stats[0].TimesAdded != 2 || stats[0].LastUsedAt.IsZero() {
+			t.Errorf("The recipe should be counted each time it is added: %v %v", stats, err)
+		}
+		if stats, _ := store.GetRecipeStats(ctx, "2", 10); len(stats) != 0 {
+			t.Errorf("Only the user adding the recipe should count it: %v", stats)
+		}
+	})
+
+	t.Run("The volumes are summed with the masses when the density is known", func(t *testing.T) {
+		store := NewMemoryStore()
+		units.SetDensities(units.Densities{
+			"000000000000000000000001": {GramsPerMl: 0.5},
+			"000000000000000000000002": {GramsPerPiece: 50},
+		})
+		defer units.SetDensities(nil)
+
+		store.AddIngredient(ctx, "1", "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 100, Unit: "g"}}})
+		flour, _, _ := store.AddIngredient(ctx, "1", "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "cup"}}})
+		if len(flour.Quantities) != 1 || flour.Quantities[0].Amount != 220 || flour.Quantities[0].Unit != "g" {
+			t.Errorf("The volume should be summed with the mass: %v", flour)
+		}
+
+		// Without a mass line the count is kept as it is
+		eggs, _, _ := store.AddIngredient(ctx, "1", "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 2, Unit: "i"}}})
+		if len(eggs.Quantities) != 1 || eggs.Quantities[0].Unit != "i" {
+			t.Errorf("The count should be kept: %v", eggs)
+		}
+		eggs, _, _ = store.AddIngredient(ctx, "1", "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 30, Unit: "g"}}})
+		if len(eggs.Quantities) != 1 || eggs.Quantities[0].Amount != 130 {
+			t.Errorf("The pieces should be summed with the mass: %v", eggs)
+		}
+
+		// No density, the lines stay apart
+		store.AddIngredient(ctx, "1", "000000000000000000000003", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "l"}, {Amount: 1, Unit: "kg"}}})
+		list, _ := store.GetShoppingList(ctx, "1")
+		if len(*list) != 3 || len((*list)[2].Quantities) != 2 {
+			t.Errorf("The lines without density should stay apart: %v", list)
+		}
+	})
+
+	t.Run("The events rebuild the list", func(t *testing.T) {
+		store := NewMemoryStore()
+
+		store.SetPantryItem(ctx, "1", PantryItem{ID: "000000000000000000000001", Amount: 50, Unit: "g"})
+		r := Recipe{IngredientsID: []string{"000000000000000000000001", "000000000000000000000002", "000000000000000000000003"}}
+		ings := []Ingredient{
+			{Quantities: []Quantity{{Amount: 100, Unit: "g", RecipeID: "r1"}}},
+			{Quantities: []Quantity{{Amount: 2, Unit: "i", RecipeID: "r1"}}},
+			{Quantities: []Quantity{{Amount: 1, Unit: "l", RecipeID: "r1"}}},
+		}
+		store.AddRecipe(ctx, "1", "1", "r1", &r, &ings)
+		store.AddRecipe(ctx, "1", "1", "r2", &Recipe{IngredientsID: r.IngredientsID[:1]}, &[]Ingredient{
+			{Quantities: []Quantity{{Amount: 10, Unit: "g", RecipeID: "r2"}}},
+		})
+		store.AddIngredient(ctx, "1", "000000000000000000000004", Ingredient{Quantities: []Quantity{{Amount: 3, Unit: "i"}}})
+		store.AddIngredient(ctx, "1", "000000000000000000000001", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "kg"}}})
+		store.CheckIngredient(ctx, "1", "000000000000000000000004", "2", true)
+		store.CheckIngredient(ctx, "1", "000000000000000000000003", "1", true)
+		store.CompleteTrip(ctx, "1", "1")
+		store.CheckIngredient(ctx, "1", "000000000000000000000002", "1", true)
+		store.RemoveIngredientFromRecipe(ctx, "1", "000000000000000000000002", "r1")
+		store.RemoveIngredient(ctx, "1", "000000000000000000000001", "r1", false)
+		store.RemoveRecipe(ctx, "1", "r2")
+		store.RemoveRecipe(ctx, "1", "unknown")
+
+		events, err := store.GetEvents(ctx, "1", time.Time{})
+		if err != nil || len(events) != 11 {
+			t.Fatalf("Wrong events: %v %v", events, err)
+		}
+		if events[0].Type != RecipeAdded || len(events[0].Ingredients) != 3 || events[0].Ingredients[0].Quantities[0].Amount != 50 {
+			t.Errorf("The recipe should be recorded once taken from the pantry: %v", events[0])
+		}
+
+		saved := store.states["1"]
+		state, err := replay(events, newListState())
+		if err != nil {
+			t.Fatalf("Failed to replay the events: %v", err)
+		}
+		if !maps.EqualFunc(state.ingredients, saved.ingredients, slices.Equal[[]Quantity]) {
+			t.Errorf("Wrong ingredients replayed: %v, expected %v", state.ingredients, saved.ingredients)
+		}
+		if !maps.EqualFunc(state.recipes, saved.recipes, Recipe.equal) {
+			t.Errorf("Wrong recipes replayed: %v, expected %v", state.recipes, saved.recipes)
+		}
+		if !maps.Equal(state.checks, saved.checks) {
+			t.Errorf("Wrong checks replayed: %v, expected %v", state.checks, saved.checks)
+		}
+		if !maps.EqualFunc(state.trips, saved.trips, func(a Trip, b Trip) bool {
+			return a.ID == b.ID && a.CompletedAt.Equal(b.CompletedAt) && len(a.Ingredients) == len(b.Ingredients)
+		}) {
+			t.Errorf("Wrong trips replayed: %v, expected %v", state.trips, saved.trips)
+		}
+
+		// The list before the trip
+		list, _ := store.GetShoppingListAt(ctx, "1", events[5].At)
+		if len(*list) != 4 || !(*list)[2].Checked {
+			t.Errorf("Wrong list before the trip: %v", list)
+		}
+		if list, _ := store.GetShoppingListAt(ctx, "1", events[0].At.Add(-time.Second)); len(*list) != 0 {
+			t.Errorf("The list should be empty before the first event: %v", list)
+		}
+
+		// An event that cannot be applied fails the replay instead of being skipped
+		store.events["1"] = append(store.events["1"], Event{ID: "unknown", Type: "Unknown"})
+		if list, err := store.GetShoppingListAt(ctx, "1", time.Now()); err == nil {
+			t.Errorf("The replay of an unknown event should fail: %v", list)
+		}
+	})
+
+	t.Run("Undo and redo the operations of the users exactly", func(t *testing.T) {
+		store := NewMemoryStore()
+		user := WithUser(ctx, "1")
+		const id = "000000000000000000000001"
+
+		quantityOf := func() float64 {
+			ingredient, err := store.GetIngredient(ctx, "1", id)
+			if err != nil {
+				return 0
+			}
+			return ingredient.Quantities[0].Amount
+		}
+
+		store.AddIngredient(user, "1", id, Ingredient{Quantities: []Quantity{{Amount: 100, Unit: "g"}}})
+		store.AddIngredient(user, "1", id, Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "kg"}}})
+		op, err := store.Undo(ctx, "1", "1")
+		if err != nil || op.Type != IngredientAdded || quantityOf() != 100 {
+			t.Fatalf("The merge should be undone: %v %v %v", op, err, quantityOf())
+		}
+		if _, err := store.Redo(ctx, "1", "1"); err != nil || quantityOf() != 1100 {
+			t.Errorf("The merge should be redone: %v %v", err, quantityOf())
+		}
+		store.Undo(ctx, "1", "1")
+		store.Undo(ctx, "1", "1")
+		if _, err := store.GetIngredient(ctx, "1", id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("The ingredient should be removed: %v", err)
+		}
+		if _, err := store.Undo(ctx, "1", "1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		// A new operation clears the operations to redo
+		store.AddIngredient(user, "1", id, Ingredient{Quantities: []Quantity{{Amount: 5, Unit: "g"}}})
+		if _, err := store.Redo(ctx, "1", "1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		// The operations without user are not recorded, the ones of another user conflict
+		store.AddIngredient(ctx, "1", "000000000000000000000002", Ingredient{Quantities: []Quantity{{Amount: 1, Unit: "i"}}})
+		store.AddIngredient(WithUser(ctx, "2"), "1", id, Ingredient{Quantities: []Quantity{{Amount: 5, Unit: "g"}}})
+		if _, err := store.Undo(ctx, "1", "1"); !errors.Is(err, ErrJournalConflict) {
+			t.Errorf("Expected ErrJournalConflict, got %v", err)
+		}
+		if _, err := store.Undo(ctx, "1", "2"); err != nil || quantityOf() != 5 {
+			t.Errorf("The operation of the other user should be undone: %v %v", err, quantityOf())
+		}
+	})
+
+	t.Run("Undo the pantry deductions and the trips", func(t *testing.T) {
+		store := NewMemoryStore()
+		user := WithUser(ctx, "1")
+
+		store.SetPantryItem(ctx, "1", PantryItem{ID: "000000000000000000000001", Amount: 150, Unit: "g"})
+		r := Recipe{IngredientsID: []string{"000000000000000000000001"}}
+		ings := []Ingredient{{Quantities: []Quantity{{Amount: 100, Unit: "g", RecipeID: "r1"}}}}
+		store.AddRecipe(user, "1", "1", "r1", &r, &ings)
+		store.AddRecipe(user, "1", "1", "r1", &r, &ings)
+		store.CheckIngredient(user, "1", "000000000000000000000001", "1", true)
+		trip, _ := store.CompleteTrip(user, "1", "1")
+
+		op, err := store.Undo(ctx, "1", "1")
+		if err != nil || op.Type != TripCompleted {
+			t.Fatalf("Failed to undo the trip: %v %v", op, err)
+		}
+		if _, err := store.GetTrip(ctx, "1", trip.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("The trip should be removed: %v", err)
+		}
+		ingredient, err := store.GetIngredient(ctx, "1", "000000000000000000000001")
+		if err != nil || !ingredient.Checked || ingredient.Quantities[0].Amount != 50 {
+			t.Errorf("The ingredient should be back checked in the list: %v %v", ingredient, err)
+		}
+		if items, _ := store.GetPantryItem(ctx, "1", "000000000000000000000001"); len(items) != 0 {
+			t.Errorf("The purchased quantities should be removed from the pantry: %v", items)
+		}
+
+		store.Undo(ctx, "1", "1")
+		store.Undo(ctx, "1", "1")
+		store.Undo(ctx, "1", "1")
+		if list, _ := store.GetShoppingList(ctx, "1"); len(*list) != 0 {
+			t.Errorf("The recipes should be undone: %v", list)
+		}
+		if _, err := store.GetRecipe(ctx, "1", "r1"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("The recipe should be removed: %v", err)
+		}
+		items, err := store.GetPantryItem(ctx, "1", "000000000000000000000001")
+		if err != nil || items[0].Amount != 150 {
+			t.Errorf("The pantry should be restored: %v %v", items, err)
+		}
+
+		if _, err := store.Redo(ctx, "1", "1"); err != nil {
+			t.Fatalf("Failed to redo the recipe: %v", err)
+		}
+		if items, _ := store.GetPantryItem(ctx, "1", "000000000000000000000001"); len(items) != 1 || items[0].Amount != 50 {
+			t.Errorf("The pantry should be deducted again: %v", items)
+		}
+
+		// The undone operations are events of the projection
+		events, _ := store.GetEvents(ctx, "1", time.Time{})
+		state, err := replay(events, newListState())
+		if err != nil {
+			t.Fatalf("Failed to replay the events: %v", err)
+		}
+		if !maps.EqualFunc(state.ingredients, store.states["1"].ingredients, slices.Equal[[]Quantity]) || len(state.trips) != 0 {
+			t.Errorf("Wrong state replayed: %v, expected %v", state.ingredients, store.states["1"].ingredients)
+		}
+	})
+}
@@ -0,0 +1,379 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// The version of the data layout saved in Redis is kept under schemaVersionKey.
+// Migrate runs, in order, the migrations newer than this version and saves the version after each one.
+const (
+	schemaVersionKey = "schema:version"
+	migrationLockKey = "schema:migration:lock"
+	migrationLockTTL = 10 * time.Minute
+	// Delay between two checks of the migration run by another instance
+	migrationPollInterval = 500 * time.Millisecond
+	// Number of keys requested to Redis on each SCAN iteration
+	scanCount = 500
+)
+
+// renameScript renames the key when it still exists, the key may have been removed since it was scanned
+var renameScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("RENAME", KEYS[1], KEYS[2])
+end
+return 0
+`)
+
+// unlockScript deletes the lock only when it still holds the token of the instance, so that an instance
+// whose lock expired does not release the lock taken since by another instance
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// extendScript extends the lock only when it still holds the token of the instance
+var extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// ErrMigrationLockLost is returned when the lock of the migration expired while it was running, another instance
+// may be migrating the data
+var ErrMigrationLockLost = errors.New("the lock of the migration was lost")
+
+type migrationContextKey struct{}
+
+// withMigrationLock returns the context of the migration holding the lock of the token
+func withMigrationLock(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, migrationContextKey{}, token)
+}
+
+// extendLock extends the lock of the running migration by migrationLockTTL, ErrMigrationLockLost when it is not held
+// anymore. It does nothing outside of a migration.
+func (r *RedisStore) extendLock(ctx context.Context) error {
+	token, ok := ctx.Value(migrationContextKey{}).(string)
+	if !ok {
+		return nil
+	}
+	extended, err := extendScript.Run(ctx, r.rdb, []string{migrationLockKey}, token, migrationLockTTL.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if extended == 0 {
+		return ErrMigrationLockLost
+	}
+	return nil
+}
+
+type migration struct {
+	version int
+	name    string
+	up      func(r *RedisStore, ctx context.Context, l *logrus.Entry) error
+}
+
+// The migrations must be idempotent: an interrupted migration is run again at the next start
+var migrations = []migration{
+	{version: 1, name: "build the ingredient index", up: (*RedisStore).buildIngredientIndex},
+	{version: 2, name: "convert the ingredients and the recipes to hashes", up: (*RedisStore).convertToHashes},
+	{version: 3, name: "record the content of the lists in their event streams", up: (*RedisStore).snapshotLists},
+	{version: 4, name: "move the keys of the users under the user prefix", up: (*RedisStore).prefixUserKeys},
+}
+
+// SchemaVersion is the version of the data layout used by this code
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// GetSchemaVersion returns the version of the data saved in Redis, 0 when the data was never migrated
+func (r *RedisStore) GetSchemaVersion(ctx context.Context) (int, error) {
+	version, err := r.rdb.Get(ctx, schemaVersionKey).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, err
+}
+
+// Migrate brings the data saved in Redis to the SchemaVersion. Only one instance migrates the data,
+// the others wait until the migration is done.
+func (r *RedisStore) Migrate(ctx context.Context) error {
+	l := logger.WithField("method", "Migrate")
+
+	owner, _ := os.Hostname()
+	token := fmt.Sprintf("%s:%d:%s", owner, os.Getpid(), newID())
+	for {
+		version, err := r.GetSchemaVersion(ctx)
+		if err != nil {
+			l.WithError(err).Error("Failed to get the schema version")
+			return err
+		}
+		if version >= SchemaVersion() {
+			l.WithField("version", version).Debug("The schema is up to date")
+			return nil
+		}
+
+		locked, err := r.rdb.SetNX(ctx, migrationLockKey, token, migrationLockTTL).Result()
+		if err != nil {
+			l.WithError(err).Error("Failed to lock the migration")
+			return err
+		}
+		if locked {
+			return r.migrate(ctx, l, token)
+		}
+
+		l.Info("Waiting for the migration of another instance")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(migrationPollInterval):
+		}
+	}
+}
+
+// migrate runs the migrations newer than the saved version, the lock of the token is held. The lock is extended
+// before each migration and each batch of scanned keys, the migration stops when it was lost.
+func (r *RedisStore) migrate(ctx context.Context, l *logrus.Entry, token string) error {
+	defer func() {
+		if err := unlockScript.Run(ctx, r.rdb, []string{migrationLockKey}, token).Err(); err != nil {
+			l.WithError(err).Error("Failed to unlock the migration")
+		}
+	}()
+
+	// Another instance may have finished the migration before we took the lock
+	version, err := r.GetSchemaVersion(ctx)
+	if err != nil {
+		l.WithError(err).Error("Failed to get the schema version")
+		return err
+	}
+
+	ctx = withMigrationLock(ctx, token)
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		ml := l.WithFields(logrus.Fields{
+			"version":   m.version,
+			"migration": m.name,
+		})
+		if err := r.extendLock(ctx); err != nil {
+			ml.WithError(err).Error("Failed to extend the lock of the migration")
+			return err
+		}
+		ml.Info("Running migration")
+		if err := m.up(r, ctx, ml); err != nil {
+			ml.WithError(err).Error("Migration failed")
+			return err
+		}
+		if err := r.rdb.Set(ctx, schemaVersionKey, m.version, 0).Err(); err != nil {
+			ml.WithError(err).Error("Failed to save the schema version")
+			return err
+		}
+		ml.Info("Migration done")
+	}
+	return nil
+}
+
+// scan iterates the keys matching the pattern with the given type, or of any type when it is empty. The cursor is saved
+// after each batch so that an interrupted migration resumes where it stopped instead of scanning everything again.
+func (r *RedisStore) scan(ctx context.Context, version int, match string, keyType string, fn func(keys []string) error) error {
+	cursorKey := fmt.Sprintf("schema:migration:%d:cursor", version)
+	cursor, err := r.rdb.Get(ctx, cursorKey).Uint64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+
+	for {
+		if err := r.extendLock(ctx); err != nil {
+			return err
+		}
+		keys, next, err := r.rdb.ScanType(ctx, cursor, match, scanCount, keyType).Result()
+		if err != nil {
+			return err
+		}
+		if err := fn(keys); err != nil {
+			return err
+		}
+		if next == 0 {
+			break
+		}
+		if err := r.rdb.Set(ctx, cursorKey, next, 0).Err(); err != nil {
+			return err
+		}
+		cursor = next
+	}
+	return r.rdb.Del(ctx, cursorKey).Err()
+}
+
+// buildIngredientIndex adds the ingredients saved before the index existed to the index of their list
+func (r *RedisStore) buildIngredientIndex(ctx context.Context, l *logrus.Entry) error {
+	indexed := 0
+	err := r.scan(ctx, 1, "*:ingredient:*", "string", func(keys []string) error {
+		pipe := r.rdb.Pipeline()
+		for _, key := range keys {
+			i := strings.LastIndex(key, ":ingredient:")
+			ns, ingredientId := key[:i], key[i+len(":ingredient:"):]
+			pipe.SAdd(ctx, ingredientIndexKey(ns), ingredientId)
+		}
+		indexed += len(keys)
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	l.WithField("ingredients", indexed).Info("Ingredients indexed")
+	return err
+}
+
+// convertToHashes converts the ingredients saved as JSON []Quantity and the recipes saved as JSON []string
+// to the hashes of the schema version 2. The keys already converted are not strings anymore and are skipped.
+func (r *RedisStore) convertToHashes(ctx context.Context, l *logrus.Entry) error {
+	converted := 0
+	err := r.scan(ctx, 2, "*", "string", func(keys []string) error {
+		for _, key := range keys {
+			var err error
+			switch {
+			case strings.Contains(key, ":ingredient:"):
+				err = r.convertToHash(ctx, key, func(value string) (map[string]string, error) {
+					var quantities []Quantity
+					if err := json.Unmarshal([]byte(value), &quantities); err != nil {
+						return nil, err
+					}
+					return encodeQuantities(mergeQuantities(nil, quantities)), nil
+				})
+			case strings.Contains(key, ":recipe:"):
+				err = r.convertToHash(ctx, key, func(value string) (map[string]string, error) {
+					var ingredientsID []string
+					if err := json.Unmarshal([]byte(value), &ingredientsID); err != nil {
+						return nil, err
+					}
+					return encodeRecipe(Recipe{
+						IngredientsID: ingredientsID,
+						CreatedAt:     now(),
+						UpdatedAt:     now(),
+					}), nil
+				})
+			default:
+				continue
+			}
+			if err != nil {
+				l.WithField("key", key).WithError(err).Error("Failed to convert the key")
+				return err
+			}
+			converted++
+		}
+		return nil
+	})
+	l.WithField("keys", converted).Info("Keys converted to hashes")
+	return err
+}
+
+// convertToHash replaces the string saved under the key by the hash fields returned by decode, atomically
+func (r *RedisStore) convertToHash(ctx context.Context, key string, decode func(value string) (map[string]string, error)) error {
+	txf := func(tx *redis.Tx) error {
+		// The key was removed or already converted since it was scanned
+		keyType, err := tx.Type(ctx, key).Result()
+		if err != nil || keyType != "string" {
+			return err
+		}
+		value, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		fields, err := decode(value)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if len(fields) > 0 {
+				pipe.HSet(ctx, key, fields)
+			}
+			return nil
+		})
+		return err
+	}
+	return r.watch(ctx, txf, key)
+}
+
+// snapshotLists appends a ListSnapshot event of every ingredient and recipe saved before the events were recorded,
+// so that the projection of the events starts with the content of the list. Replaying a snapshot again sets the same
+// content, an interrupted migration can add the snapshots of a batch twice.
+func (r *RedisStore) snapshotLists(ctx context.Context, l *logrus.Entry) error {
+	snapshots := 0
+	err := r.scan(ctx, 3, "*", "hash", func(keys []string) error {
+		pipe := r.rdb.Pipeline()
+		for _, key := range keys {
+			event := Event{Type: ListSnapshot, At: now()}
+			var ns string
+			if i := strings.LastIndex(key, ":ingredient:"); i >= 0 {
+				ns = key[:i]
+				ingredient, err := getIngredient(ctx, r.rdb, ns, key[i+len(":ingredient:"):])
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				event.Ingredients = []Ingredient{*ingredient}
+			} else if i := strings.LastIndex(key, ":recipe:"); i >= 0 {
+				ns = key[:i]
+				recipeId := key[i+len(":recipe:"):]
+				recipe, err := getRecipe(ctx, r.rdb, ns, recipeId)
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				event.Recipes = map[string]Recipe{recipeId: *recipe}
+			} else {
+				continue
+			}
+			if err := saveEvents(ctx, pipe, ns, []Event{event}); err != nil {
+				return err
+			}
+			snapshots++
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	l.WithField("snapshots", snapshots).Info("Lists recorded in their event streams")
+	return err
+}
+
+// userKeyLayout matches the keys of the users before the user prefix, <userId>:<key>: the keys of the user and the keys
+// of their primary list, saved in the namespace of its owner. The other keys of the dataset are not ours.
+var userKeyLayout = regexp.MustCompile(`^[^:]+:(lists|lists:primary|pantry|aisles|recipe-stats:count|recipe-stats:last-used|` +
+	`ingredients|events|trips|(ingredient|recipe|trip):.+|journal:[^:]+(:redo)?)$`)
+
+// prefixUserKeys moves the keys of the users, <userId>:*, under user:<userId>:*, the primary lists with them since they
+// have the namespace of their owner. The primary list of a user named list:<listId> used to share the keys of the list.
+// Only the keys of the layout of the users are moved, the Redis may be shared with other applications.
+func (r *RedisStore) prefixUserKeys(ctx context.Context, l *logrus.Entry) error {
+	moved := 0
+	err := r.scan(ctx, 4, "*", "", func(keys []string) error {
+		pipe := r.rdb.Pipeline()
+		for _, key := range keys {
+			if strings.HasPrefix(key, "user:") || strings.HasPrefix(key, "list:") || !userKeyLayout.MatchString(key) {
+				continue
+			}
+			renameScript.Eval(ctx, pipe, []string{key, userKey(key)})
+			moved++
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	})
+	l.WithField("keys", moved).Info("Keys of the users moved")
+	return err
+}
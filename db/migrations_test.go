@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"shopping-list/tests"
+	"testing"
+	"time"
+)
+
+func TestMigrationLock(t *testing.T) {
+	tests.SkipWithoutDocker(t)
+	ctx := context.Background()
+	rdb, pool, resource := tests.InitTestDocker("6379")
+	defer tests.CloseTestDocker(rdb, pool, resource)
+	r := NewRedisStore(rdb)
+
+	t.Run("The lock is extended while the migration runs", func(t *testing.T) {
+		rdb.Set(ctx, migrationLockKey, "token", time.Second)
+		err := r.scan(withMigrationLock(ctx, "token"), 0, "*", "", func(keys []string) error { return nil })
+		if err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		if ttl := rdb.PTTL(ctx, migrationLockKey).Val(); ttl <= time.Second {
+			t.Errorf("The lock should be extended, expires in %v", ttl)
+		}
+	})
+
+	t.Run("The migration stops when the lock is lost", func(t *testing.T) {
+		rdb.Set(ctx, migrationLockKey, "other", time.Minute)
+		called := false
+		err := r.scan(withMigrationLock(ctx, "token"), 0, "*", "", func(keys []string) error {
+			called = true
+			return nil
+		})
+		if !errors.Is(err, ErrMigrationLockLost) || called {
+			t.Errorf("Expected ErrMigrationLockLost before the first batch, got %v", err)
+		}
+		if owner := rdb.Get(ctx, migrationLockKey).Val(); owner != "other" {
+			t.Errorf("The lock of the other instance should be left alone, got %q", owner)
+		}
+	})
+}
@@ -1,5 +1,10 @@
 package db
 
+import (
+	"slices"
+	"time"
+)
+
 type Quantity struct {
 	Amount   float64 `json:"amount"`
 	Unit     string  `json:"unit"`
@@ -9,8 +14,106 @@ type Quantity struct {
 type Ingredient struct {
 	ID         string     `json:"id" validate:"omitempty"`
 	Quantities []Quantity `json:"quantities"`
+	// The ingredient was purchased, by CheckedBy at CheckedAt
+	Checked   bool       `json:"checked"`
+	CheckedBy string     `json:"checked_by,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
 }
 
 type Recipe struct {
-	IngredientsID []string `json:"ingredients"`
+	IngredientsID []string  `json:"ingredients"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// PantryItem is the amount of an ingredient, in one unit, already available at home
+type PantryItem struct {
+	ID     string  `json:"id"`
+	Amount float64 `json:"amount"`
+	Unit   string  `json:"unit"`
+}
+
+// Deduction explains how much of a recipe ingredient was taken from the pantry, only the shortfall is added to the list
+type Deduction struct {
+	ID         string  `json:"id"`
+	Unit       string  `json:"unit"`
+	Requested  float64 `json:"requested"`
+	FromPantry float64 `json:"from_pantry"`
+	Shortfall  float64 `json:"shortfall"`
+}
+
+// Trip is the immutable record of the ingredients purchased during a shopping trip
+type Trip struct {
+	ID          string       `json:"id"`
+	CompletedBy string       `json:"completed_by"`
+	CompletedAt time.Time    `json:"completed_at"`
+	Ingredients []Ingredient `json:"ingredients"`
+}
+
+type RecipeStats struct {
+	RecipeID   string    `json:"recipe_id"`
+	TimesAdded int64     `json:"times_added"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// List is a named shopping list of a user. Each user has a primary list, created on first use,
+// which receives the recipes and the ingredients added without a list ID.
+type List struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Primary   bool      `json:"primary"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role of the user who requested the list
+	Role Role `json:"role,omitempty"`
+}
+
+// Role gives the permissions of a user on a list. The viewers read the list,
+// the editors also change its content and the owner manages the list and its members.
+type Role string
+
+const (
+	RoleViewer Role = "viewer"
+	RoleEditor Role = "editor"
+	RoleOwner  Role = "owner"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Allows tells if the role has at least the permissions of the needed role
+func (r Role) Allows(need Role) bool {
+	return roleRanks[r] > 0 && roleRanks[r] >= roleRanks[need]
+}
+
+type Member struct {
+	UserID string `json:"user_id"`
+	Role   Role   `json:"role"`
+}
+
+// Namespace prefixes the keys of the recipes and the ingredients of the list.
+// The primary list keeps the namespace of the user used before lists existed.
+func (l List) Namespace() string {
+	if l.Primary {
+		return userKey(l.Owner)
+	}
+	return listKey(l.ID)
+}
+
+// recipeIDs returns the recipes of the quantity lines of the ingredient
+func (i Ingredient) recipeIDs() []string {
+	recipeIds := make([]string, 0)
+	for _, quantity := range i.Quantities {
+		if quantity.RecipeID != "" && !slices.Contains(recipeIds, quantity.RecipeID) {
+			recipeIds = append(recipeIds, quantity.RecipeID)
+		}
+	}
+	return recipeIds
+}
+
+func (r Recipe) equal(other Recipe) bool {
+	return slices.Equal(r.IngredientsID, other.IngredientsID) && r.CreatedAt.Equal(other.CreatedAt) && r.UpdatedAt.Equal(other.UpdatedAt)
 }
@@ -0,0 +1,221 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"shopping-list/units"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The pantry of the user is saved as a hash under user:<userId>:pantry, <ingredientId>:<unit> -> amount
+func pantryKey(userId string) string {
+	return userKey(userId) + ":pantry"
+}
+
+func encodePantry(pantry map[string][]Quantity) map[string]string {
+	fields := make(map[string]string)
+	for id, quantities := range pantry {
+		for _, quantity := range quantities {
+			fields[id+":"+quantity.Unit] = strconv.FormatFloat(quantity.Amount, 'f', -1, 64)
+		}
+	}
+	return fields
+}
+
+func decodePantry(fields map[string]string) (map[string][]Quantity, error) {
+	pantry := make(map[string][]Quantity)
+	for field, value := range fields {
+		// The units never have a colon, unlike the ingredient IDs
+		i := strings.LastIndex(field, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid field %q of the pantry", field)
+		}
+		id, unit := field[:i], field[i+1:]
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, err
+		}
+		pantry[id] = append(pantry[id], Quantity{Amount: amount, Unit: unit})
+	}
+	for id := range pantry {
+		sortQuantities(pantry[id])
+	}
+	return pantry, nil
+}
+
+// pantryItems returns the items of the pantry sorted by ingredient and unit
+func pantryItems(pantry map[string][]Quantity) []PantryItem {
+	items := make([]PantryItem, 0, len(pantry))
+	for id, quantities := range pantry {
+		for _, quantity := range quantities {
+			items = append(items, PantryItem{ID: id, Amount: quantity.Amount, Unit: quantity.Unit})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].ID != items[j].ID {
+			return items[i].ID < items[j].ID
+		}
+		return items[i].Unit < items[j].Unit
+	})
+	return items
+}
+
+// setPantryItem replaces the amount of the item, in the base unit of its dimension. An item without amount is removed.
+func setPantryItem(pantry map[string][]Quantity, item PantryItem) {
+	item.Amount, item.Unit = units.Normalize(item.Amount, item.Unit)
+	quantities := make([]Quantity, 0, len(pantry[item.ID])+1)
+	for _, quantity := range pantry[item.ID] {
+		if quantity.Unit != item.Unit {
+			quantities = append(quantities, quantity)
+		}
+	}
+	if item.Amount > 0 {
+		quantities = append(quantities, Quantity{Amount: item.Amount, Unit: item.Unit})
+	}
+	if len(quantities) == 0 {
+		delete(pantry, item.ID)
+		return
+	}
+	pantry[item.ID] = sortQuantities(quantities)
+}
+
+// removePantryItem removes the ingredient in the dimension of the unit, or in all the units when unit is empty
+func removePantryItem(pantry map[string][]Quantity, ingredientId string, unit string) error {
+	quantities, ok := pantry[ingredientId]
+	if !ok {
+		return ErrNotFound
+	}
+	if unit == "" {
+		delete(pantry, ingredientId)
+		return nil
+	}
+	_, unit = units.Normalize(0, unit)
+	for _, quantity := range quantities {
+		if quantity.Unit == unit {
+			setPantryItem(pantry, PantryItem{ID: ingredientId, Unit: unit})
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// takeFromPantry takes the quantities available in the pantry, when it is loaded, and returns the shortfall
+// with the explanation of each deduction
+func (s *listState) takeFromPantry(ingredientId string, quantities []Quantity, deductions []Deduction) ([]Quantity, []Deduction) {
+	if s.pantry == nil {
+		return quantities, deductions
+	}
+	shortfall := make([]Quantity, 0, len(quantities))
+	for _, quantity := range NormalizeQuantities(quantities) {
+		available := 0.0
+		for _, stock := range s.pantry[ingredientId] {
+			if stock.Unit == quantity.Unit {
+				available = stock.Amount
+			}
+		}
+		taken := math.Min(available, quantity.Amount)
+		if taken > 0 {
+			setPantryItem(s.pantry, PantryItem{ID: ingredientId, Amount: available - taken, Unit: quantity.Unit})
+			deductions = append(deductions, Deduction{
+				ID:         ingredientId,
+				Unit:       quantity.Unit,
+				Requested:  quantity.Amount,
+				FromPantry: taken,
+				Shortfall:  quantity.Amount - taken,
+			})
+		}
+		if quantity.Amount > taken {
+			quantity.Amount -= taken
+			shortfall = append(shortfall, quantity)
+		}
+	}
+	return shortfall, deductions
+}
+
+// addToPantry adds the purchased quantities to the pantry when it is loaded
+func (s *listState) addToPantry(ingredientId string, quantities []Quantity) {
+	if s.pantry == nil {
+		return
+	}
+	added := make([]Quantity, len(quantities))
+	for i, quantity := range quantities {
+		added[i] = Quantity{Amount: quantity.Amount, Unit: quantity.Unit}
+	}
+	s.pantry[ingredientId] = sortQuantities(mergeQuantities(s.pantry[ingredientId], added))
+}
+
+func getPantry(ctx context.Context, c redis.Cmdable, userId string) (map[string][]Quantity, error) {
+	fields, err := c.HGetAll(ctx, pantryKey(userId)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the pantry of user: " + userId)
+		return nil, err
+	}
+	pantry, err := decodePantry(fields)
+	if err != nil {
+		logger.WithError(err).Error("Failed to decode the pantry of user: " + userId)
+		return nil, err
+	}
+	return pantry, nil
+}
+
+func (r *RedisStore) GetPantry(ctx context.Context, userId string) ([]PantryItem, error) {
+	pantry, err := getPantry(ctx, r.rdb, userId)
+	if err != nil {
+		return nil, err
+	}
+	return pantryItems(pantry), nil
+}
+
+func (r *RedisStore) GetPantryItem(ctx context.Context, userId string, ingredientId string) ([]PantryItem, error) {
+	pantry, err := getPantry(ctx, r.rdb, userId)
+	if err != nil {
+		return nil, err
+	}
+	quantities, ok := pantry[ingredientId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return pantryItems(map[string][]Quantity{ingredientId: quantities}), nil
+}
+
+// updatePantry runs fn on the pantry of the user in an optimistic transaction
+func (r *RedisStore) updatePantry(ctx context.Context, userId string, fn func(pantry map[string][]Quantity) error) error {
+	err := r.watch(ctx, func(tx *redis.Tx) error {
+		pantry, err := getPantry(ctx, tx, userId)
+		if err != nil {
+			return err
+		}
+		before := encodePantry(pantry)
+		if err := fn(pantry); err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			saveHash(ctx, pipe, pantryKey(userId), before, encodePantry(pantry))
+			return nil
+		})
+		return err
+	}, pantryKey(userId))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		logger.WithError(err).Error("Failed to update the pantry of user: " + userId)
+	}
+	return err
+}
+
+func (r *RedisStore) SetPantryItem(ctx context.Context, userId string, item PantryItem) error {
+	return r.updatePantry(ctx, userId, func(pantry map[string][]Quantity) error {
+		setPantryItem(pantry, item)
+		return nil
+	})
+}
+
+func (r *RedisStore) RemovePantryItem(ctx context.Context, userId string, ingredientId string, unit string) error {
+	return r.updatePantry(ctx, userId, func(pantry map[string][]Quantity) error {
+		return removePantryItem(pantry, ingredientId, unit)
+	})
+}
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPantryEncoding(t *testing.T) {
+	pantry := map[string][]Quantity{
+		"000000000000000000000001": {{Amount: 500, Unit: "g"}, {Amount: 2, Unit: "i"}},
+		// The IDs given by the CSV imports can have a colon
+		"catalog:flour": {{Amount: 1.5, Unit: "ml"}},
+	}
+	decoded, err := decodePantry(encodePantry(pantry))
+	if err != nil {
+		t.Fatalf("Failed to decode the pantry: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, pantry) {
+		t.Errorf("The pantry should be read back as it was: %v, expected %v", decoded, pantry)
+	}
+	if _, err := decodePantry(map[string]string{"000000000000000000000001": "1"}); err == nil {
+		t.Errorf("A field without unit should fail")
+	}
+}
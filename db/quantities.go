@@ -0,0 +1,109 @@
+package db
+
+import (
+	"shopping-list/units"
+	"slices"
+	"sort"
+)
+
+// filterQuantities keeps the quantities of the given recipe, or all of them when no recipe is provided
+func filterQuantities(quantities []Quantity, recipeIds ...string) []Quantity {
+	recipeId := ""
+
+	if len(recipeIds) > 0 {
+		recipeId = recipeIds[0]
+	}
+	if recipeId == "" {
+		return quantities
+	}
+
+	var filteredQuantities []Quantity
+	for _, quantity := range quantities {
+		if quantity.RecipeID == recipeId {
+			filteredQuantities = append(filteredQuantities, quantity)
+		}
+	}
+	return filteredQuantities
+}
+
+// mergeQuantities adds the quantities to the saved ones. The quantities are normalised to the base unit
+// of their dimension, a quantity is summed with a saved one when the unit and the recipeID are the same,
+// otherwise it is appended as a new line.
+func mergeQuantities(saved []Quantity, added []Quantity) []Quantity {
+	merged := make([]Quantity, 0, len(saved)+len(added))
+	merged = append(merged, saved...)
+	return NormalizeQuantities(append(merged, added...))
+}
+
+// removeRecipeQuantities removes all the quantity lines of the recipe, the lines added without recipe when recipeId is empty
+func removeRecipeQuantities(quantities []Quantity, recipeId string) []Quantity {
+	return slices.DeleteFunc(slices.Clone(quantities), func(quantity Quantity) bool {
+		return quantity.RecipeID == recipeId
+	})
+}
+
+// recipeIDsOf returns the recipes of the quantity lines, without duplicates
+func recipeIDsOf(quantities []Quantity) []string {
+	recipeIds := make([]string, 0, len(quantities))
+	for _, quantity := range quantities {
+		if quantity.RecipeID != "" && !slices.Contains(recipeIds, quantity.RecipeID) {
+			recipeIds = append(recipeIds, quantity.RecipeID)
+		}
+	}
+	return recipeIds
+}
+
+// sortQuantities orders the quantity lines: the lines added without recipe first, then by recipe and unit
+func sortQuantities(quantities []Quantity) []Quantity {
+	sort.SliceStable(quantities, func(i, j int) bool {
+		if quantities[i].RecipeID != quantities[j].RecipeID {
+			return quantities[i].RecipeID < quantities[j].RecipeID
+		}
+		return quantities[i].Unit < quantities[j].Unit
+	})
+	return quantities
+}
+
+// NormalizeQuantities converts the quantities to the base unit of their dimension,
+// and sums the lines of a same recipe ending up in the same unit
+func NormalizeQuantities(quantities []Quantity) []Quantity {
+	normalized := make([]Quantity, 0, len(quantities))
+	for _, quantity := range quantities {
+		quantity.Amount, quantity.Unit = units.Normalize(quantity.Amount, quantity.Unit)
+		found := false
+		for i, saved := range normalized {
+			if quantity.Unit == saved.Unit && quantity.RecipeID == saved.RecipeID {
+				normalized[i].Amount += quantity.Amount
+				found = true
+				break
+			}
+		}
+		if !found {
+			normalized = append(normalized, quantity)
+		}
+	}
+	return sortQuantities(normalized)
+}
+
+// collapseQuantities converts the volume and count lines of the ingredient to grams when it also has
+// a mass line and its density or piece weight is known, so that they are summed in a single total
+func collapseQuantities(ingredientId string, quantities []Quantity) []Quantity {
+	quantities = NormalizeQuantities(quantities)
+	hasMass := false
+	for _, quantity := range quantities {
+		if unit, err := units.Lookup(quantity.Unit); err == nil && unit.Dimension == units.Mass {
+			hasMass = true
+		}
+	}
+	if !hasMass {
+		return quantities
+	}
+	collapsed := make([]Quantity, len(quantities))
+	for i, quantity := range quantities {
+		if grams, ok := units.ToMass(ingredientId, quantity.Amount, quantity.Unit); ok {
+			quantity.Amount, quantity.Unit = grams, "g"
+		}
+		collapsed[i] = quantity
+	}
+	return NormalizeQuantities(collapsed)
+}
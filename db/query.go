@@ -2,7 +2,10 @@ package db
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"math/rand"
+	"slices"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -12,279 +15,430 @@ var logger = logrus.WithFields(logrus.Fields{
 	"context": "db/query",
 })
 
-func GetIngredient(rdb *redis.Client, userId string, ingredientId string, recipeIds ...string) (*Ingredient, error) {
+// Number of times a transaction is retried when a watched key is modified concurrently
+const maxTransactionRetries = 100
 
-	ctx := context.Background()
-	res, err := rdb.Get(ctx, userId+":ingredient:"+ingredientId).Result()
-	if err != nil {
-		logger.WithError(err).Error("Failed to get ingredient: " + ingredientId)
-		return nil, err
-	}
+// Maximum delay before retrying a conflicting transaction
+const maxRetryDelay = 2 * time.Millisecond
 
-	var quantities []Quantity
-	err = json.Unmarshal([]byte(res), &quantities)
-	if err != nil {
-		logger.WithError(err).Error("Failed to unmarshal ingredient: " + ingredientId)
-		return nil, err
-	}
+// ErrTransactionConflict is returned when a transaction still conflicts after all the retries
+var ErrTransactionConflict = errors.New("too many concurrent modifications, transaction aborted")
 
-	// Filter the quantities by recipeId if it is provided
-	recipeId := ""
+// errRecipesChanged aborts a removal when the ingredient has a line of a recipe not loaded in the transaction
+var errRecipesChanged = errors.New("the recipes of the ingredient changed")
 
-	if len(recipeIds) > 0 {
-		recipeId = recipeIds[0]
-	}
-	if recipeId != "" {
-		// Filter the quantities by recipeId
-		var filteredQuantities []Quantity
-		for _, quantity := range quantities {
-			if quantity.RecipeID == recipeId {
-				filteredQuantities = append(filteredQuantities, quantity)
-			}
-		}
-		quantities = filteredQuantities
+// RedisStore is the Store backed by a Redis server
+type RedisStore struct {
+	rdb *redis.Client
+}
+
+func NewRedisStore(rdb *redis.Client) *RedisStore {
+	return &RedisStore{
+		rdb: rdb,
 	}
+}
 
-	// Otherwise, return all the quantities
+func (r *RedisStore) Ping(ctx context.Context) error {
+	return r.rdb.Ping(ctx).Err()
+}
 
-	return &Ingredient{
-		ID:         ingredientId,
-		Quantities: quantities,
-	}, nil
+func (r *RedisStore) Close() error {
+	return r.rdb.Close()
 }
 
-func GetIngredientRecipe(rdb *redis.Client, userId string, ingredientId string, recipeId string) (*Ingredient, error) {
-	return GetIngredient(rdb, userId, ingredientId, recipeId)
+func ingredientKey(ns string, ingredientId string) string {
+	return ns + ":ingredient:" + ingredientId
 }
 
-func GetRecipe(rdb *redis.Client, userId string, recipeId string) (*Recipe, error) {
+func recipeKey(ns string, recipeId string) string {
+	return ns + ":recipe:" + recipeId
+}
 
-	ctx := context.Background()
-	res, err := rdb.Get(ctx, userId+":recipe:"+recipeId).Result()
+// ingredientIndexKey is the set of the ingredient IDs of the shopping list
+func ingredientIndexKey(ns string) string {
+	return ns + ":ingredients"
+}
 
+func getIngredient(ctx context.Context, c redis.Cmdable, ns string, ingredientId string) (*Ingredient, error) {
+	fields, err := c.HGetAll(ctx, ingredientKey(ns, ingredientId)).Result()
 	if err != nil {
-		logger.WithError(err).Error("Failed to get recipe: " + recipeId)
+		logger.WithError(err).Error("Failed to get ingredient: " + ingredientId)
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
+
+	ingredient, err := decodeIngredient(ingredientId, fields)
+	if err != nil {
+		logger.WithError(err).Error("Failed to decode ingredient: " + ingredientId)
 		return nil, err
 	}
+	return ingredient, nil
+}
 
-	var ingredientsID []string
-	err = json.Unmarshal([]byte(res), &ingredientsID)
+func getRecipe(ctx context.Context, c redis.Cmdable, ns string, recipeId string) (*Recipe, error) {
+	fields, err := c.HGetAll(ctx, recipeKey(ns, recipeId)).Result()
 	if err != nil {
-		logger.WithError(err).Error("Failed to unmarshal recipe: " + recipeId)
+		logger.WithError(err).Error("Failed to get recipe: " + recipeId)
 		return nil, err
 	}
-	return &Recipe{
-		IngredientsID: ingredientsID,
-	}, nil
+	if len(fields) == 0 {
+		return nil, ErrNotFound
+	}
 
+	recipe, err := decodeRecipe(fields)
+	if err != nil {
+		logger.WithError(err).Error("Failed to decode recipe: " + recipeId)
+		return nil, err
+	}
+	return &recipe, nil
 }
 
-// TODO: Add a counter of time to check how many times the recipe is used
-func AddRecipe(rdb *redis.Client, userId string, recipeID string, recipe *Recipe, ingredients *[]Ingredient) error {
+func (r *RedisStore) GetIngredient(ctx context.Context, ns string, ingredientId string, recipeIds ...string) (*Ingredient, error) {
+	ingredient, err := getIngredient(ctx, r.rdb, ns, ingredientId)
+	if err != nil {
+		return nil, err
+	}
+	ingredient.Quantities = filterQuantities(ingredient.Quantities, recipeIds...)
+	return ingredient, nil
+}
 
-	ctx := context.Background()
+func (r *RedisStore) GetIngredientRecipe(ctx context.Context, ns string, ingredientId string, recipeId string) (*Ingredient, error) {
+	return r.GetIngredient(ctx, ns, ingredientId, recipeId)
+}
 
-	recipeSaved, _ := GetRecipe(rdb, userId, recipeID)
+func (r *RedisStore) GetRecipe(ctx context.Context, ns string, recipeId string) (*Recipe, error) {
+	return getRecipe(ctx, r.rdb, ns, recipeId)
+}
 
-	// Save the recipe if it does not exist
-	if recipeSaved == nil {
-		ingredientsID, err := json.Marshal(recipe.IngredientsID)
-		if err != nil {
-			logger.WithField("recipe", recipe).WithError(err).Error("Failed to marshal recipe")
-			return err
-		}
-		err = rdb.Set(ctx, userId+":recipe:"+recipeID, ingredientsID, 0).Err()
-		if err != nil {
-			logger.WithError(err).Error("Failed to set recipe: " + recipeID)
-			return err
+func (r *RedisStore) AddRecipe(ctx context.Context, ns string, userId string, recipeID string, recipe *Recipe, ingredients *[]Ingredient) ([]Deduction, error) {
+	var deductions []Deduction
+	err := r.updateWithPantry(ctx, ns, userId, []string{recipeID}, recipe.IngredientsID, func(state *listState) error {
+		deductions = state.addRecipe(recipeID, recipe, *ingredients)
+		if userId != "" {
+			state.usages = append(state.usages, recipeID)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return deductions, nil
+}
 
-	var err error
-	// Save the ingredients
-	for i, ingredient := range *ingredients {
-		_, err = AddIngredient(rdb, userId, recipe.IngredientsID[i], ingredient)
+func (r *RedisStore) GetShoppingList(ctx context.Context, ns string) (*[]Ingredient, error) {
+	ingredientIDs, err := r.rdb.SMembers(ctx, ingredientIndexKey(ns)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get ingredients")
+		return nil, err
 	}
+	ingredients := make([]Ingredient, 0, len(ingredientIDs))
+	if len(ingredientIDs) == 0 {
+		return &ingredients, nil
+	}
+	slices.Sort(ingredientIDs)
 
-	return err
-}
-
-func GetShoppingList(rdb *redis.Client, userId string) (*[]Ingredient, error) {
-	ctx := context.Background()
-	res, err := rdb.Keys(ctx, userId+":ingredient:*").Result()
+	cmds := make([]*redis.MapStringStringCmd, len(ingredientIDs))
+	_, err = r.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ingredientIDs {
+			cmds[i] = pipe.HGetAll(ctx, ingredientKey(ns, id))
+		}
+		return nil
+	})
 	if err != nil {
 		logger.WithError(err).Error("Failed to get ingredients")
 		return nil, err
 	}
-	ingredients := make([]Ingredient, 0)
-	for _, key := range res {
-		ingredientID := key[len(userId)+12:]
-		ingredient, err := GetIngredient(rdb, userId, ingredientID)
+
+	for i, cmd := range cmds {
+		// The ingredient was removed after the index was read
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+		ingredient, err := decodeIngredient(ingredientIDs[i], cmd.Val())
 		if err != nil {
+			logger.WithError(err).Error("Failed to decode ingredient: " + ingredientIDs[i])
 			return nil, err
 		}
-		ingredient.ID = ingredientID
+		// The quantities saved before the unit conversions are summed too
+		ingredient.Quantities = collapseQuantities(ingredient.ID, ingredient.Quantities)
 		ingredients = append(ingredients, *ingredient)
 	}
 
 	return &ingredients, nil
 }
 
-func RemoveRecipe(rdb *redis.Client, userId string, recipeId string) error {
-	r, err := GetRecipe(rdb, userId, recipeId)
-	if err != nil {
-		return err
-	}
-	for _, ingredientID := range r.IngredientsID {
-		err := RemoveIngredient(rdb, userId, ingredientID, recipeId, false)
-		if err != nil {
+func (r *RedisStore) RemoveRecipe(ctx context.Context, ns string, recipeId string) error {
+	return r.update(ctx, ns, []string{recipeId}, nil, func(state *listState) error {
+		return state.removeRecipe(recipeId)
+	})
+}
+
+func (r *RedisStore) RemoveIngredientFromRecipe(ctx context.Context, ns string, ingredientID string, recipeId string) error {
+	return r.update(ctx, ns, []string{recipeId}, []string{ingredientID}, func(state *listState) error {
+		return state.removeIngredientFromRecipe(ingredientID, recipeId)
+	})
+}
+
+func (r *RedisStore) RemoveIngredient(ctx context.Context, ns string, ingredientID string, recipeId string, removeAll bool) error {
+	for retry := 0; retry < maxTransactionRetries; retry++ {
+		// The recipes of the removed lines are updated in the same transaction
+		recipeIds := make([]string, 0)
+		if recipeId != "" {
+			recipeIds = append(recipeIds, recipeId)
+		}
+		if removeAll {
+			ingredient, err := getIngredient(ctx, r.rdb, ns, ingredientID)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+			if err == nil {
+				recipeIds = append(recipeIds, recipeIDsOf(ingredient.Quantities)...)
+			}
+		}
+
+		err := r.update(ctx, ns, recipeIds, []string{ingredientID}, func(state *listState) error {
+			if removeAll {
+				for _, id := range recipeIDsOf(state.ingredients[ingredientID]) {
+					if !slices.Contains(recipeIds, id) {
+						return errRecipesChanged
+					}
+				}
+			}
+			return state.removeIngredient(ingredientID, recipeId, removeAll)
+		})
+		if !errors.Is(err, errRecipesChanged) {
 			return err
 		}
 	}
+	logger.WithField("namespace", ns).Error("Failed to commit the transaction")
+	return ErrTransactionConflict
+}
 
-	// Remove the recipe
-	ctx := context.Background()
-	err = rdb.Del(ctx, userId+":recipe:"+recipeId).Err()
+func (r *RedisStore) AddIngredient(ctx context.Context, ns string, ingredientID string, ingredient Ingredient) (*Ingredient, bool, error) {
+	var ingredientSaved *Ingredient
+	var created bool
+	err := r.update(ctx, ns, ingredient.recipeIDs(), []string{ingredientID}, func(state *listState) error {
+		var err error
+		ingredientSaved, created, err = state.addIngredient(ingredientID, ingredient)
+		return err
+	})
 	if err != nil {
-		logger.WithError(err).Error("Failed to delete recipe: " + recipeId)
+		return nil, false, err
+	}
+	return ingredientSaved, created, nil
+}
+
+func (r *RedisStore) AddIngredients(ctx context.Context, ns string, ingredients []Ingredient) error {
+	recipeIds := make([]string, 0)
+	ingredientIds := make([]string, 0, len(ingredients))
+	for _, ingredient := range ingredients {
+		for _, id := range ingredient.recipeIDs() {
+			if !slices.Contains(recipeIds, id) {
+				recipeIds = append(recipeIds, id)
+			}
+		}
+		if !slices.Contains(ingredientIds, ingredient.ID) {
+			ingredientIds = append(ingredientIds, ingredient.ID)
+		}
+	}
+	return r.update(ctx, ns, recipeIds, ingredientIds, func(state *listState) error {
+		return state.addIngredients(ingredients)
+	})
+}
+
+func (r *RedisStore) CheckIngredient(ctx context.Context, ns string, ingredientID string, userId string, checked bool) (*Ingredient, error) {
+	var ingredientSaved *Ingredient
+	err := r.update(ctx, ns, nil, []string{ingredientID}, func(state *listState) error {
+		var err error
+		ingredientSaved, err = state.checkIngredient(ingredientID, userId, checked)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return ingredientSaved, nil
+}
 
+// waitRetry waits a random delay before retrying a conflicting transaction,
+// so that the concurrent transactions do not keep conflicting with each other
+func waitRetry(ctx context.Context) error {
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(maxRetryDelay))))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
-func RemoveIngredientFromRecipe(rdb *redis.Client, userId string, ingredientID string, recipeId string) error {
+// update runs fn on the recipes and the ingredients of the list in an optimistic transaction.
+// The keys are watched before being read, together with the ingredients of the recipes,
+// and the changes made by fn are written in a MULTI/EXEC block.
+// The whole read-modify-write is retried when one of the keys is modified concurrently.
+func (r *RedisStore) update(ctx context.Context, ns string, recipeIDs []string, ingredientIDs []string, fn func(state *listState) error) error {
+	return r.updateWithPantry(ctx, ns, "", recipeIDs, ingredientIDs, fn)
+}
 
-	r, err := GetRecipe(rdb, userId, recipeId)
-	if err != nil {
-		return err
+// updateWithPantry is update with the pantry of the user loaded in the state, and saved in the same transaction
+func (r *RedisStore) updateWithPantry(ctx context.Context, ns string, userId string, recipeIDs []string, ingredientIDs []string, fn func(state *listState) error) error {
+	keys := make([]string, 0, len(recipeIDs)+len(ingredientIDs)+1)
+	if userId != "" {
+		keys = append(keys, pantryKey(userId))
 	}
-	// Check the ingedientID is in the recipe
-	newIngredientsID := make([]string, 0)
-	for _, id := range r.IngredientsID {
-		if id != ingredientID {
-			newIngredientsID = append(newIngredientsID, id)
-		}
+	for _, id := range recipeIDs {
+		keys = append(keys, recipeKey(ns, id))
+	}
+	for _, id := range ingredientIDs {
+		keys = append(keys, ingredientKey(ns, id))
 	}
 
-	if len(newIngredientsID) == 0 {
-		err := RemoveRecipe(rdb, userId, recipeId)
-		return err
-	} else {
-		// Save the updated ingredients
-		ingredientsID, err := json.Marshal(newIngredientsID)
+	txf := func(tx *redis.Tx) error {
+		state, err := r.load(ctx, tx, ns, recipeIDs, ingredientIDs)
 		if err != nil {
-			logger.WithField("recipe", r).WithError(err).Error("Failed to marshal recipe")
 			return err
 		}
-		ctx := context.Background()
-		err = rdb.Set(ctx, userId+":recipe:"+recipeId, ingredientsID, 0).Err()
-		if err != nil {
-			logger.WithError(err).Error("Failed to set recipe: " + recipeId)
-			return err
+		if userId != "" {
+			if state.pantry, err = getPantry(ctx, tx, userId); err != nil {
+				return err
+			}
 		}
-	}
+		before := state.clone()
 
-	return nil
-}
+		if err := fn(state); err != nil {
+			return err
+		}
 
-func RemoveIngredient(rdb *redis.Client, userId string, ingredientID string, recipeId string, removeAll bool) error {
-	ctx := context.Background()
-	ingredient, err := GetIngredient(rdb, userId, ingredientID)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := r.commit(ctx, pipe, ns, userId, before, state); err != nil {
+				return err
+			}
+			// Only the operations of a user can be undone
+			if user := UserFromContext(ctx); user != "" {
+				if op := newOperation(before, state); op != nil {
+					return saveOperation(ctx, pipe, ns, user, op)
+				}
+			}
+			return nil
+		})
+		return err
+	}
 
-	if removeAll {
-		err = rdb.Del(ctx, userId+":ingredient:"+ingredientID).Err()
-		if err != nil {
-			logger.WithError(err).Error("Failed to delete ingredient: " + ingredientID)
+	for retry := 0; retry < maxTransactionRetries; retry++ {
+		err := r.rdb.Watch(ctx, txf, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		logger.WithFields(logrus.Fields{
+			"namespace": ns,
+			"retry":     retry,
+		}).Debug("Transaction conflict, retrying")
+		if err := waitRetry(ctx); err != nil {
 			return err
 		}
-		return nil
 	}
+	logger.WithField("namespace", ns).Error("Failed to commit the transaction")
+	return ErrTransactionConflict
+}
 
-	if err != nil {
+// commit queues the writes of the changes since the before state, with the pantry of the user when it is loaded,
+// and the events of the operation
+func (r *RedisStore) commit(ctx context.Context, pipe redis.Pipeliner, ns string, userId string, before *listState, state *listState) error {
+	if userId != "" {
+		beforeFields, afterFields := encodePantry(before.pantry), encodePantry(state.pantry)
+		if len(beforeFields) > 0 || len(afterFields) > 0 {
+			saveHash(ctx, pipe, pantryKey(userId), beforeFields, afterFields)
+		}
+	}
+	if err := r.save(ctx, pipe, ns, before, state); err != nil {
 		return err
 	}
-	for i, quantity := range ingredient.Quantities {
-		if quantity.RecipeID == recipeId {
-			ingredient.Quantities = append(ingredient.Quantities[:i], ingredient.Quantities[i+1:]...)
-			break
-		}
+	for _, recipeId := range state.usages {
+		recordRecipeUsage(ctx, pipe, userId, recipeId, state.now())
 	}
+	return saveEvents(ctx, pipe, ns, state.events)
+}
 
-	// If quantities is empty, we remove the ingredient
-	if len(ingredient.Quantities) == 0 {
-		err = rdb.Del(ctx, userId+":ingredient:"+ingredientID).Err()
-		if err != nil {
-			logger.WithError(err).Error("Failed to delete ingredient: " + ingredientID)
-			return err
-		}
-		return nil
-	} else {
+// load reads the recipes and the ingredients in the transaction, the ingredients of the recipes are watched and loaded too
+func (r *RedisStore) load(ctx context.Context, tx *redis.Tx, ns string, recipeIDs []string, ingredientIDs []string) (*listState, error) {
+	state := newListState()
 
-		// Save the updated quantities
-		quantities, err := json.Marshal(ingredient.Quantities)
+	ingredientIDs = append([]string{}, ingredientIDs...)
+	recipeIngredientKeys := make([]string, 0)
+	for _, recipeId := range recipeIDs {
+		recipe, err := getRecipe(ctx, tx, ns, recipeId)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
 		if err != nil {
-			logger.WithField("ingredient", ingredient).WithError(err).Error("Failed to marshal ingredient")
-			return err
+			return nil, err
+		}
+		state.recipes[recipeId] = *recipe
+		for _, id := range recipe.IngredientsID {
+			ingredientIDs = append(ingredientIDs, id)
+			recipeIngredientKeys = append(recipeIngredientKeys, ingredientKey(ns, id))
+		}
+	}
+	if len(recipeIngredientKeys) > 0 {
+		if err := tx.Watch(ctx, recipeIngredientKeys...).Err(); err != nil {
+			return nil, err
 		}
+	}
 
-		err = rdb.Set(ctx, userId+":ingredient:"+ingredientID, quantities, 0).Err()
+	for _, ingredientId := range ingredientIDs {
+		if _, ok := state.ingredients[ingredientId]; ok {
+			continue
+		}
+		ingredient, err := getIngredient(ctx, tx, ns, ingredientId)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
 		if err != nil {
-			logger.WithError(err).Error("Failed to set ingredient: " + ingredientID)
-			return err
+			return nil, err
 		}
+		state.setIngredient(ingredient)
 	}
-	return nil
-
+	return state, nil
 }
 
-// TODO Refactor the function
-func AddIngredient(rdb *redis.Client, userId string, ingredientID string, ingredient Ingredient) (*Ingredient, error) {
-
-	ctx := context.Background()
-	ingredientSaved, _ := GetIngredient(rdb, userId, ingredientID)
-
-	for _, quantity := range ingredient.Quantities {
-
-		if ingredientSaved != nil {
-
-			// If we find the same ingredient, we add the quantity to the existing one if the unit and the recipeID are the same
-			added := false
-			for i, savedQuantity := range ingredientSaved.Quantities {
-				if quantity.Unit == savedQuantity.Unit && quantity.RecipeID == savedQuantity.RecipeID {
-					ingredientSaved.Quantities[i].Amount += quantity.Amount
-					added = true
-					break
-				}
-			}
-
-			// If we do not find the same ingredient, we add the quantity to the existing one
-			if !added {
-				ingredientSaved.Quantities = append(ingredientSaved.Quantities, quantity)
-			}
-
-		} else {
-			ingredientSaved = &Ingredient{
-				Quantities: ingredient.Quantities,
-			}
-
+// save queues the writes of the recipes and the ingredients changed since the before state, and of the new
+// and the removed trips
+func (r *RedisStore) save(ctx context.Context, pipe redis.Pipeliner, ns string, before *listState, state *listState) error {
+	for _, recipeId := range state.changedRecipes(before) {
+		var beforeFields, afterFields map[string]string
+		if recipe, ok := before.recipes[recipeId]; ok {
+			beforeFields = encodeRecipe(recipe)
 		}
-
+		if recipe, ok := state.recipes[recipeId]; ok {
+			afterFields = encodeRecipe(recipe)
+		}
+		saveHash(ctx, pipe, recipeKey(ns, recipeId), beforeFields, afterFields)
 	}
 
-	// Add the ingredient to the database
-
-	quantities, err := json.Marshal(ingredientSaved.Quantities)
-	if err != nil {
-		logger.WithField("ingredient", ingredientSaved).WithError(err).Error("Failed to marshal ingredient")
-		return nil, err
+	for _, ingredientId := range state.changedIngredients(before) {
+		quantities, ok := state.ingredients[ingredientId]
+		if !ok {
+			pipe.Del(ctx, ingredientKey(ns, ingredientId))
+			pipe.SRem(ctx, ingredientIndexKey(ns), ingredientId)
+			continue
+		}
+		saveHash(ctx, pipe, ingredientKey(ns, ingredientId),
+			encodeIngredient(before.ingredients[ingredientId], before.checkOf(ingredientId)),
+			encodeIngredient(quantities, state.checkOf(ingredientId)))
+		pipe.SAdd(ctx, ingredientIndexKey(ns), ingredientId)
 	}
 
-	err = rdb.Set(ctx, userId+":ingredient:"+ingredientID, quantities, 0).Err()
-	if err != nil {
-		logger.WithError(err).Error("Failed to set ingredient: " + ingredientID)
-		return nil, err
+	for _, trip := range state.newTrips(before) {
+		if err := saveTrip(ctx, pipe, ns, trip); err != nil {
+			return err
+		}
 	}
-
-	return ingredientSaved, nil
+	// A trip is removed when its completion is undone
+	for _, trip := range before.newTrips(state) {
+		pipe.Del(ctx, tripKey(ns, trip.ID))
+		pipe.ZRem(ctx, tripIndexKey(ns), trip.ID)
+	}
+	return nil
 }
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"shopping-list/tests"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// getShoppingListWithKeys is the previous implementation of GetShoppingList, using KEYS and one read per ingredient
+func getShoppingListWithKeys(ctx context.Context, rdb *redis.Client, userId string) (*[]Ingredient, error) {
+	res, err := rdb.Keys(ctx, userId+":ingredient:*").Result()
+	if err != nil {
+		return nil, err
+	}
+	ingredients := make([]Ingredient, 0)
+	for _, key := range res {
+		ingredientID := key[len(userId)+12:]
+		ingredient, err := getIngredient(ctx, rdb, userId, ingredientID)
+		if err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, *ingredient)
+	}
+	return &ingredients, nil
+}
+
+func BenchmarkGetShoppingList(b *testing.B) {
+	tests.SkipWithoutDocker(b)
+	ctx := context.Background()
+	rdb, pool, resource := tests.InitTestDocker("6379")
+	defer tests.CloseTestDocker(rdb, pool, resource)
+	store := NewRedisStore(rdb)
+
+	// Fill the keyspace with the lists of many users, the benchmarked user is one of them
+	users, ingredients := 100, 50
+	for u := 0; u < users; u++ {
+		for i := 0; i < ingredients; i++ {
+			_, _, err := store.AddIngredient(ctx, fmt.Sprint(u), fmt.Sprintf("%024d", i), Ingredient{
+				Quantities: []Quantity{{Amount: 1, Unit: "g"}},
+			})
+			if err != nil {
+				b.Fatalf("Failed to add ingredient: %v", err)
+			}
+		}
+	}
+
+	b.Run("Keys", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if _, err := getShoppingListWithKeys(ctx, rdb, "42"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Index", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if _, err := store.GetShoppingList(ctx, "42"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,429 @@
+package db
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// now returns the current time, truncated to the precision saved in Redis
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// listState is the content of a shopping list.
+// The MemoryStore keeps the full state of every list, the RedisStore loads the part
+// touched by an operation inside a transaction and saves back what changed.
+type listState struct {
+	ingredients map[string][]Quantity
+	recipes     map[string]Recipe
+	// Ingredients checked in the shopping list
+	checks map[string]check
+	// Completed trips, the RedisStore only loads the trips created by the operation
+	trips map[string]Trip
+	// Pantry of the user making the change, nil when the operation does not use it
+	pantry map[string][]Quantity
+	// Time of the operation, shared by all its changes, set on first use
+	clock time.Time
+	// Events recorded by the operation, see Event
+	events []Event
+	// Recipes added by the user making the change, counted in the recipe stats with the operation
+	usages []string
+}
+
+// check is the purchase of an ingredient, by who and when
+type check struct {
+	by string
+	at time.Time
+}
+
+// now returns the time of the operation
+func (s *listState) now() time.Time {
+	if s.clock.IsZero() {
+		s.clock = now()
+	}
+	return s.clock
+}
+
+func newListState() *listState {
+	return &listState{
+		ingredients: make(map[string][]Quantity),
+		recipes:     make(map[string]Recipe),
+		checks:      make(map[string]check),
+		trips:       make(map[string]Trip),
+	}
+}
+
+func newIngredient(ingredientId string, quantities []Quantity, c *check) *Ingredient {
+	ingredient := &Ingredient{
+		ID:         ingredientId,
+		Quantities: quantities,
+	}
+	if c != nil {
+		at := c.at
+		ingredient.Checked = true
+		ingredient.CheckedBy = c.by
+		ingredient.CheckedAt = &at
+	}
+	return ingredient
+}
+
+// setIngredient puts the ingredient read from the store in the state
+func (s *listState) setIngredient(ingredient *Ingredient) {
+	s.ingredients[ingredient.ID] = ingredient.Quantities
+	if ingredient.Checked {
+		s.checks[ingredient.ID] = check{by: ingredient.CheckedBy, at: *ingredient.CheckedAt}
+	}
+}
+
+// checkOf returns the check of the ingredient, nil when it is not checked
+func (s *listState) checkOf(ingredientId string) *check {
+	c, ok := s.checks[ingredientId]
+	if !ok {
+		return nil
+	}
+	return &c
+}
+
+func (s *listState) clone() *listState {
+	c := &listState{
+		ingredients: make(map[string][]Quantity, len(s.ingredients)),
+		recipes:     make(map[string]Recipe, len(s.recipes)),
+		checks:      make(map[string]check, len(s.checks)),
+		trips:       make(map[string]Trip, len(s.trips)),
+	}
+	for id, ch := range s.checks {
+		c.checks[id] = ch
+	}
+	// The trips are never modified once completed
+	for id, trip := range s.trips {
+		c.trips[id] = trip
+	}
+	if s.pantry != nil {
+		c.pantry = make(map[string][]Quantity, len(s.pantry))
+		for id, quantities := range s.pantry {
+			c.pantry[id] = slices.Clone(quantities)
+		}
+	}
+	for id, quantities := range s.ingredients {
+		c.ingredients[id] = slices.Clone(quantities)
+	}
+	for id, recipe := range s.recipes {
+		recipe.IngredientsID = slices.Clone(recipe.IngredientsID)
+		c.recipes[id] = recipe
+	}
+	return c
+}
+
+func (s *listState) getIngredient(ingredientId string, recipeIds ...string) (*Ingredient, error) {
+	quantities, ok := s.ingredients[ingredientId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return newIngredient(ingredientId, filterQuantities(slices.Clone(quantities), recipeIds...), s.checkOf(ingredientId)), nil
+}
+
+// addIngredient merges the quantities of the ingredient, adding quantities to a checked ingredient reopens it.
+// The ingredient is added to the recipes of its quantity lines, so that removing the recipe removes the lines.
+// It tells if the ingredient is new in the list, and returns ErrNotFound when a recipe of the lines is not in the list.
+func (s *listState) addIngredient(ingredientID string, ingredient Ingredient) (*Ingredient, bool, error) {
+	for _, quantity := range ingredient.Quantities {
+		if _, ok := s.recipes[quantity.RecipeID]; quantity.RecipeID != "" && !ok {
+			return nil, false, ErrNotFound
+		}
+	}
+	for _, quantity := range ingredient.Quantities {
+		if recipe := s.recipes[quantity.RecipeID]; quantity.RecipeID != "" && !slices.Contains(recipe.IngredientsID, ingredientID) {
+			recipe.IngredientsID = append(slices.Clone(recipe.IngredientsID), ingredientID)
+			recipe.UpdatedAt = s.now()
+			s.recipes[quantity.RecipeID] = recipe
+		}
+	}
+	_, saved := s.ingredients[ingredientID]
+	s.record(Event{Type: IngredientAdded, IngredientID: ingredientID, Quantities: ingredient.Quantities})
+	return s.mergeIngredient(ingredientID, ingredient), !saved, nil
+}
+
+// addIngredients adds the ingredients by their ID, it stops on the first one that cannot be added
+func (s *listState) addIngredients(ingredients []Ingredient) error {
+	for _, ingredient := range ingredients {
+		if _, _, err := s.addIngredient(ingredient.ID, ingredient); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *listState) mergeIngredient(ingredientID string, ingredient Ingredient) *Ingredient {
+	quantities := collapseQuantities(ingredientID, mergeQuantities(s.ingredients[ingredientID], ingredient.Quantities))
+	if len(quantities) > 0 {
+		s.ingredients[ingredientID] = quantities
+	}
+	if len(ingredient.Quantities) > 0 {
+		delete(s.checks, ingredientID)
+	}
+
+	return newIngredient(ingredientID, slices.Clone(quantities), s.checkOf(ingredientID))
+}
+
+// checkIngredient marks the ingredient as purchased by the user, or reopens it
+func (s *listState) checkIngredient(ingredientID string, userId string, checked bool) (*Ingredient, error) {
+	if _, ok := s.ingredients[ingredientID]; !ok {
+		return nil, ErrNotFound
+	}
+	if !checked {
+		delete(s.checks, ingredientID)
+	} else if _, ok := s.checks[ingredientID]; !ok {
+		s.checks[ingredientID] = check{by: userId, at: s.now()}
+	}
+	s.record(Event{Type: ItemChecked, IngredientID: ingredientID, UserID: userId, Checked: checked})
+	return s.getIngredient(ingredientID)
+}
+
+// The removals cascade from the ingredient to the recipe to the list:
+//   - an ingredient without quantity line left is removed from the list
+//   - an ingredient removed from a recipe loses the quantity lines of the recipe
+//   - a recipe without ingredient left is removed
+//
+// dropQuantities removes the quantity lines of the recipe from the ingredient, or all its lines when all is true.
+// It returns false when no line was removed.
+func (s *listState) dropQuantities(ingredientID string, recipeId string, all bool) bool {
+	quantities, ok := s.ingredients[ingredientID]
+	if !ok {
+		return false
+	}
+	var remaining []Quantity
+	if !all {
+		remaining = removeRecipeQuantities(quantities, recipeId)
+	}
+	if len(remaining) == len(quantities) {
+		return false
+	}
+	if len(remaining) == 0 {
+		delete(s.ingredients, ingredientID)
+		delete(s.checks, ingredientID)
+		return true
+	}
+	s.ingredients[ingredientID] = remaining
+	return true
+}
+
+// detachIngredient removes the ingredient from the ingredients of the recipe, and the recipe when it was the last one.
+// It returns false when the recipe does not use the ingredient.
+func (s *listState) detachIngredient(ingredientID string, recipeId string) bool {
+	recipe, ok := s.recipes[recipeId]
+	if !ok || !slices.Contains(recipe.IngredientsID, ingredientID) {
+		return false
+	}
+	recipe.IngredientsID = slices.DeleteFunc(slices.Clone(recipe.IngredientsID), func(id string) bool {
+		return id == ingredientID
+	})
+	if len(recipe.IngredientsID) == 0 {
+		delete(s.recipes, recipeId)
+		return true
+	}
+	recipe.UpdatedAt = s.now()
+	s.recipes[recipeId] = recipe
+	return true
+}
+
+// removeIngredient removes the quantity lines of the recipe, the lines added without recipe when recipeId is empty,
+// or all the quantities of the ingredient when removeAll is true. The ingredient is removed from the recipe of every
+// removed line. It returns ErrNotFound when nothing was removed.
+func (s *listState) removeIngredient(ingredientID string, recipeId string, removeAll bool) error {
+	recipeIds := []string{recipeId}
+	if removeAll {
+		recipeIds = append(recipeIds, recipeIDsOf(s.ingredients[ingredientID])...)
+	}
+	removed := s.dropQuantities(ingredientID, recipeId, removeAll)
+	for _, id := range recipeIds {
+		// The recipe may use the ingredient without line, when it was taken from the pantry or purchased
+		if id != "" && s.detachIngredient(ingredientID, id) {
+			removed = true
+		}
+	}
+	if !removed {
+		return ErrNotFound
+	}
+	s.record(Event{Type: QuantityRemoved, IngredientID: ingredientID, RecipeID: recipeId, All: removeAll})
+	return nil
+}
+
+func (s *listState) getRecipe(recipeId string) (*Recipe, error) {
+	recipe, ok := s.recipes[recipeId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	recipe.IngredientsID = slices.Clone(recipe.IngredientsID)
+	return &recipe, nil
+}
+
+// addRecipe adds the ingredients of the recipe to the list, minus what is taken from the pantry when it is loaded
+func (s *listState) addRecipe(recipeID string, recipe *Recipe, ingredients []Ingredient) []Deduction {
+	// Save the recipe if it does not exist
+	saved, ok := s.recipes[recipeID]
+	if !ok {
+		saved = Recipe{
+			IngredientsID: slices.Clone(recipe.IngredientsID),
+			CreatedAt:     s.now(),
+		}
+	}
+	saved.UpdatedAt = s.now()
+	s.recipes[recipeID] = saved
+
+	deductions := make([]Deduction, 0)
+	added := make([]Ingredient, len(ingredients))
+	for i, ingredient := range ingredients {
+		id := recipe.IngredientsID[i]
+		ingredient.Quantities, deductions = s.takeFromPantry(id, ingredient.Quantities, deductions)
+		s.mergeIngredient(id, ingredient)
+		added[i] = Ingredient{ID: id, Quantities: ingredient.Quantities}
+	}
+	s.record(Event{
+		Type:        RecipeAdded,
+		RecipeID:    recipeID,
+		Recipe:      &Recipe{IngredientsID: slices.Clone(recipe.IngredientsID)},
+		Ingredients: added,
+	})
+	return deductions
+}
+
+// removeRecipe removes the recipe and its quantity lines, the ingredients left without line are removed from the list
+func (s *listState) removeRecipe(recipeId string) error {
+	recipe, ok := s.recipes[recipeId]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, ingredientID := range recipe.IngredientsID {
+		s.dropQuantities(ingredientID, recipeId, false)
+	}
+	delete(s.recipes, recipeId)
+	s.record(Event{Type: RecipeRemoved, RecipeID: recipeId})
+	return nil
+}
+
+// removeIngredientFromRecipe removes the ingredient from the recipe with its quantity lines,
+// the recipe is removed when it has no ingredient left
+func (s *listState) removeIngredientFromRecipe(ingredientID string, recipeId string) error {
+	if !s.detachIngredient(ingredientID, recipeId) {
+		return ErrNotFound
+	}
+	s.dropQuantities(ingredientID, recipeId, false)
+	s.record(Event{Type: IngredientRemovedFromRecipe, IngredientID: ingredientID, RecipeID: recipeId})
+	return nil
+}
+
+// completeTrip moves the checked ingredients to a new trip, and their quantities to the pantry when it is loaded
+func (s *listState) completeTrip(userId string) (*Trip, error) {
+	checked := make([]string, 0, len(s.checks))
+	for _, id := range s.ingredientIDs() {
+		if _, ok := s.checks[id]; ok {
+			checked = append(checked, id)
+		}
+	}
+	return s.closeTrip(newID(), userId, checked)
+}
+
+// closeTrip moves the ingredients to the trip
+func (s *listState) closeTrip(tripId string, userId string, ingredientIDs []string) (*Trip, error) {
+	trip := Trip{
+		ID:          tripId,
+		CompletedBy: userId,
+		CompletedAt: s.now(),
+		Ingredients: make([]Ingredient, 0, len(ingredientIDs)),
+	}
+	for _, id := range ingredientIDs {
+		ingredient, err := s.getIngredient(id)
+		if err != nil {
+			continue
+		}
+		trip.Ingredients = append(trip.Ingredients, *ingredient)
+		delete(s.ingredients, id)
+		delete(s.checks, id)
+	}
+	if len(trip.Ingredients) == 0 {
+		return nil, ErrEmptyTrip
+	}
+	for _, ingredient := range trip.Ingredients {
+		s.addToPantry(ingredient.ID, ingredient.Quantities)
+	}
+	s.trips[trip.ID] = trip
+	s.record(Event{Type: TripCompleted, TripID: trip.ID, UserID: userId, Ingredients: trip.Ingredients})
+	return &trip, nil
+}
+
+// newTrips returns the trips completed since the before state
+func (s *listState) newTrips(before *listState) []Trip {
+	trips := make([]Trip, 0)
+	for id, trip := range s.trips {
+		if _, ok := before.trips[id]; !ok {
+			trips = append(trips, trip)
+		}
+	}
+	return sortTrips(trips)
+}
+
+// sortTrips puts the most recent trips first
+func sortTrips(trips []Trip) []Trip {
+	sort.Slice(trips, func(i, j int) bool {
+		if !trips[i].CompletedAt.Equal(trips[j].CompletedAt) {
+			return trips[i].CompletedAt.After(trips[j].CompletedAt)
+		}
+		return trips[i].ID > trips[j].ID
+	})
+	return trips
+}
+
+// changedIngredients returns the ingredients updated or deleted since the before state
+func (s *listState) changedIngredients(before *listState) []string {
+	ids := make([]string, 0)
+	for id, quantities := range s.ingredients {
+		if saved, ok := before.ingredients[id]; !ok || !slices.Equal(saved, quantities) || before.checks[id] != s.checks[id] {
+			ids = append(ids, id)
+		}
+	}
+	for id := range before.ingredients {
+		if _, ok := s.ingredients[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// changedRecipes returns the recipes updated or deleted since the before state
+func (s *listState) changedRecipes(before *listState) []string {
+	ids := make([]string, 0)
+	for id, recipe := range s.recipes {
+		if saved, ok := before.recipes[id]; !ok || !recipe.equal(saved) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range before.recipes {
+		if _, ok := s.recipes[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (s *listState) ingredientIDs() []string {
+	ids := make([]string, 0, len(s.ingredients))
+	for id := range s.ingredients {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// shoppingList returns the ingredients of the list, sorted by ID
+func (s *listState) shoppingList() []Ingredient {
+	ingredients := make([]Ingredient, 0, len(s.ingredients))
+	for _, ingredientID := range s.ingredientIDs() {
+		ingredient, _ := s.getIngredient(ingredientID)
+		ingredient.Quantities = collapseQuantities(ingredientID, ingredient.Quantities)
+		ingredients = append(ingredients, *ingredient)
+	}
+	return ingredients
+}
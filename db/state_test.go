@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// removalFixture returns a list where
+//   - a has a line without recipe, two lines of r1 and a line of r2
+//   - b has a line of r1, c a line without recipe and is checked
+//   - r3 uses d, which has no line because it was taken from the pantry
+func removalFixture() *listState {
+	s := newListState()
+	s.ingredients["a"] = []Quantity{
+		{Amount: 100, Unit: "g"},
+		{Amount: 200, Unit: "g", RecipeID: "r1"},
+		{Amount: 2, Unit: "i", RecipeID: "r1"},
+		{Amount: 50, Unit: "g", RecipeID: "r2"},
+	}
+	s.ingredients["b"] = []Quantity{{Amount: 1, Unit: "i", RecipeID: "r1"}}
+	s.ingredients["c"] = []Quantity{{Amount: 3, Unit: "i"}}
+	s.checks["c"] = check{by: "1", at: now()}
+	s.recipes["r1"] = Recipe{IngredientsID: []string{"a", "b"}}
+	s.recipes["r2"] = Recipe{IngredientsID: []string{"a"}}
+	s.recipes["r3"] = Recipe{IngredientsID: []string{"d"}}
+	return s
+}
+
+func TestRemovalCascade(t *testing.T) {
+	fixture := removalFixture()
+
+	tests := []struct {
+		name   string
+		remove func(s *listState) error
+		err    error
+		// Number of quantity lines of the ingredients left in the list
+		lines map[string]int
+		// Ingredients of the recipes left in the list
+		recipes map[string][]string
+	}{
+		{
+			name:    "Remove the lines without recipe",
+			remove:  func(s *listState) error { return s.removeIngredient("a", "", false) },
+			lines:   map[string]int{"a": 3, "b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"a", "b"}, "r2": {"a"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove all the lines of the recipe",
+			remove:  func(s *listState) error { return s.removeIngredient("a", "r1", false) },
+			lines:   map[string]int{"a": 2, "b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"b"}, "r2": {"a"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove the last ingredient of a recipe",
+			remove:  func(s *listState) error { return s.removeIngredient("a", "r2", false) },
+			lines:   map[string]int{"a": 3, "b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"a", "b"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove the last line of an ingredient",
+			remove:  func(s *listState) error { return s.removeIngredient("c", "", false) },
+			lines:   map[string]int{"a": 4, "b": 1},
+			recipes: map[string][]string{"r1": {"a", "b"}, "r2": {"a"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove all the quantities of an ingredient",
+			remove:  func(s *listState) error { return s.removeIngredient("a", "", true) },
+			lines:   map[string]int{"b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"b"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove an ingredient of a recipe without line",
+			remove:  func(s *listState) error { return s.removeIngredient("d", "r3", false) },
+			lines:   map[string]int{"a": 4, "b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"a", "b"}, "r2": {"a"}},
+		},
+		{
+			name:   "Remove an unknown ingredient",
+			remove: func(s *listState) error { return s.removeIngredient("e", "", true) },
+			err:    ErrNotFound,
+		},
+		{
+			name:   "Remove the missing lines without recipe",
+			remove: func(s *listState) error { return s.removeIngredient("b", "", false) },
+			err:    ErrNotFound,
+		},
+		{
+			name:   "Remove the lines of a recipe not using the ingredient",
+			remove: func(s *listState) error { return s.removeIngredient("b", "r2", false) },
+			err:    ErrNotFound,
+		},
+		{
+			name:    "Remove an ingredient from the recipe",
+			remove:  func(s *listState) error { return s.removeIngredientFromRecipe("b", "r1") },
+			lines:   map[string]int{"a": 4, "c": 1},
+			recipes: map[string][]string{"r1": {"a"}, "r2": {"a"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove the last ingredient from the recipe",
+			remove:  func(s *listState) error { return s.removeIngredientFromRecipe("a", "r2") },
+			lines:   map[string]int{"a": 3, "b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"a", "b"}, "r3": {"d"}},
+		},
+		{
+			name:   "Remove an ingredient from a recipe not using it",
+			remove: func(s *listState) error { return s.removeIngredientFromRecipe("c", "r1") },
+			err:    ErrNotFound,
+		},
+		{
+			name:   "Remove an ingredient from an unknown recipe",
+			remove: func(s *listState) error { return s.removeIngredientFromRecipe("a", "r4") },
+			err:    ErrNotFound,
+		},
+		{
+			name:    "Remove a recipe",
+			remove:  func(s *listState) error { return s.removeRecipe("r1") },
+			lines:   map[string]int{"a": 2, "c": 1},
+			recipes: map[string][]string{"r2": {"a"}, "r3": {"d"}},
+		},
+		{
+			name:    "Remove a recipe without line",
+			remove:  func(s *listState) error { return s.removeRecipe("r3") },
+			lines:   map[string]int{"a": 4, "b": 1, "c": 1},
+			recipes: map[string][]string{"r1": {"a", "b"}, "r2": {"a"}},
+		},
+		{
+			name:   "Remove an unknown recipe",
+			remove: func(s *listState) error { return s.removeRecipe("r4") },
+			err:    ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := fixture.clone()
+			err := tt.remove(state)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			lines := make(map[string]int, len(state.ingredients))
+			for id, quantities := range state.ingredients {
+				lines[id] = len(quantities)
+			}
+			if !maps.Equal(lines, tt.lines) {
+				t.Errorf("Expected the lines %v, got %v", tt.lines, lines)
+			}
+			recipes := make(map[string][]string, len(state.recipes))
+			for id, recipe := range state.recipes {
+				recipes[id] = recipe.IngredientsID
+			}
+			if !maps.EqualFunc(recipes, tt.recipes, slices.Equal[[]string]) {
+				t.Errorf("Expected the recipes %v, got %v", tt.recipes, recipes)
+			}
+			for id := range state.checks {
+				if _, ok := state.ingredients[id]; !ok {
+					t.Errorf("The check of the removed ingredient %s should be removed", id)
+				}
+			}
+		})
+	}
+
+	if !maps.EqualFunc(fixture.ingredients, removalFixture().ingredients, slices.Equal[[]Quantity]) {
+		t.Errorf("The removals should not change the original state: %v", fixture.ingredients)
+	}
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// recipeCountKey is the sorted set of the recipes of the user, scored by the number of times they were added
+func recipeCountKey(userId string) string {
+	return userKey(userId) + ":recipe-stats:count"
+}
+
+// recipeLastUsedKey is the hash of the last time each recipe of the user was added
+func recipeLastUsedKey(userId string) string {
+	return userKey(userId) + ":recipe-stats:last-used"
+}
+
+// recordRecipeUsage counts the recipe added by the user in the transaction of the list
+func recordRecipeUsage(ctx context.Context, pipe redis.Pipeliner, userId string, recipeId string, at time.Time) {
+	pipe.ZIncrBy(ctx, recipeCountKey(userId), 1, recipeId)
+	pipe.HSet(ctx, recipeLastUsedKey(userId), recipeId, at.Format(time.RFC3339Nano))
+}
+
+func (r *RedisStore) GetRecipeStats(ctx context.Context, userId string, limit int) ([]RecipeStats, error) {
+	counts, err := r.rdb.ZRevRangeWithScores(ctx, recipeCountKey(userId), 0, int64(limit)-1).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the recipe stats")
+		return nil, err
+	}
+	stats := make([]RecipeStats, len(counts))
+	if len(counts) == 0 {
+		return stats, nil
+	}
+
+	recipeIds := make([]string, len(counts))
+	for i, count := range counts {
+		recipeIds[i] = count.Member.(string)
+	}
+	lastUsed, err := r.rdb.HMGet(ctx, recipeLastUsedKey(userId), recipeIds...).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the recipe stats")
+		return nil, err
+	}
+
+	for i, count := range counts {
+		stats[i] = RecipeStats{
+			RecipeID:   recipeIds[i],
+			TimesAdded: int64(count.Score),
+		}
+		if value, ok := lastUsed[i].(string); ok {
+			stats[i].LastUsedAt, _ = time.Parse(time.RFC3339Nano, value)
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,149 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by the stores when the requested recipe or ingredient does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrPrimaryList is returned when deleting or sharing the primary list of a user
+var ErrPrimaryList = errors.New("the primary list cannot be deleted or shared")
+
+// ErrForbidden is returned when the role of the user on the list does not allow the operation
+var ErrForbidden = errors.New("not allowed by the role of the user on the list")
+
+// ErrOwnerRole is returned when changing the role of the owner of a list or giving the owner role to a member
+var ErrOwnerRole = errors.New("the owner of the list cannot be changed")
+
+// ErrEmptyTrip is returned when completing a trip without any checked ingredient
+var ErrEmptyTrip = errors.New("no checked ingredient to complete the trip")
+
+// ErrInvalidUserID is returned for a user ID that cannot be used in the keys of the store, see ValidUserID
+var ErrInvalidUserID = errors.New("the user ID is empty or has one of the characters : * ? [")
+
+// Name given to the primary list when it is created
+const PrimaryListName = "Shopping list"
+
+// ShoppingListStore holds the recipes and the ingredients of the shopping lists.
+// They are saved in the namespace of their list, see List.Namespace.
+type ShoppingListStore interface {
+	GetIngredient(ctx context.Context, ns string, ingredientId string, recipeIds ...string) (*Ingredient, error)
+	GetIngredientRecipe(ctx context.Context, ns string, ingredientId string, recipeId string) (*Ingredient, error)
+	// AddIngredient merges the quantities with the saved ones and adds the ingredient to the recipes of the quantity lines,
+	// ErrNotFound when a recipe is not in the list. It tells if the ingredient was not in the list yet.
+	AddIngredient(ctx context.Context, ns string, ingredientID string, ingredient Ingredient) (*Ingredient, bool, error)
+	// AddIngredients adds the ingredients by their ID like AddIngredient, all of them in one operation or none
+	AddIngredients(ctx context.Context, ns string, ingredients []Ingredient) error
+	// RemoveIngredient removes the quantities of the recipe, the ones added without recipe when recipeId is empty,
+	// or all of them when removeAll is true. The ingredient is removed from the recipes of the removed quantities,
+	// the recipes and the ingredients left empty are removed too.
+	RemoveIngredient(ctx context.Context, ns string, ingredientID string, recipeId string, removeAll bool) error
+	// CheckIngredient marks the ingredient as purchased by the user, or reopens it when checked is false
+	CheckIngredient(ctx context.Context, ns string, ingredientID string, userId string, checked bool) (*Ingredient, error)
+
+	GetRecipe(ctx context.Context, ns string, recipeId string) (*Recipe, error)
+	// AddRecipe adds the ingredients of the recipe to the list, minus the amounts available in the pantry of the user,
+	// and counts the recipe in the stats of the user in the same transaction
+	AddRecipe(ctx context.Context, ns string, userId string, recipeID string, recipe *Recipe, ingredients *[]Ingredient) ([]Deduction, error)
+	// RemoveRecipe removes the recipe with its quantities, the ingredients left without quantity are removed
+	RemoveRecipe(ctx context.Context, ns string, recipeId string) error
+	// RemoveIngredientFromRecipe removes the ingredient and its quantities from the recipe, it returns ErrNotFound
+	// when the recipe does not use the ingredient
+	RemoveIngredientFromRecipe(ctx context.Context, ns string, ingredientID string, recipeId string) error
+
+	GetShoppingList(ctx context.Context, ns string) (*[]Ingredient, error)
+
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// TripStore archives the ingredients purchased in the lists
+type TripStore interface {
+	// CompleteTrip moves the checked ingredients of the list to a new trip and their quantities to the pantry of the user,
+	// the other ingredients stay in the list
+	CompleteTrip(ctx context.Context, ns string, userId string) (*Trip, error)
+	// GetTrips returns the most recent trips first
+	GetTrips(ctx context.Context, ns string, limit int) ([]Trip, error)
+	GetTrip(ctx context.Context, ns string, tripId string) (*Trip, error)
+}
+
+// PantryStore holds the ingredients available at home of each user
+type PantryStore interface {
+	GetPantry(ctx context.Context, userId string) ([]PantryItem, error)
+	GetPantryItem(ctx context.Context, userId string, ingredientId string) ([]PantryItem, error)
+	// SetPantryItem replaces the amount of the ingredient in the unit of the item
+	SetPantryItem(ctx context.Context, userId string, item PantryItem) error
+	// RemovePantryItem removes the ingredient in the given unit, or in all the units when unit is empty
+	RemovePantryItem(ctx context.Context, userId string, ingredientId string, unit string) error
+}
+
+// AisleStore holds the custom order of the aisles of each user, as a list of ingredient types
+type AisleStore interface {
+	// GetAisleOrder returns ErrNotFound when the user has no custom order
+	GetAisleOrder(ctx context.Context, userId string) ([]string, error)
+	SetAisleOrder(ctx context.Context, userId string, aisles []string) error
+	RemoveAisleOrder(ctx context.Context, userId string) error
+}
+
+// EventStore holds the events of the mutations of the lists, the content of a list is their projection
+type EventStore interface {
+	// GetEvents returns the events of the list recorded until the given time, all of them when until is zero.
+	// The events are read in order up to the first one whose time is after until.
+	GetEvents(ctx context.Context, ns string, until time.Time) ([]Event, error)
+	// GetShoppingListAt rebuilds the shopping list as it was at the given time from its events
+	GetShoppingListAt(ctx context.Context, ns string, at time.Time) (*[]Ingredient, error)
+}
+
+// JournalStore reverts the recent operations of the users on the lists, see Operation
+type JournalStore interface {
+	// Undo sets back the entities changed by the last operation of the user on the list. It returns ErrNotFound
+	// when there is no operation to undo, and ErrJournalConflict when the entities were changed again since.
+	Undo(ctx context.Context, ns string, userId string) (*Operation, error)
+	// Redo makes again the last undone operation, with the same errors as Undo
+	Redo(ctx context.Context, ns string, userId string) (*Operation, error)
+}
+
+// RecipeStatsStore counts how many times each user added each recipe to the shopping list, see AddRecipe
+type RecipeStatsStore interface {
+	// GetRecipeStats returns the most used recipes first
+	GetRecipeStats(ctx context.Context, userId string, limit int) ([]RecipeStats, error)
+}
+
+// ListStore holds the named shopping lists of each user and their members.
+// The methods taking the userId of the caller check its role on the list:
+// they return ErrNotFound when the user is not a member and ErrForbidden when its role is not enough.
+type ListStore interface {
+	CreateList(ctx context.Context, userId string, name string) (*List, error)
+	GetList(ctx context.Context, listId string) (*List, error)
+	// GetPrimaryList returns the primary list of the user, creating it the first time
+	GetPrimaryList(ctx context.Context, userId string) (*List, error)
+	// GetLists returns the lists owned by or shared with the user, the primary list first then the oldest first
+	GetLists(ctx context.Context, userId string) ([]List, error)
+	// AuthorizeList returns the list when the role of the user allows the needed role
+	AuthorizeList(ctx context.Context, userId string, listId string, need Role) (*List, error)
+	RenameList(ctx context.Context, userId string, listId string, name string) (*List, error)
+	// DeleteList removes the list with its recipes, ingredients and members, the primary list cannot be deleted
+	DeleteList(ctx context.Context, userId string, listId string) error
+
+	// GetMembers returns the owner of the list first then the members
+	GetMembers(ctx context.Context, userId string, listId string) ([]Member, error)
+	// SetMember invites the member to the list or changes its role, the primary list cannot be shared
+	SetMember(ctx context.Context, userId string, listId string, memberId string, role Role) error
+	// RemoveMember removes the member from the list, the members can also leave the list themselves
+	RemoveMember(ctx context.Context, userId string, listId string, memberId string) error
+}
+
+// Store gathers everything saved by the shopping list service
+type Store interface {
+	ShoppingListStore
+	TripStore
+	PantryStore
+	AisleStore
+	EventStore
+	JournalStore
+	RecipeStatsStore
+	ListStore
+}
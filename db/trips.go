@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The trips are never modified once completed, they are saved as JSON under <namespace>:trip:<tripId>.
+// <namespace>:trips is the sorted set of the trip IDs scored by completion time.
+func tripKey(ns string, tripId string) string {
+	return ns + ":trip:" + tripId
+}
+
+func tripIndexKey(ns string) string {
+	return ns + ":trips"
+}
+
+func saveTrip(ctx context.Context, pipe redis.Pipeliner, ns string, trip Trip) error {
+	value, err := json.Marshal(trip)
+	if err != nil {
+		return err
+	}
+	pipe.Set(ctx, tripKey(ns, trip.ID), value, 0)
+	pipe.ZAdd(ctx, tripIndexKey(ns), redis.Z{Score: float64(trip.CompletedAt.UnixMicro()), Member: trip.ID})
+	return nil
+}
+
+func (r *RedisStore) CompleteTrip(ctx context.Context, ns string, userId string) (*Trip, error) {
+	ingredientIDs, err := r.rdb.SMembers(ctx, ingredientIndexKey(ns)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get ingredients")
+		return nil, err
+	}
+
+	// The ingredients added after the index was read are not checked yet, they stay in the list
+	var trip *Trip
+	err = r.updateWithPantry(ctx, ns, userId, nil, ingredientIDs, func(state *listState) error {
+		var err error
+		trip, err = state.completeTrip(userId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return trip, nil
+}
+
+func (r *RedisStore) GetTrips(ctx context.Context, ns string, limit int) ([]Trip, error) {
+	tripIds, err := r.rdb.ZRevRange(ctx, tripIndexKey(ns), 0, int64(limit-1)).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the trips")
+		return nil, err
+	}
+	trips := make([]Trip, 0, len(tripIds))
+	if len(tripIds) == 0 {
+		return trips, nil
+	}
+
+	keys := make([]string, len(tripIds))
+	for i, id := range tripIds {
+		keys[i] = tripKey(ns, id)
+	}
+	values, err := r.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		logger.WithError(err).Error("Failed to get the trips")
+		return nil, err
+	}
+	for i, value := range values {
+		// The list was deleted since the index was read
+		if value == nil {
+			continue
+		}
+		var trip Trip
+		if err := json.Unmarshal([]byte(value.(string)), &trip); err != nil {
+			logger.WithError(err).Error("Failed to decode trip: " + tripIds[i])
+			return nil, err
+		}
+		trips = append(trips, trip)
+	}
+	return trips, nil
+}
+
+func (r *RedisStore) GetTrip(ctx context.Context, ns string, tripId string) (*Trip, error) {
+	return getTrip(ctx, r.rdb, ns, tripId)
+}
+
+func getTrip(ctx context.Context, c redis.Cmdable, ns string, tripId string) (*Trip, error) {
+	value, err := c.Get(ctx, tripKey(ns, tripId)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to get trip: " + tripId)
+		return nil, err
+	}
+	var trip Trip
+	if err := json.Unmarshal(value, &trip); err != nil {
+		logger.WithError(err).Error("Failed to decode trip: " + tripId)
+		return nil, err
+	}
+	return &trip, nil
+}
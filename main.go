@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"shopping-list/api"
 	"shopping-list/configuration"
 	"shopping-list/db"
 	"shopping-list/messages"
+	"shopping-list/units"
 	"shopping-list/validation"
 	"syscall"
 
@@ -21,18 +26,39 @@ var logger = logrus.WithFields(logrus.Fields{
 
 func main() {
 	configuration.SetupLogging()
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
 	logger.Info("Shopping List API Starting...")
 
 	conf := configuration.New()
 	logger.Logger.SetLevel(conf.LogLevel)
 
-	rdb := db.New(conf)
+	var store db.Store
+	if conf.DBBackend == "memory" {
+		logger.Warn("Using the in-memory store, the data will be lost at shutdown")
+		store = db.NewMemoryStore()
+	} else {
+		redisStore := db.NewRedisStore(db.New(conf))
+		if err := redisStore.Migrate(context.Background()); err != nil {
+			logger.WithError(err).Fatal("Failed to migrate the data")
+		}
+		store = redisStore
+	}
+	if conf.DensitiesFile != "" {
+		densities, err := units.LoadDensities(conf.DensitiesFile)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to load the densities of the ingredients")
+		}
+		units.SetDensities(densities)
+	}
 
 	val := validation.New(conf)
 	r := api.New(val)
 	v1 := r.Group(conf.ListenRoute)
 	amqp := messages.New(conf)
-	h := api.NewApiHandler(conf, rdb, amqp)
+	h := api.NewApiHandler(conf, store, amqp)
 
 	h.Register(v1, conf)
 	tp, _ := api.InitOtel()
@@ -42,8 +68,8 @@ func main() {
 		if err := tp.Shutdown(context.Background()); err != nil {
 			logger.WithError(err).Error("Error shutting down tracer provider")
 		}
-		if err := rdb.Close(); err != nil {
-			logger.WithError(err).Error("Error closing redis connection")
+		if err := store.Close(); err != nil {
+			logger.WithError(err).Error("Error closing the store connection")
 		}
 	}()
 
@@ -67,3 +93,104 @@ func main() {
 	r.Logger.Fatal(r.Start(fmt.Sprintf("%v:%v", conf.ListenAddress, conf.ListenPort)))
 
 }
+
+const usage = `Usage: shopping-list [command]
+
+Without command, the API is started.
+
+Commands:
+  backup  [--user <id>] [--out <file>]            copy the data of the user, or of the whole dataset
+  restore [--in <file>] [--replace] [--dry-run]   restore a backup, merged with the saved data by default
+`
+
+// runCommand runs the command of the command line then exits, 2 when the command is unknown
+func runCommand(name string, args []string) {
+	var err error
+	switch name {
+	case "backup":
+		err = backupCommand(args)
+	case "restore":
+		err = restoreCommand(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		logger.WithField("command", name).WithError(err).Fatal("The command failed")
+	}
+}
+
+// redisStore connects to the Redis store of the configuration, the backups only support Redis
+func redisStore() (*db.RedisStore, error) {
+	conf := configuration.New()
+	logger.Logger.SetLevel(conf.LogLevel)
+	if conf.DBBackend != "redis" {
+		return nil, errors.New("the backups need the redis backend")
+	}
+	return db.NewRedisStore(db.New(conf)), nil
+}
+
+func backupCommand(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	userId := flags.String("user", "", "ID of the user to back up, the whole dataset when empty")
+	out := flags.String("out", "", "File written with the backup, the standard output when empty")
+	flags.Parse(args)
+
+	store, err := redisStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	backup, err := store.Backup(context.Background(), *userId)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	// The backup has the data of the users, only its owner reads it
+	return os.WriteFile(*out, content, 0600)
+}
+
+func restoreCommand(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "", "File of the backup, the standard input when empty")
+	replace := flags.Bool("replace", false, "Delete the saved keys of the scope of the backup missing from it, instead of merging")
+	dryRun := flags.Bool("dry-run", false, "Report the changes without writing them")
+	flags.Parse(args)
+
+	var content []byte
+	var err error
+	if *in == "" {
+		content, err = io.ReadAll(os.Stdin)
+	} else {
+		content, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		return err
+	}
+	backup := new(db.Backup)
+	if err := json.Unmarshal(content, backup); err != nil {
+		return fmt.Errorf("%w: %v", db.ErrInvalidBackup, err)
+	}
+
+	store, err := redisStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	report, err := store.Restore(context.Background(), backup, db.RestoreOptions{Replace: *replace, DryRun: *dryRun})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(os.Stdout).Encode(report)
+}
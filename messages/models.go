@@ -3,7 +3,7 @@ package messages
 type AddIngredient struct {
 	ID     string  `param:"id" json:"id" validate:"required"`
 	Amount float64 `json:"amount" validate:"required,min=0.1"`
-	Unit   string  `json:"unit" validate:"oneof=i is cup tbsp tsp g kg"`
+	Unit   string  `json:"unit" validate:"unit"`
 }
 
 type AddRecipe struct {
@@ -12,8 +12,10 @@ type AddRecipe struct {
 }
 
 type AddIngredientMessage struct {
-	ID     string  `json:"id" validate:"required"`
-	UserID string  `json:"userId" validate:"required"`
+	ID     string `json:"id" validate:"required"`
+	UserID string `json:"userId" validate:"required,userid"`
+	// The ingredient is added to the primary list of the user when empty
+	ListID string  `json:"listId" validate:"omitempty"`
 	Amount float64 `json:"amount" validate:"required,min=0.1"`
-	Unit   string  `json:"unit" validate:"oneof=i is cup tbsp tsp g kg"`
+	Unit   string  `json:"unit" validate:"unit"`
 }
@@ -0,0 +1,292 @@
+// Package parser reads the ingredient lines written by people, like "1 1/2 cups flour", "2-3 onions",
+// "a pinch of salt" or "500g de farine", into an amount in a unit of the registry and the name of the ingredient.
+package parser
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"shopping-list/units"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrEmpty         = errors.New("the line is empty")
+	ErrNoAmount      = errors.New("the line does not start with an amount")
+	ErrInvalidAmount = errors.New("the amount is not a positive number")
+	ErrNoName        = errors.New("the line does not name an ingredient")
+	ErrNotQuantity   = errors.New("the text is not only a quantity")
+)
+
+// Quantity is an amount in a unit of the registry, the pieces are counted in i when the line has no unit
+type Quantity struct {
+	Amount float64
+	// Upper bound of a range of amounts, 3 for 2-3 onions, zero when the amount is exact
+	MaxAmount float64
+	Unit      string
+	// The amount is a vague measure, a pinch or a dash, converted to its usual volume
+	Approximate bool
+}
+
+// Line is the quantity of the ingredient named by a line
+type Line struct {
+	Quantity
+	Name string
+}
+
+// measure is a unit missing from the registry, converted to a unit of the registry
+type measure struct {
+	unit        string
+	factor      float64
+	approximate bool
+}
+
+var (
+	// The measures are matched before the registry, so that the longest names win: fl oz before oz
+	measures = map[string]measure{
+		"oz":                {"g", 28.35, false},
+		"ounce":             {"g", 28.35, false},
+		"ounces":            {"g", 28.35, false},
+		"lb":                {"g", 453.59, false},
+		"lbs":               {"g", 453.59, false},
+		"pound":             {"g", 453.59, false},
+		"pounds":            {"g", 453.59, false},
+		"mg":                {"g", 0.001, false},
+		"fl oz":             {"ml", 29.57, false},
+		"cl":                {"ml", 10, false},
+		"dl":                {"ml", 100, false},
+		"tasse":             {"cup", 1, false},
+		"tasses":            {"cup", 1, false},
+		"cuillère à soupe":  {"tbsp", 1, false},
+		"cuillères à soupe": {"tbsp", 1, false},
+		"cuillere a soupe":  {"tbsp", 1, false},
+		"cuilleres a soupe": {"tbsp", 1, false},
+		"c. à s.":           {"tbsp", 1, false},
+		"c. a s.":           {"tbsp", 1, false},
+		"càs":               {"tbsp", 1, false},
+		"cuillère à café":   {"tsp", 1, false},
+		"cuillères à café":  {"tsp", 1, false},
+		"cuillere a cafe":   {"tsp", 1, false},
+		"cuilleres a cafe":  {"tsp", 1, false},
+		"c. à c.":           {"tsp", 1, false},
+		"c. a c.":           {"tsp", 1, false},
+		"càc":               {"tsp", 1, false},
+		"pinch":             {"tsp", 1.0 / 16, true},
+		"pinches":           {"tsp", 1.0 / 16, true},
+		"pincée":            {"tsp", 1.0 / 16, true},
+		"pincées":           {"tsp", 1.0 / 16, true},
+		"pincee":            {"tsp", 1.0 / 16, true},
+		"dash":              {"tsp", 1.0 / 8, true},
+		"dashes":            {"tsp", 1.0 / 8, true},
+		"trait":             {"tsp", 1.0 / 8, true},
+		"traits":            {"tsp", 1.0 / 8, true},
+	}
+	// Names of the measures, the longest first
+	measureNames = sortedByLength(measures)
+	// Amounts written in words
+	numbers = map[string]float64{
+		"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+		"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12, "half": 0.5, "dozen": 12,
+		"un": 1, "une": 1, "deux": 2, "trois": 3, "quatre": 4, "cinq": 5, "sept": 7, "huit": 8,
+		"neuf": 9, "dix": 10, "douze": 12, "demi": 0.5, "demie": 0.5, "douzaine": 12,
+	}
+	fractions = map[rune]string{
+		'½': "1/2", '⅓': "1/3", '⅔': "2/3", '¼': "1/4", '¾': "3/4", '⅕': "1/5",
+		'⅖': "2/5", '⅗': "3/5", '⅘': "4/5", '⅙': "1/6", '⅚': "5/6", '⅛': "1/8",
+		'⅜': "3/8", '⅝': "5/8", '⅞': "7/8",
+	}
+	// A number, a fraction or a number followed by a fraction: 2, 1.5, 1,5, 1/2, 1 1/2
+	number = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)(?:\s+(\d+)/(\d+)|/(\d+))?`)
+	// The separators of the ranges of amounts: 2-3, 2 to 3, 2 à 3, 2 ou 3, 2 or 3
+	rangeSeparator = regexp.MustCompile(`^\s*(?:-|to\s|à\s|a\s|ou\s|or\s)\s*`)
+	// The words between the unit and the name: 2 cups of milk, 500g de farine, 1 kg d'oignons
+	connector = regexp.MustCompile(`^(?i:of|de|du|des)\s+|^(?i:d)['’]`)
+)
+
+func sortedByLength(m map[string]measure) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Parse reads the quantity and the name of the ingredient of the line
+func Parse(line string) (Line, error) {
+	text := normalize(line)
+	if text == "" {
+		return Line{}, ErrEmpty
+	}
+	quantity, rest, err := parseQuantity(text)
+	if err != nil {
+		return Line{}, err
+	}
+	name := connector.ReplaceAllString(rest, "")
+	name = strings.TrimRightFunc(strings.TrimSpace(name), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == '.' || r == ';'
+	})
+	if name == "" {
+		return Line{}, ErrNoName
+	}
+	return Line{Quantity: quantity, Name: name}, nil
+}
+
+// ParseQuantity reads a text made only of a quantity, like "1.5 kg", "2" or "a pinch"
+func ParseQuantity(text string) (Quantity, error) {
+	text = normalize(text)
+	if text == "" {
+		return Quantity{}, ErrEmpty
+	}
+	quantity, rest, err := parseQuantity(text)
+	if err != nil {
+		return Quantity{}, err
+	}
+	if strings.TrimSpace(rest) != "" {
+		return Quantity{}, ErrNotQuantity
+	}
+	return quantity, nil
+}
+
+// normalize replaces the fraction characters and the dashes, and collapses the spaces
+func normalize(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case fractions[r] != "":
+			b.WriteString(" " + fractions[r])
+		case r == '–' || r == '—':
+			b.WriteRune('-')
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		case r == utf8.RuneError:
+			// The invalid bytes are dropped
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// parseQuantity reads the amount, the range and the unit at the start of the text, and returns what follows
+func parseQuantity(text string) (Quantity, string, error) {
+	amount, rest, err := parseAmount(text)
+	if err != nil {
+		return Quantity{}, "", err
+	}
+	quantity := Quantity{Amount: amount, Unit: "i"}
+	if separator := rangeSeparator.FindString(rest); separator != "" {
+		if max, after, err := parseNumber(rest[len(separator):]); err == nil {
+			if max < amount {
+				return Quantity{}, "", ErrInvalidAmount
+			}
+			quantity.MaxAmount, rest = max, after
+		}
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	if m, name, ok := parseUnit(rest); ok {
+		quantity.Unit = m.unit
+		quantity.Approximate = m.approximate
+		quantity.Amount = round(quantity.Amount * m.factor)
+		quantity.MaxAmount = round(quantity.MaxAmount * m.factor)
+		rest = rest[len(name):]
+	}
+	if quantity.Amount <= 0 || math.IsInf(quantity.Amount, 0) || math.IsInf(quantity.MaxAmount, 0) {
+		return Quantity{}, "", ErrInvalidAmount
+	}
+	return quantity, strings.TrimSpace(rest), nil
+}
+
+// parseAmount reads a number, or an amount written in words
+func parseAmount(text string) (float64, string, error) {
+	if amount, rest, err := parseNumber(text); err == nil || errors.Is(err, ErrInvalidAmount) {
+		return amount, rest, err
+	}
+	word, rest, _ := strings.Cut(text, " ")
+	if amount, ok := numbers[strings.ToLower(word)]; ok {
+		// half a cup, a dozen eggs
+		if next, after, _ := strings.Cut(rest, " "); amount == 0.5 && numbers[strings.ToLower(next)] == 1 {
+			rest = after
+		} else if amount == 1 && numbers[strings.ToLower(next)] == 12 {
+			amount, rest = 12, after
+		}
+		return amount, rest, nil
+	}
+	return 0, "", ErrNoAmount
+}
+
+// parseNumber reads a decimal number, a fraction or a mixed number
+func parseNumber(text string) (float64, string, error) {
+	match := number.FindStringSubmatch(text)
+	if match == nil {
+		return 0, "", ErrNoAmount
+	}
+	rest := text[len(match[0]):]
+	amount, err := strconv.ParseFloat(strings.Replace(match[1], ",", ".", 1), 64)
+	if err != nil {
+		return 0, "", ErrInvalidAmount
+	}
+	switch {
+	case match[2] != "":
+		numerator, _ := strconv.ParseFloat(match[2], 64)
+		denominator, _ := strconv.ParseFloat(match[3], 64)
+		if denominator == 0 {
+			return 0, "", ErrInvalidAmount
+		}
+		amount += numerator / denominator
+	case match[4] != "":
+		denominator, _ := strconv.ParseFloat(match[4], 64)
+		if denominator == 0 {
+			return 0, "", ErrInvalidAmount
+		}
+		amount /= denominator
+	}
+	if math.IsInf(amount, 0) || math.IsNaN(amount) {
+		return 0, "", ErrInvalidAmount
+	}
+	return round(amount), rest, nil
+}
+
+// parseUnit reads the unit at the start of the text, a measure or a unit of the registry, and returns it
+// with the text it was read from. A unit is a whole word, the l of 1 lemon is not a litre.
+func parseUnit(text string) (measure, string, bool) {
+	for _, name := range measureNames {
+		if len(text) >= len(name) && strings.EqualFold(text[:len(name)], name) && boundary(text[len(name):]) {
+			return measures[name], text[:len(name)], true
+		}
+	}
+	word := text
+	if i := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && r != '.' }); i >= 0 {
+		word = text[:i]
+	}
+	if !boundary(text[len(word):]) {
+		return measure{}, "", false
+	}
+	// The abbreviations may end with a dot: 2 tbsp. sugar
+	symbol := strings.TrimSuffix(word, ".")
+	if unit, err := units.Lookup(symbol); err == nil && symbol != "" {
+		return measure{unit: unit.Symbol, factor: 1}, word, true
+	}
+	return measure{}, "", false
+}
+
+// boundary tells if a word ends before the text
+func boundary(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return text == "" || !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '’')
+}
+
+// round removes the floating point noise of the fractions and the conversions
+func round(amount float64) float64 {
+	return math.Round(amount*1e6) / 1e6
+}
@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"errors"
+	"math"
+	"shopping-list/units"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected Line
+		err      error
+	}{
+		// Numbers
+		{"2 kg potatoes", Line{Quantity{Amount: 2, Unit: "kg"}, "potatoes"}, nil},
+		{"1 cup milk", Line{Quantity{Amount: 1, Unit: "cup"}, "milk"}, nil},
+		{"3 eggs", Line{Quantity{Amount: 3, Unit: "i"}, "eggs"}, nil},
+		{"1.5 l water", Line{Quantity{Amount: 1.5, Unit: "l"}, "water"}, nil},
+		{"1,5 l d'eau", Line{Quantity{Amount: 1.5, Unit: "l"}, "eau"}, nil},
+		{"  12   large   eggs  ", Line{Quantity{Amount: 12, Unit: "i"}, "large eggs"}, nil},
+		{"007 agents", Line{Quantity{Amount: 7, Unit: "i"}, "agents"}, nil},
+		// Fractions
+		{"1/2 cup sugar", Line{Quantity{Amount: 0.5, Unit: "cup"}, "sugar"}, nil},
+		{"1 1/2 cups flour", Line{Quantity{Amount: 1.5, Unit: "cup"}, "flour"}, nil},
+		{"2 3/4 cups flour", Line{Quantity{Amount: 2.75, Unit: "cup"}, "flour"}, nil},
+		{"1/3 cup oil", Line{Quantity{Amount: 0.333333, Unit: "cup"}, "oil"}, nil},
+		{"½ lemon", Line{Quantity{Amount: 0.5, Unit: "i"}, "lemon"}, nil},
+		{"1½ tsp salt", Line{Quantity{Amount: 1.5, Unit: "tsp"}, "salt"}, nil},
+		{"¾ cup butter", Line{Quantity{Amount: 0.75, Unit: "cup"}, "butter"}, nil},
+		{"1/0 cup flour", Line{}, ErrInvalidAmount},
+		{"1 1/0 cup flour", Line{}, ErrInvalidAmount},
+		// Ranges
+		{"2-3 onions", Line{Quantity{Amount: 2, MaxAmount: 3, Unit: "i"}, "onions"}, nil},
+		{"2 - 3 onions", Line{Quantity{Amount: 2, MaxAmount: 3, Unit: "i"}, "onions"}, nil},
+		{"2–3 onions", Line{Quantity{Amount: 2, MaxAmount: 3, Unit: "i"}, "onions"}, nil},
+		{"2 to 3 cups stock", Line{Quantity{Amount: 2, MaxAmount: 3, Unit: "cup"}, "stock"}, nil},
+		{"2 or 3 carrots", Line{Quantity{Amount: 2, MaxAmount: 3, Unit: "i"}, "carrots"}, nil},
+		{"2 à 3 pommes", Line{Quantity{Amount: 2, MaxAmount: 3, Unit: "i"}, "pommes"}, nil},
+		{"1/2-1 tsp chili", Line{Quantity{Amount: 0.5, MaxAmount: 1, Unit: "tsp"}, "chili"}, nil},
+		{"1-2 lb beef", Line{Quantity{Amount: 453.59, MaxAmount: 907.18, Unit: "g"}, "beef"}, nil},
+		{"3-2 onions", Line{}, ErrInvalidAmount},
+		// Amounts in words
+		{"a pinch of salt", Line{Quantity{Amount: 0.0625, Unit: "tsp", Approximate: true}, "salt"}, nil},
+		{"A dash of vinegar", Line{Quantity{Amount: 0.125, Unit: "tsp", Approximate: true}, "vinegar"}, nil},
+		{"2 pinches of pepper", Line{Quantity{Amount: 0.125, Unit: "tsp", Approximate: true}, "pepper"}, nil},
+		{"an onion", Line{Quantity{Amount: 1, Unit: "i"}, "onion"}, nil},
+		{"one cup rice", Line{Quantity{Amount: 1, Unit: "cup"}, "rice"}, nil},
+		{"two eggs", Line{Quantity{Amount: 2, Unit: "i"}, "eggs"}, nil},
+		{"half a cup of cream", Line{Quantity{Amount: 0.5, Unit: "cup"}, "cream"}, nil},
+		{"a dozen eggs", Line{Quantity{Amount: 12, Unit: "i"}, "eggs"}, nil},
+		{"une pincée de sel", Line{Quantity{Amount: 0.0625, Unit: "tsp", Approximate: true}, "sel"}, nil},
+		{"deux oignons", Line{Quantity{Amount: 2, Unit: "i"}, "oignons"}, nil},
+		// Units of the registry and their aliases
+		{"500g de farine", Line{Quantity{Amount: 500, Unit: "g"}, "farine"}, nil},
+		{"500 g de farine", Line{Quantity{Amount: 500, Unit: "g"}, "farine"}, nil},
+		{"250 grams butter", Line{Quantity{Amount: 250, Unit: "g"}, "butter"}, nil},
+		{"1 kilo de pommes de terre", Line{Quantity{Amount: 1, Unit: "kg"}, "pommes de terre"}, nil},
+		{"200 ml cream", Line{Quantity{Amount: 200, Unit: "ml"}, "cream"}, nil},
+		{"2 tbsp olive oil", Line{Quantity{Amount: 2, Unit: "tbsp"}, "olive oil"}, nil},
+		{"2 tbsp. sugar", Line{Quantity{Amount: 2, Unit: "tbsp"}, "sugar"}, nil},
+		{"2 Tablespoons honey", Line{Quantity{Amount: 2, Unit: "tbsp"}, "honey"}, nil},
+		{"1 tsp vanilla", Line{Quantity{Amount: 1, Unit: "tsp"}, "vanilla"}, nil},
+		{"3 cs d'huile", Line{Quantity{Amount: 3, Unit: "tbsp"}, "huile"}, nil},
+		{"1 cc de sel", Line{Quantity{Amount: 1, Unit: "tsp"}, "sel"}, nil},
+		{"4 pieces of chicken", Line{Quantity{Amount: 4, Unit: "i"}, "chicken"}, nil},
+		{"2 cups of milk", Line{Quantity{Amount: 2, Unit: "cup"}, "milk"}, nil},
+		{"1 KG Flour", Line{Quantity{Amount: 1, Unit: "kg"}, "Flour"}, nil},
+		// Measures converted to the registry
+		{"8 oz cheese", Line{Quantity{Amount: 226.8, Unit: "g"}, "cheese"}, nil},
+		{"2 fl oz rum", Line{Quantity{Amount: 59.14, Unit: "ml"}, "rum"}, nil},
+		{"1 lb ground beef", Line{Quantity{Amount: 453.59, Unit: "g"}, "ground beef"}, nil},
+		{"25 cl de lait", Line{Quantity{Amount: 250, Unit: "ml"}, "lait"}, nil},
+		{"2 dl crème", Line{Quantity{Amount: 200, Unit: "ml"}, "crème"}, nil},
+		{"2 cuillères à soupe de sucre", Line{Quantity{Amount: 2, Unit: "tbsp"}, "sucre"}, nil},
+		{"1 c. à c. de cannelle", Line{Quantity{Amount: 1, Unit: "tsp"}, "cannelle"}, nil},
+		{"1 tasse de riz", Line{Quantity{Amount: 1, Unit: "cup"}, "riz"}, nil},
+		// The units are whole words
+		{"1 lemon", Line{Quantity{Amount: 1, Unit: "i"}, "lemon"}, nil},
+		{"2 green peppers", Line{Quantity{Amount: 2, Unit: "i"}, "green peppers"}, nil},
+		{"3 ounces", Line{}, ErrNoName},
+		{"2 cups", Line{}, ErrNoName},
+		// Names
+		{"2 onions, chopped", Line{Quantity{Amount: 2, Unit: "i"}, "onions, chopped"}, nil},
+		{"2 onions.", Line{Quantity{Amount: 2, Unit: "i"}, "onions"}, nil},
+		{"3 des oeufs", Line{Quantity{Amount: 3, Unit: "i"}, "oeufs"}, nil},
+		{"100 g du beurre", Line{Quantity{Amount: 100, Unit: "g"}, "beurre"}, nil},
+		// Errors
+		{"", Line{}, ErrEmpty},
+		{"   ", Line{}, ErrEmpty},
+		{"salt", Line{}, ErrNoAmount},
+		{"some salt", Line{}, ErrNoAmount},
+		{"-2 eggs", Line{}, ErrNoAmount},
+		{"0 eggs", Line{}, ErrInvalidAmount},
+		{"0.0 kg flour", Line{}, ErrInvalidAmount},
+		{"2", Line{}, ErrNoName},
+		{"a", Line{}, ErrNoName},
+		{strings.Repeat("9", 400) + " eggs", Line{}, ErrInvalidAmount},
+	}
+	for _, test := range tests {
+		line, err := Parse(test.line)
+		if !errors.Is(err, test.err) || line != test.expected {
+			t.Errorf("Parse(%q) = %+v, %v, expected %+v, %v", test.line, line, err, test.expected, test.err)
+		}
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Quantity
+		err      error
+	}{
+		{"1.5 kg", Quantity{Amount: 1.5, Unit: "kg"}, nil},
+		{"2", Quantity{Amount: 2, Unit: "i"}, nil},
+		{"500g", Quantity{Amount: 500, Unit: "g"}, nil},
+		{" 1 1/2 cups ", Quantity{Amount: 1.5, Unit: "cup"}, nil},
+		{"2-3", Quantity{Amount: 2, MaxAmount: 3, Unit: "i"}, nil},
+		{"a pinch", Quantity{Amount: 0.0625, Unit: "tsp", Approximate: true}, nil},
+		{"3 is", Quantity{Amount: 3, Unit: "i"}, nil},
+		{"1 kg flour", Quantity{}, ErrNotQuantity},
+		{"2 pounds of", Quantity{}, ErrNotQuantity},
+		{"", Quantity{}, ErrEmpty},
+		{"kg", Quantity{}, ErrNoAmount},
+		{"0 g", Quantity{}, ErrInvalidAmount},
+	}
+	for _, test := range tests {
+		quantity, err := ParseQuantity(test.text)
+		if !errors.Is(err, test.err) || quantity != test.expected {
+			t.Errorf("ParseQuantity(%q) = %+v, %v, expected %+v, %v", test.text, quantity, err, test.expected, test.err)
+		}
+	}
+}
+
+// checkQuantity checks the invariants of a parsed quantity
+func checkQuantity(t *testing.T, text string, quantity Quantity) {
+	if quantity.Amount <= 0 || math.IsInf(quantity.Amount, 0) || math.IsNaN(quantity.Amount) {
+		t.Errorf("%q: the amount %v should be a positive number", text, quantity.Amount)
+	}
+	if quantity.MaxAmount != 0 && (quantity.MaxAmount < quantity.Amount || math.IsInf(quantity.MaxAmount, 0)) {
+		t.Errorf("%q: the range %v-%v is invalid", text, quantity.Amount, quantity.MaxAmount)
+	}
+	if symbol, err := units.Canonical(quantity.Unit); err != nil || symbol != quantity.Unit {
+		t.Errorf("%q: the unit %q should be a symbol of the registry", text, quantity.Unit)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		"2 kg potatoes", "1 1/2 cups flour", "2-3 onions", "a pinch of salt", "500g de farine", "½ lemon",
+		"1 c. à c. de cannelle", "2 fl oz rum", "half a cup of cream", "1/0 cup", "3-2 onions", "1,5 l d'eau",
+		"2 tbsp. sugar", "İ 2 kg", "2 KG", "a dozen eggs", "2 à 3 pommes", "\xff2 g",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		line, err := Parse(text)
+		if err != nil {
+			if line != (Line{}) {
+				t.Errorf("%q: the line should be empty on error, got %+v", text, line)
+			}
+			return
+		}
+		checkQuantity(t, text, line.Quantity)
+		if line.Name == "" || line.Name != strings.TrimSpace(line.Name) || !utf8.ValidString(line.Name) {
+			t.Errorf("%q: invalid name %q", text, line.Name)
+		}
+
+		// A quantity parsed from a line is parsed again from its text
+		quantity, err := ParseQuantity(strings.TrimSuffix(text, line.Name))
+		if err == nil {
+			checkQuantity(t, text, quantity)
+		}
+	})
+}
+
+func FuzzParseQuantity(f *testing.F) {
+	for _, seed := range []string{"1.5 kg", "2", "500g", "1 1/2 cups", "2-3", "a pinch", "¾", "1 lb", "0 g"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		quantity, err := ParseQuantity(text)
+		if err != nil {
+			return
+		}
+		checkQuantity(t, text, quantity)
+		// The quantity names no ingredient
+		if _, err := Parse(text); !errors.Is(err, ErrNoName) {
+			t.Errorf("%q: Parse should fail with ErrNoName, got %v", text, err)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// cache keeps the most recently used ingredients of the catalog, up to size entries, each one for the TTL
+type cache struct {
+	size int
+	ttl  time.Duration
+	mu   sync.Mutex
+	// The most recently used entry first, the values are *cacheItem
+	order *list.List
+	items map[string]*list.Element
+}
+
+// cacheItem is an ingredient of the catalog, nil when the Catalog MS does not know it
+type cacheItem struct {
+	key        string
+	ingredient *IngredientCatalog
+	expiresAt  time.Time
+}
+
+func newCache(size int, ttl time.Duration) *cache {
+	return &cache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns a copy of the cached ingredient, and false when the key is not cached or expired
+func (c *cache) get(key string) (*IngredientCatalog, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := element.Value.(*cacheItem)
+	if !time.Now().Before(item.expiresAt) {
+		c.order.Remove(element)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	if item.ingredient == nil {
+		return nil, true
+	}
+	ingredient := *item.ingredient
+	return &ingredient, true
+}
+
+// put caches a copy of the ingredient, nil for an unknown ingredient, and evicts the least recently used entry when full
+func (c *cache) put(key string, ingredient *IngredientCatalog) {
+	item := &cacheItem{key: key, expiresAt: time.Now().Add(c.ttl)}
+	if ingredient != nil {
+		cached := *ingredient
+		item.ingredient = &cached
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		element.Value = item
+		c.order.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.order.PushFront(item)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheItem).key)
+	}
+}
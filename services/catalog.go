@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"shopping-list/units"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default time the ingredients of the catalog are kept in the cache
+const DefaultCatalogCacheTTL = 10 * time.Minute
+
+// Default number of ingredients kept in the cache, the least recently used ones are evicted first
+const DefaultCatalogCacheSize = 5000
+
+// Number of ingredients requested at the same time to the Catalog MS by GetIngredients
+const catalogWorkers = 4
+
+// CatalogClient fetches the ingredients from the Catalog MS and keeps them in a local cache
+type CatalogClient struct {
+	client *Client
+	cache  *cache
+	// Ingredients by lowercase name
+	names *cache
+}
+
+func NewCatalogClient(baseURL string, timeout time.Duration, retries int, ttl time.Duration) *CatalogClient {
+	return &CatalogClient{
+		client: NewClient(baseURL, timeout, retries),
+		cache:  newCache(DefaultCatalogCacheSize, ttl),
+		names:  newCache(DefaultCatalogCacheSize, ttl),
+	}
+}
+
+// GetIngredient returns the ingredient of the catalog, ErrNotFound when the Catalog MS does not know it
+func (c *CatalogClient) GetIngredient(ctx context.Context, ingredientId string) (*IngredientCatalog, error) {
+	if ingredient, ok := c.cache.get(ingredientId); ok {
+		if ingredient == nil {
+			return nil, ErrNotFound
+		}
+		return ingredient, nil
+	}
+
+	ingredient := new(IngredientCatalog)
+	err := c.client.get(ctx, ingredient, "ingredient", ingredientId)
+	if errors.Is(err, ErrNotFound) {
+		// The unknown ingredients are cached too, so that they are not requested again for every list
+		c.cache.put(ingredientId, nil)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ingredient.ID == "" {
+		ingredient.ID = ingredientId
+	}
+	addDensity(ingredient)
+	c.cache.put(ingredientId, ingredient)
+	return ingredient, nil
+}
+
+// addDensity gives the density of the ingredient to the units registry, so that its volumes and its pieces are
+// summed with its masses in the lists
+func addDensity(ingredient *IngredientCatalog) {
+	if ingredient.Density > 0 || ingredient.PieceWeight > 0 {
+		units.AddDensity(ingredient.ID, units.Density{GramsPerMl: ingredient.Density, GramsPerPiece: ingredient.PieceWeight})
+	}
+}
+
+// GetIngredients returns the ingredients of the catalog by ID, the unknown ingredients are left out.
+// The ingredients are requested by catalogWorkers at a time. The lookup stops at the first failure of the Catalog MS,
+// the error is returned with the ingredients found so far.
+func (c *CatalogClient) GetIngredients(ctx context.Context, ingredientIds []string) (map[string]IngredientCatalog, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		failure     error
+		ingredients = make(map[string]IngredientCatalog, len(ingredientIds))
+	)
+	ids := make(chan string)
+	for i := 0; i < min(catalogWorkers, len(ingredientIds)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				ingredient, err := c.GetIngredient(ctx, id)
+				mu.Lock()
+				switch {
+				case err == nil:
+					ingredients[id] = *ingredient
+				case !errors.Is(err, ErrNotFound) && failure == nil:
+					failure = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range ingredientIds {
+		ids <- id
+	}
+	close(ids)
+	wg.Wait()
+	return ingredients, failure
+}
+
+// FindIngredient returns the ingredient of the catalog named name, ignoring the case,
+// ErrNotFound when the Catalog MS does not know it
+func (c *CatalogClient) FindIngredient(ctx context.Context, name string) (*IngredientCatalog, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if ingredient, ok := c.names.get(name); ok {
+		if ingredient == nil {
+			return nil, ErrNotFound
+		}
+		return ingredient, nil
+	}
+
+	ingredient := new(IngredientCatalog)
+	err := c.client.get(ctx, ingredient, "ingredient", "name", name)
+	if err == nil && ingredient.ID == "" {
+		err = ErrNotFound
+	}
+	if errors.Is(err, ErrNotFound) {
+		c.names.put(name, nil)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	addDensity(ingredient)
+	c.names.put(name, ingredient)
+	// The ingredient found by name is also cached by ID, for the names of the list
+	c.cache.put(ingredient.ID, ingredient)
+	return ingredient, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"shopping-list/units"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCatalogClient(t *testing.T) {
+	var requests atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case failing.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/ingredient/000000000000000000000001", r.URL.Path == "/ingredient/name/flour":
+			w.Write([]byte(`{"id":"000000000000000000000001","name":"Flour","description":"Wheat flour","type":"cereals","density":0.55}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("The ingredients are cached", func(t *testing.T) {
+		requests.Store(0)
+		client := NewCatalogClient(server.URL, time.Second, 0, time.Minute)
+
+		for i := 0; i < 3; i++ {
+			ingredient, err := client.GetIngredient(context.Background(), "000000000000000000000001")
+			if err != nil || ingredient.Name != "Flour" {
+				t.Fatalf("Wrong ingredient: %v %v", ingredient, err)
+			}
+			if _, err := client.GetIngredient(context.Background(), "unknown"); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Expected ErrNotFound, got %v", err)
+			}
+		}
+		if requests.Load() != 2 {
+			t.Errorf("Expected one request by ingredient, got %d", requests.Load())
+		}
+	})
+
+	t.Run("The densities of the catalog are given to the units", func(t *testing.T) {
+		client := NewCatalogClient(server.URL, time.Second, 0, time.Minute)
+
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		if grams, ok := units.ToMass("000000000000000000000001", 200, "ml"); !ok || grams != 110 {
+			t.Errorf("The volume should be converted with the density of the catalog: %v %v", grams, ok)
+		}
+	})
+
+	t.Run("The cache expires", func(t *testing.T) {
+		requests.Store(0)
+		client := NewCatalogClient(server.URL, time.Second, 0, time.Nanosecond)
+
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		time.Sleep(time.Millisecond)
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		if requests.Load() != 2 {
+			t.Errorf("The expired ingredient should be requested again, got %d requests", requests.Load())
+		}
+	})
+
+	t.Run("Get the ingredients found in the catalog", func(t *testing.T) {
+		client := NewCatalogClient(server.URL, time.Second, 0, time.Minute)
+
+		ingredients, err := client.GetIngredients(context.Background(), []string{"000000000000000000000001", "unknown"})
+		if err != nil || len(ingredients) != 1 || ingredients["000000000000000000000001"].Type != "cereals" {
+			t.Errorf("Wrong ingredients: %v %v", ingredients, err)
+		}
+
+		// The cached ingredients are still returned when the catalog fails
+		failing.Store(true)
+		defer failing.Store(false)
+		requests.Store(0)
+		ids := []string{"000000000000000000000001"}
+		for i := 2; i <= 20; i++ {
+			ids = append(ids, fmt.Sprintf("%024d", i))
+		}
+		ingredients, err = client.GetIngredients(context.Background(), ids)
+		if !errors.Is(err, ErrUnavailable) || len(ingredients) != 1 {
+			t.Errorf("Expected the cached ingredient and ErrUnavailable: %v %v", ingredients, err)
+		}
+		if requests.Load() > catalogWorkers {
+			t.Errorf("The lookup should stop at the first failure, got %d requests", requests.Load())
+		}
+	})
+
+	t.Run("Find the ingredients by name", func(t *testing.T) {
+		requests.Store(0)
+		client := NewCatalogClient(server.URL, time.Second, 0, time.Minute)
+
+		for _, name := range []string{"Flour", " flour ", "FLOUR"} {
+			ingredient, err := client.FindIngredient(context.Background(), name)
+			if err != nil || ingredient.ID != "000000000000000000000001" {
+				t.Fatalf("Wrong ingredient for %q: %v %v", name, ingredient, err)
+			}
+		}
+		if _, err := client.FindIngredient(context.Background(), "sugar"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+		client.FindIngredient(context.Background(), "sugar")
+		// The ingredient found by name is cached by ID
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		if requests.Load() != 2 {
+			t.Errorf("Expected one request by name, got %d", requests.Load())
+		}
+	})
+
+	t.Run("The least recently used ingredients are evicted", func(t *testing.T) {
+		requests.Store(0)
+		client := NewCatalogClient(server.URL, time.Second, 0, time.Minute)
+		client.cache = newCache(2, time.Minute)
+
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		client.GetIngredient(context.Background(), "000000000000000000000002")
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		client.GetIngredient(context.Background(), "000000000000000000000003")
+		if requests.Load() != 3 {
+			t.Fatalf("Expected one request by ingredient, got %d", requests.Load())
+		}
+		// The second ingredient was the least recently used
+		client.GetIngredient(context.Background(), "000000000000000000000001")
+		client.GetIngredient(context.Background(), "000000000000000000000002")
+		if requests.Load() != 4 || len(client.cache.items) != 2 {
+			t.Errorf("Only the least recently used ingredient should be evicted, got %d requests", requests.Load())
+		}
+	})
+}
+
+func TestCatalogClientParallel(t *testing.T) {
+	var mu sync.Mutex
+	running, highest := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		running++
+		highest = max(highest, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		fmt.Fprintf(w, `{"name":"Ingredient","description":"Ingredient","type":"other"}`)
+	}))
+	defer server.Close()
+	client := NewCatalogClient(server.URL, time.Second, 0, time.Minute)
+
+	ids := make([]string, 3*catalogWorkers)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%024d", i)
+	}
+	ingredients, err := client.GetIngredients(context.Background(), ids)
+	if err != nil || len(ingredients) != len(ids) || ingredients[ids[5]].ID != ids[5] {
+		t.Fatalf("Wrong ingredients: %v %v", ingredients, err)
+	}
+	if highest < 2 || highest > catalogWorkers {
+		t.Errorf("Expected at most %d requests at the same time, got %d", catalogWorkers, highest)
+	}
+}
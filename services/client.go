@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logrus.WithFields(logrus.Fields{
+	"context": "services/client",
+})
+
+// Default timeout of each request to a microservice
+const DefaultTimeout = 5 * time.Second
+
+// Default number of retries of a failed request to a microservice
+const DefaultRetries = 2
+
+// Delay before the first retry, doubled at each retry
+const retryDelay = 100 * time.Millisecond
+
+// Number of consecutive requests failing after all their retries that open the circuit, and time it stays open
+const (
+	breakerThreshold = 3
+	breakerCooldown  = 30 * time.Second
+)
+
+// ErrNotFound is returned when the microservice does not know the requested resource
+var ErrNotFound = errors.New("not found by the service")
+
+// ErrUnavailable is returned when the microservice still fails after all the retries
+var ErrUnavailable = errors.New("service unavailable")
+
+// Client calls the HTTP API of a microservice, the requests failing on the network or with a server error are retried.
+// After threshold requests failed in a row the circuit opens: the requests fail at once with ErrUnavailable during
+// the cooldown, then a single failure opens it again until a request succeeds.
+type Client struct {
+	baseURL   string
+	http      *http.Client
+	retries   int
+	threshold int
+	cooldown  time.Duration
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func NewClient(baseURL string, timeout time.Duration, retries int) *Client {
+	return &Client{
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		http:      &http.Client{Timeout: timeout},
+		retries:   retries,
+		threshold: breakerThreshold,
+		cooldown:  breakerCooldown,
+	}
+}
+
+// open tells if the circuit is open, the requests are not sent until the cooldown ends
+func (c *Client) open() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Before(c.openUntil)
+}
+
+// record counts the requests failing after all their retries in a row, and opens the circuit at the threshold
+func (c *Client) record(unavailable bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !unavailable {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.failures >= c.threshold {
+		c.openUntil = time.Now().Add(c.cooldown)
+	}
+}
+
+// get decodes the JSON response of GET <baseURL>/<path>
+func (c *Client) get(ctx context.Context, v interface{}, path ...string) error {
+	for i, segment := range path {
+		path[i] = url.PathEscape(segment)
+	}
+	target := c.baseURL + "/" + strings.Join(path, "/")
+	l := logger.WithContext(ctx).WithField("url", target)
+	if c.open() {
+		return fmt.Errorf("%w: the circuit is open", ErrUnavailable)
+	}
+
+	var err error
+	for attempt := 0; attempt <= c.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryDelay << (attempt - 1)):
+			}
+			l.WithError(err).WithField("retry", attempt).Warn("Retrying the request")
+		}
+		var retry bool
+		retry, err = c.do(ctx, target, v)
+		if !retry {
+			// The cancellation of the caller says nothing about the service
+			if ctx.Err() == nil {
+				c.record(false)
+			}
+			return err
+		}
+	}
+	c.record(true)
+	l.WithError(err).Error("The service is unavailable")
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+// do sends the request once, and tells if the failure is worth a retry
+func (c *Client) do(ctx context.Context, target string, v interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := c.http.Do(req)
+	if err != nil {
+		// The request was cancelled by the caller, not by the timeout of the client
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return true, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return false, ErrNotFound
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError:
+		return true, fmt.Errorf("unexpected status %d", res.StatusCode)
+	case res.StatusCode != http.StatusOK:
+		return false, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return false, err
+	}
+	return false, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	recipe := Recipe{ID: "000000000000000000000001", Servings: 4, Ingredients: []IngredientRecipe{
+		{ID: "000000000000000000000001", Quantity: 200, Units: "g"},
+	}}
+
+	t.Run("Get a recipe", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/recipe/000000000000000000000001" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"id":"000000000000000000000001","servings":4,"ingredients":[{"id":"000000000000000000000001","quantity":200,"units":"g"}]}`))
+		}))
+		defer server.Close()
+		client := NewRecipeClient(server.URL, time.Second, 0)
+
+		got, err := client.GetRecipe(context.Background(), recipe.ID)
+		if err != nil || got.Servings != 4 || len(got.Ingredients) != 1 || got.Ingredients[0].Quantity != 200 {
+			t.Errorf("Wrong recipe: %v %v", got, err)
+		}
+		if _, err := client.GetRecipe(context.Background(), "unknown"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Retry the server errors", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if requests.Add(1) < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"id":"000000000000000000000001","servings":4}`))
+		}))
+		defer server.Close()
+
+		if _, err := NewRecipeClient(server.URL, time.Second, 1).GetRecipe(context.Background(), recipe.ID); !errors.Is(err, ErrUnavailable) {
+			t.Errorf("Expected ErrUnavailable after the retries, got %v", err)
+		}
+		if _, err := NewRecipeClient(server.URL, time.Second, 1).GetRecipe(context.Background(), recipe.ID); err != nil {
+			t.Errorf("The retry should succeed: %v", err)
+		}
+		if requests.Load() != 3 {
+			t.Errorf("Expected 3 requests, got %d", requests.Load())
+		}
+	})
+
+	t.Run("Do not retry the client errors", func(t *testing.T) {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer server.Close()
+
+		if _, err := NewRecipeClient(server.URL, time.Second, 2).GetRecipe(context.Background(), recipe.ID); err == nil || requests.Load() != 1 {
+			t.Errorf("The request should fail without retry: %v, %d requests", err, requests.Load())
+		}
+	})
+
+	t.Run("Open the circuit after repeated failures", func(t *testing.T) {
+		var requests atomic.Int32
+		var failing atomic.Bool
+		failing.Store(true)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"id":"000000000000000000000001","servings":4}`))
+		}))
+		defer server.Close()
+		client := NewRecipeClient(server.URL, time.Second, 0)
+		client.client.cooldown = 50 * time.Millisecond
+
+		for i := 0; i < breakerThreshold+2; i++ {
+			if _, err := client.GetRecipe(context.Background(), recipe.ID); !errors.Is(err, ErrUnavailable) {
+				t.Errorf("Expected ErrUnavailable, got %v", err)
+			}
+		}
+		if requests.Load() != breakerThreshold {
+			t.Errorf("The open circuit should not send the requests, got %d requests", requests.Load())
+		}
+
+		// After the cooldown a request is tried again, and a success closes the circuit
+		time.Sleep(60 * time.Millisecond)
+		failing.Store(false)
+		if _, err := client.GetRecipe(context.Background(), recipe.ID); err != nil {
+			t.Errorf("The circuit should be closed after the cooldown: %v", err)
+		}
+		failing.Store(true)
+		client.GetRecipe(context.Background(), recipe.ID)
+		client.GetRecipe(context.Background(), recipe.ID)
+		if requests.Load() != breakerThreshold+3 {
+			t.Errorf("The failures should be counted again from zero, got %d requests", requests.Load())
+		}
+	})
+
+	t.Run("Time out a slow service", func(t *testing.T) {
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+			}
+		}))
+		defer server.Close()
+		defer close(done)
+
+		start := time.Now()
+		_, err := NewRecipeClient(server.URL, 20*time.Millisecond, 1).GetRecipe(context.Background(), recipe.ID)
+		if !errors.Is(err, ErrUnavailable) || time.Since(start) > 500*time.Millisecond {
+			t.Errorf("The request should time out: %v after %v", err, time.Since(start))
+		}
+	})
+}
+
+func TestScale(t *testing.T) {
+	recipe := Recipe{Servings: 4, Ingredients: []IngredientRecipe{
+		{ID: "1", Quantity: 200, Units: "g"},
+		{ID: "2", Quantity: 3, Units: "i"},
+	}}
+	tests := []struct {
+		servings int
+		expected []float64
+	}{
+		{4, []float64{200, 3}},
+		{2, []float64{100, 1.5}},
+		{6, []float64{300, 4.5}},
+		{3, []float64{150, 2.25}},
+	}
+	for _, test := range tests {
+		ingredients := recipe.Scale(test.servings)
+		for i, ingredient := range ingredients {
+			if ingredient.Quantity != test.expected[i] {
+				t.Errorf("Scale(%d) = %v, expected %v", test.servings, ingredients, test.expected)
+			}
+		}
+	}
+	if recipe.Ingredients[0].Quantity != 200 {
+		t.Errorf("The recipe should not be modified: %v", recipe)
+	}
+}
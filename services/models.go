@@ -28,7 +28,7 @@ type Timer struct {
 type IngredientRecipe struct {
 	ID       string  `json:"id" validate:"omitempty"`
 	Quantity float64 `json:"quantity" validate:"required,min=0"`
-	Units    string  `json:"units" validate:"oneof=i is cs tbsp tsp g kg"`
+	Units    string  `json:"units" validate:"unit"`
 }
 
 type Recipe struct {
@@ -47,11 +47,21 @@ type Recipe struct {
 // ---           --- //
 // *** CATALOG MS *** //
 // ---           --- //
+
+// Type of the ingredients unknown by the catalog
+const OtherType = "other"
+
+// IngredientTypes are the types of the catalog ingredients, in the default order of the aisles of a store
+var IngredientTypes = []string{"vegetable", "fruit", "meat", "fish", "dairy", "cereals", "nuts", "spice", "sugar", OtherType}
+
 type IngredientCatalog struct {
 	ID          string `json:"id" validate:"omitempty"`
 	Name        string `json:"name" validate:"required"`
 	Description string `json:"description" validate:"required"`
 	Type        string `json:"type" validate:"required,oneof=vegetable fruit meat fish dairy spice sugar cereals nuts other"`
+	// Optional mass of the ingredient, in grams per millilitre and in grams per piece
+	Density     float64 `json:"density,omitempty" validate:"omitempty,gt=0"`
+	PieceWeight float64 `json:"pieceWeight,omitempty" validate:"omitempty,gt=0"`
 }
 
 func GetDish(dish Dish) string {
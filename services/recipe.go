@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// RecipeClient fetches the recipes from the Recipe MS
+type RecipeClient struct {
+	client *Client
+}
+
+func NewRecipeClient(baseURL string, timeout time.Duration, retries int) *RecipeClient {
+	return &RecipeClient{client: NewClient(baseURL, timeout, retries)}
+}
+
+// GetRecipe returns the recipe, ErrNotFound when the Recipe MS does not know it
+func (r *RecipeClient) GetRecipe(ctx context.Context, recipeId string) (*Recipe, error) {
+	recipe := new(Recipe)
+	if err := r.client.get(ctx, recipe, "recipe", recipeId); err != nil {
+		return nil, err
+	}
+	if recipe.ID == "" {
+		recipe.ID = recipeId
+	}
+	return recipe, nil
+}
+
+// Scale returns the ingredients of the recipe for the number of servings
+func (r *Recipe) Scale(servings int) []IngredientRecipe {
+	ingredients := make([]IngredientRecipe, len(r.Ingredients))
+	copy(ingredients, r.Ingredients)
+	if r.Servings <= 0 || servings == r.Servings {
+		return ingredients
+	}
+	ratio := float64(servings) / float64(r.Servings)
+	for i := range ingredients {
+		ingredients[i].Quantity = math.Round(ingredients[i].Quantity*ratio*1000) / 1000
+	}
+	return ingredients
+}
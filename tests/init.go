@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"shopping-list/configuration"
+	"testing"
 
 	dockertest "github.com/ory/dockertest/v3"
 	"github.com/redis/go-redis/v9"
@@ -42,6 +43,17 @@ func InitTestDocker(exposedPort string) (*redis.Client, *dockertest.Pool, *docke
 	return rdb, pool, resource
 }
 
+// SkipWithoutDocker skips the test when the Docker daemon running the Redis containers is not reachable
+func SkipWithoutDocker(tb testing.TB) {
+	pool, err := dockertest.NewPool("")
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		tb.Skipf("Docker is not available: %v", err)
+	}
+}
+
 func CloseTestDocker(client *redis.Client, pool *dockertest.Pool, resource *dockertest.Resource) {
 	// When you're done, kill and remove the container
 	if err := pool.Purge(resource); err != nil {
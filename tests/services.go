@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// ServiceStub is a stub of the HTTP API of a microservice, it serves the JSON of the registered resources
+type ServiceStub struct {
+	*httptest.Server
+	mu        sync.Mutex
+	resources map[string]interface{}
+	failures  int
+	requests  int
+}
+
+// NewServiceStub starts the stub, resources maps the paths, like /recipe/<id>, to the values served as JSON
+func NewServiceStub(resources map[string]interface{}) *ServiceStub {
+	stub := &ServiceStub{resources: resources}
+	stub.Server = httptest.NewServer(http.HandlerFunc(stub.serve))
+	return stub
+}
+
+// FailNext makes the next requests fail with a server error
+func (s *ServiceStub) FailNext(failures int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = failures
+}
+
+// Requests returns the number of requests received
+func (s *ServiceStub) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *ServiceStub) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	resource, ok := s.resources[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resource)
+}
@@ -0,0 +1,82 @@
+package units
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Density gives the mass of an ingredient measured in volume or in pieces, a zero value is unknown
+type Density struct {
+	GramsPerMl    float64 `json:"gramsPerMl,omitempty"`
+	GramsPerPiece float64 `json:"gramsPerPiece,omitempty"`
+}
+
+// Densities is the density table of the ingredients, keyed by catalog ingredient ID
+type Densities map[string]Density
+
+// table is the density table used by ToMass, like the registry it is shared by the whole program
+var table atomic.Pointer[Densities]
+
+// catalogDensities are the densities given by the catalog, by ingredient ID, used for the ingredients missing from the table
+var catalogDensities sync.Map
+
+// SetDensities sets the density table used by ToMass, nil removes it
+func SetDensities(densities Densities) {
+	table.Store(&densities)
+}
+
+// AddDensity records the density of an ingredient given by the catalog, the density table set by SetDensities
+// takes precedence over it
+func AddDensity(ingredientId string, density Density) {
+	catalogDensities.Store(ingredientId, density)
+}
+
+// ToMass converts the amount of the ingredient to grams with the density table set by SetDensities, or the density
+// added by AddDensity when the ingredient is not in the table, see Densities.ToMass
+func ToMass(ingredientId string, amount float64, unit string) (float64, bool) {
+	var densities Densities
+	if d := table.Load(); d != nil {
+		densities = *d
+	}
+	if _, ok := densities[ingredientId]; !ok {
+		if density, ok := catalogDensities.Load(ingredientId); ok {
+			densities = Densities{ingredientId: density.(Density)}
+		}
+	}
+	return densities.ToMass(ingredientId, amount, unit)
+}
+
+// LoadDensities reads the density table from a JSON file, {"<ingredientId>": {"gramsPerMl": 0.55}}
+func LoadDensities(path string) (Densities, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	densities := make(Densities)
+	if err := json.Unmarshal(content, &densities); err != nil {
+		return nil, err
+	}
+	return densities, nil
+}
+
+// ToMass converts the amount of the ingredient to grams, using its density for a volume and its piece weight
+// for a count. It returns false when the unit is unknown or the needed density is not in the table.
+func (d Densities) ToMass(ingredientId string, amount float64, unit string) (float64, bool) {
+	from, err := Lookup(unit)
+	if err != nil {
+		return 0, false
+	}
+	grams := amount * from.Factor
+	density := d[ingredientId]
+	switch {
+	case from.Dimension == Mass:
+		return round(grams), true
+	case from.Dimension == Volume && density.GramsPerMl > 0:
+		return round(grams * density.GramsPerMl), true
+	case from.Dimension == Count && density.GramsPerPiece > 0:
+		return round(grams * density.GramsPerPiece), true
+	}
+	return 0, false
+}
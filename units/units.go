@@ -0,0 +1,158 @@
+// Package units converts the quantities of the ingredients between the units of a same dimension,
+// so that 500 g and 1 kg of flour are summed in a single line of the shopping list.
+package units
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Dimension is the physical quantity measured by a unit, only the units of a same dimension can be converted
+type Dimension string
+
+const (
+	Mass   Dimension = "mass"
+	Volume Dimension = "volume"
+	Count  Dimension = "count"
+)
+
+// Unit is a unit of a dimension, Factor is the number of base units of the dimension in one unit.
+// The unit is saved with its Symbol, the Aliases are the other names accepted for it.
+type Unit struct {
+	Symbol    string
+	Dimension Dimension
+	Factor    float64
+	Aliases   []string
+}
+
+var (
+	ErrUnknownUnit       = errors.New("unknown unit")
+	ErrIncompatibleUnits = errors.New("the units measure different dimensions")
+	baseUnits            = map[Dimension]string{Mass: "g", Volume: "ml", Count: "i"}
+	// Units by symbol and by alias
+	registry = make(map[string]Unit)
+	// Units used to display a quantity in the best fitting unit, from the largest to the smallest
+	displayUnits = map[Dimension][]string{
+		Mass:   {"kg", "g"},
+		Volume: {"l", "ml"},
+		Count:  {"i"},
+	}
+)
+
+// The registry is the single list of the units accepted by the API, the messages and the other services
+func init() {
+	for _, unit := range []Unit{
+		{Symbol: "g", Dimension: Mass, Factor: 1, Aliases: []string{"gr", "gram", "grams", "gramme", "grammes"}},
+		{Symbol: "kg", Dimension: Mass, Factor: 1000, Aliases: []string{"kilo", "kilos", "kilogram", "kilograms", "kilogramme", "kilogrammes"}},
+		{Symbol: "ml", Dimension: Volume, Factor: 1, Aliases: []string{"millilitre", "millilitres", "milliliter", "milliliters"}},
+		{Symbol: "l", Dimension: Volume, Factor: 1000, Aliases: []string{"litre", "litres", "liter", "liters"}},
+		// cc is the cuillère à café, the french teaspoon
+		{Symbol: "tsp", Dimension: Volume, Factor: 5, Aliases: []string{"teaspoon", "teaspoons", "cc"}},
+		// cs is the cuillère à soupe, the french tablespoon
+		{Symbol: "tbsp", Dimension: Volume, Factor: 15, Aliases: []string{"tablespoon", "tablespoons", "tbs", "cs"}},
+		{Symbol: "cup", Dimension: Volume, Factor: 240, Aliases: []string{"cups"}},
+		// is is the plural of i used by the recipe service
+		{Symbol: "i", Dimension: Count, Factor: 1, Aliases: []string{"is", "item", "items", "piece", "pieces", "pc", "pcs"}},
+	} {
+		registry[unit.Symbol] = unit
+		for _, alias := range unit.Aliases {
+			registry[alias] = unit
+		}
+	}
+}
+
+// Lookup returns the unit of the symbol or of the alias, ignoring the case
+func Lookup(symbol string) (Unit, error) {
+	unit, ok := registry[strings.ToLower(strings.TrimSpace(symbol))]
+	if !ok {
+		return Unit{}, ErrUnknownUnit
+	}
+	return unit, nil
+}
+
+// Valid tells if the symbol is a unit of the registry, or an alias of one
+func Valid(symbol string) bool {
+	_, err := Lookup(symbol)
+	return err == nil
+}
+
+// Canonical returns the symbol of the unit named by the symbol or the alias
+func Canonical(symbol string) (string, error) {
+	unit, err := Lookup(symbol)
+	if err != nil {
+		return "", err
+	}
+	return unit.Symbol, nil
+}
+
+// Base returns the base unit of the dimension of the symbol, the unit every quantity of the dimension is normalised to
+func Base(symbol string) (string, error) {
+	unit, err := Lookup(symbol)
+	if err != nil {
+		return "", err
+	}
+	return baseUnits[unit.Dimension], nil
+}
+
+// Convert converts the amount from a unit to another unit of the same dimension
+func Convert(amount float64, from string, to string) (float64, error) {
+	fromUnit, err := Lookup(from)
+	if err != nil {
+		return 0, err
+	}
+	toUnit, err := Lookup(to)
+	if err != nil {
+		return 0, err
+	}
+	if fromUnit.Dimension != toUnit.Dimension {
+		return 0, ErrIncompatibleUnits
+	}
+	return round(amount * fromUnit.Factor / toUnit.Factor), nil
+}
+
+// Normalize converts the amount to the base unit of its dimension, the amounts in an unknown unit are kept as they are
+func Normalize(amount float64, unit string) (float64, string) {
+	base, err := Base(unit)
+	if err != nil {
+		return amount, unit
+	}
+	converted, _ := Convert(amount, unit, base)
+	return converted, base
+}
+
+// BestFit converts the amount to the largest display unit of its dimension giving an amount of at least 1,
+// 1500 g is displayed as 1.5 kg and 0.5 l as 500 ml. The amounts in an unknown unit are kept as they are.
+func BestFit(amount float64, unit string) (float64, string) {
+	from, err := Lookup(unit)
+	if err != nil {
+		return amount, unit
+	}
+	candidates := displayUnits[from.Dimension]
+	for _, symbol := range candidates {
+		converted, _ := Convert(amount, unit, symbol)
+		if math.Abs(converted) >= 1 {
+			return converted, symbol
+		}
+	}
+	smallest := candidates[len(candidates)-1]
+	converted, _ := Convert(amount, unit, smallest)
+	return converted, smallest
+}
+
+// Format displays the amount in the best fitting unit, rounded to 2 decimals: 1500 g is "1.5 kg", 2 tbsp is "30 ml",
+// and 2 i is "2" as the pieces are counted without unit. The amounts in an unknown unit keep their unit.
+func Format(amount float64, unit string) string {
+	amount, unit = BestFit(amount, unit)
+	formatted := strconv.FormatFloat(math.Round(amount*100)/100, 'f', -1, 64)
+	if symbol, err := Canonical(unit); (err == nil && symbol == baseUnits[Count]) || unit == "" {
+		return formatted
+	}
+	return formatted + " " + unit
+}
+
+// round removes the floating point noise of the conversions, 0.1 kg is 100 g and not 100.00000000000001 g
+func round(amount float64) float64 {
+	return math.Round(amount*1e9) / 1e9
+}
@@ -0,0 +1,205 @@
+package units
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		from, to string
+		expected float64
+		err      error
+	}{
+		{1, "kg", "g", 1000, nil},
+		{250, "g", "kg", 0.25, nil},
+		{0.1, "kg", "g", 100, nil},
+		{1.5, "l", "ml", 1500, nil},
+		{3, "tsp", "tbsp", 1, nil},
+		{2, "cs", "ml", 30, nil},
+		{1, "cup", "ml", 240, nil},
+		{4, "is", "i", 4, nil},
+		{1, "kg", "l", 0, ErrIncompatibleUnits},
+		{1, "i", "g", 0, ErrIncompatibleUnits},
+		{1, "pinch", "g", 0, ErrUnknownUnit},
+		{1, "g", "pound", 0, ErrUnknownUnit},
+	}
+	for _, test := range tests {
+		converted, err := Convert(test.amount, test.from, test.to)
+		if !errors.Is(err, test.err) || converted != test.expected {
+			t.Errorf("Convert(%v, %s, %s) = %v, %v, expected %v, %v", test.amount, test.from, test.to, converted, err, test.expected, test.err)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		amount       float64
+		unit         string
+		expected     float64
+		expectedUnit string
+	}{
+		{1, "kg", 1000, "g"},
+		{500, "g", 500, "g"},
+		{2, "tbsp", 30, "ml"},
+		{0.5, "l", 500, "ml"},
+		{3, "is", 3, "i"},
+		{1, "pinch", 1, "pinch"},
+	}
+	for _, test := range tests {
+		amount, unit := Normalize(test.amount, test.unit)
+		if amount != test.expected || unit != test.expectedUnit {
+			t.Errorf("Normalize(%v, %s) = %v %s, expected %v %s", test.amount, test.unit, amount, unit, test.expected, test.expectedUnit)
+		}
+	}
+}
+
+func TestBestFit(t *testing.T) {
+	tests := []struct {
+		amount       float64
+		unit         string
+		expected     float64
+		expectedUnit string
+	}{
+		{1500, "g", 1.5, "kg"},
+		{999, "g", 999, "g"},
+		{1000, "g", 1, "kg"},
+		{0.2, "kg", 200, "g"},
+		{2000, "ml", 2, "l"},
+		{3, "tbsp", 45, "ml"},
+		{8, "cup", 1.92, "l"},
+		{0.5, "g", 0.5, "g"},
+		{2, "is", 2, "i"},
+		{1, "pinch", 1, "pinch"},
+	}
+	for _, test := range tests {
+		amount, unit := BestFit(test.amount, test.unit)
+		if amount != test.expected || unit != test.expectedUnit {
+			t.Errorf("BestFit(%v, %s) = %v %s, expected %v %s", test.amount, test.unit, amount, unit, test.expected, test.expectedUnit)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		amount   float64
+		unit     string
+		expected string
+	}{
+		{1500, "g", "1.5 kg"},
+		{250, "g", "250 g"},
+		{1000, "ml", "1 l"},
+		{2, "tbsp", "30 ml"},
+		{1, "cup", "240 ml"},
+		{333.3333, "g", "333.33 g"},
+		{3, "i", "3"},
+		{2, "is", "2"},
+		{1, "pinch", "1 pinch"},
+		{2, "", "2"},
+	}
+	for _, test := range tests {
+		if formatted := Format(test.amount, test.unit); formatted != test.expected {
+			t.Errorf("Format(%v, %q) = %q, expected %q", test.amount, test.unit, formatted, test.expected)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		symbol   string
+		expected string
+		err      error
+	}{
+		{"g", "g", nil},
+		{"grams", "g", nil},
+		{"Kg", "kg", nil},
+		{" litres ", "l", nil},
+		{"cs", "tbsp", nil},
+		{"cc", "tsp", nil},
+		{"is", "i", nil},
+		{"pieces", "i", nil},
+		{"pound", "", ErrUnknownUnit},
+		{"", "", ErrUnknownUnit},
+	}
+	for _, test := range tests {
+		symbol, err := Canonical(test.symbol)
+		if !errors.Is(err, test.err) || symbol != test.expected {
+			t.Errorf("Canonical(%q) = %q, %v, expected %q, %v", test.symbol, symbol, err, test.expected, test.err)
+		}
+		if Valid(test.symbol) != (test.err == nil) {
+			t.Errorf("Valid(%q) should be %v", test.symbol, test.err == nil)
+		}
+	}
+}
+
+func TestToMass(t *testing.T) {
+	densities := Densities{
+		"flour": {GramsPerMl: 0.55},
+		"egg":   {GramsPerPiece: 60},
+	}
+	tests := []struct {
+		ingredient string
+		amount     float64
+		unit       string
+		expected   float64
+		ok         bool
+	}{
+		{"flour", 1, "kg", 1000, true},
+		{"flour", 200, "ml", 110, true},
+		{"flour", 1, "cup", 132, true},
+		{"flour", 2, "i", 0, false},
+		{"egg", 3, "i", 180, true},
+		{"egg", 100, "ml", 0, false},
+		{"milk", 1, "l", 0, false},
+		{"milk", 1, "pinch", 0, false},
+	}
+	for _, test := range tests {
+		grams, ok := densities.ToMass(test.ingredient, test.amount, test.unit)
+		if ok != test.ok || grams != test.expected {
+			t.Errorf("ToMass(%s, %v, %s) = %v, %v, expected %v, %v", test.ingredient, test.amount, test.unit, grams, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestSetDensities(t *testing.T) {
+	defer SetDensities(nil)
+
+	if _, ok := ToMass("flour", 200, "ml"); ok {
+		t.Errorf("The volume should not be converted without a density table")
+	}
+	if grams, ok := ToMass("flour", 1, "kg"); !ok || grams != 1000 {
+		t.Errorf("The mass should be converted without a density table: %v %v", grams, ok)
+	}
+	SetDensities(Densities{"flour": {GramsPerMl: 0.55}})
+	if grams, ok := ToMass("flour", 200, "ml"); !ok || grams != 110 {
+		t.Errorf("The volume should be converted with the density table: %v %v", grams, ok)
+	}
+}
+
+func TestAddDensity(t *testing.T) {
+	defer SetDensities(nil)
+
+	AddDensity("milk", Density{GramsPerMl: 1.03})
+	if grams, ok := ToMass("milk", 1, "l"); !ok || grams != 1030 {
+		t.Errorf("The volume should be converted with the density of the catalog: %v %v", grams, ok)
+	}
+	SetDensities(Densities{"milk": {GramsPerMl: 1}})
+	if grams, ok := ToMass("milk", 1, "l"); !ok || grams != 1000 {
+		t.Errorf("The density table should take precedence over the catalog: %v %v", grams, ok)
+	}
+}
+
+func TestLoadDensities(t *testing.T) {
+	path := t.TempDir() + "/densities.json"
+	os.WriteFile(path, []byte(`{"000000000000000000000001":{"gramsPerMl":1.03},"000000000000000000000002":{"gramsPerPiece":60}}`), 0o600)
+
+	densities, err := LoadDensities(path)
+	if err != nil || len(densities) != 2 || densities["000000000000000000000001"].GramsPerMl != 1.03 {
+		t.Errorf("Failed to load the densities: %v %v", densities, err)
+	}
+	if _, err := LoadDensities(t.TempDir() + "/missing.json"); err == nil {
+		t.Errorf("A missing file should fail")
+	}
+}
@@ -2,6 +2,8 @@ package validation
 
 import (
 	"shopping-list/configuration"
+	"shopping-list/db"
+	"shopping-list/units"
 
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
@@ -19,12 +21,28 @@ func New(conf *configuration.Configuration) *Validation {
 
 	var trans ut.Translator
 	validate := validator.New()
+	// The units are checked against the registry of the units package, with their aliases
+	validate.RegisterValidation("unit", validateUnit)
+	// The user IDs are part of the keys of the store
+	validate.RegisterValidation("userid", validateUserID)
 
 	if conf.TranslateValidation {
 		en := en.New()
 		uni := ut.New(en, en)
 		trans, _ = uni.GetTranslator("en")
 		en_translations.RegisterDefaultTranslations(validate, trans)
+		validate.RegisterTranslation("unit", trans, func(ut ut.Translator) error {
+			return ut.Add("unit", "{0} must be a known unit", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("unit", fe.Field())
+			return t
+		})
+		validate.RegisterTranslation("userid", trans, func(ut ut.Translator) error {
+			return ut.Add("userid", "{0} must be a user ID without : * ? [", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("userid", fe.Field())
+			return t
+		})
 	}
 
 	return &Validation{
@@ -32,3 +50,11 @@ func New(conf *configuration.Configuration) *Validation {
 		Trans:    trans,
 	}
 }
+
+func validateUnit(fl validator.FieldLevel) bool {
+	return units.Valid(fl.Field().String())
+}
+
+func validateUserID(fl validator.FieldLevel) bool {
+	return db.ValidUserID(fl.Field().String())
+}